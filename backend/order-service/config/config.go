@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"order-service/external"
+	"zamato/pkg/auth"
+	"zamato/pkg/server"
+)
+
+// Config holds the runtime settings of order-service, read from the
+// environment.
+type Config struct {
+	Port        string
+	DatabaseURL string
+	Auth        auth.Config
+	Payment     external.PaymentClientConfig
+	Outbox      OutboxConfig
+	Menu        MenuConfig
+	// IdempotencyTTL is how long Idempotency-Key responses are kept for replay.
+	// IdempotencyLockTimeout is how long a request may hold its key before a
+	// retry may take it over.
+	IdempotencyTTL         time.Duration
+	IdempotencyLockTimeout time.Duration
+	// DefaultCurrency is assumed for amounts stored before they carried a
+	// currency.
+	DefaultCurrency string
+	// OrderIDNode is the Snowflake node ID of this instance; every instance
+	// sharing the database needs its own.
+	OrderIDNode int
+	Server      server.Config
+}
+
+// MenuConfig selects the menu catalog used to price checkout items. Source is
+// either "file" (serve the JSON array of menu items in File, by default the
+// catalog shipped with the service) or "http" (query the menu service at
+// ServiceURL).
+type MenuConfig struct {
+	Source     string
+	ServiceURL string
+	File       string
+	Timeout    time.Duration
+}
+
+// OutboxConfig controls the relay that publishes outbox events. Broker is
+// either "file" (append JSON lines to FilePath) or "memory".
+type OutboxConfig struct {
+	Broker       string
+	FilePath     string
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+// Load reads the configuration from the environment. Settings that cannot
+// be parsed are logged and defaulted; values that parse but cannot work,
+// such as a non-positive outbox poll interval, are an error.
+func Load() (Config, error) {
+	cfg := Config{
+		Port:        getEnv("PORT", "8080"),
+		DatabaseURL: os.Getenv("DATABASE_URL"),
+		Auth: auth.Config{
+			HMACSecret:       os.Getenv("JWT_SECRET"),
+			RSAPublicKeyFile: os.Getenv("JWT_PUBLIC_KEY_FILE"),
+			JWKSURL:          os.Getenv("JWT_JWKS_URL"),
+			Issuer:           os.Getenv("JWT_ISSUER"),
+			Leeway:           getDuration("JWT_LEEWAY", 30*time.Second),
+			ServiceName:      getEnv("SERVICE_NAME", "order-service"),
+			ServiceSecret:    os.Getenv("SERVICE_TOKEN_SECRET"),
+			TrustedServices:  getList("TRUSTED_SERVICES", []string{"payment-service"}),
+			ServiceTokenTTL:  getDuration("SERVICE_TOKEN_TTL", 5*time.Minute),
+		},
+		Payment: external.PaymentClientConfig{
+			BaseURL:     getEnv("PAYMENT_SERVICE_URL", "http://localhost:8083"),
+			ServiceName: getEnv("PAYMENT_SERVICE_NAME", "payment-service"),
+			Timeout:     getDuration("PAYMENT_TIMEOUT", 5*time.Second),
+			MaxRetries:  getInt("PAYMENT_MAX_RETRIES", 3),
+			Backoff:     getDuration("PAYMENT_RETRY_BACKOFF", 200*time.Millisecond),
+			MaxBackoff:  getDuration("PAYMENT_RETRY_MAX_BACKOFF", 2*time.Second),
+		},
+		Outbox: OutboxConfig{
+			Broker:       getEnv("OUTBOX_BROKER", "file"),
+			FilePath:     getEnv("OUTBOX_FILE", "order-events.jsonl"),
+			PollInterval: getDuration("OUTBOX_POLL_INTERVAL", time.Second),
+			BatchSize:    getInt("OUTBOX_BATCH_SIZE", 100),
+		},
+		Menu: MenuConfig{
+			Source:     getEnv("MENU_CATALOG", "file"),
+			ServiceURL: getEnv("MENU_SERVICE_URL", "http://localhost:8084"),
+			File:       getEnv("MENU_CATALOG_FILE", "menu.json"),
+			Timeout:    getDuration("MENU_TIMEOUT", 3*time.Second),
+		},
+		IdempotencyTTL:         getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		IdempotencyLockTimeout: getDuration("IDEMPOTENCY_LOCK_TIMEOUT", 2*time.Minute),
+		DefaultCurrency:        getEnv("DEFAULT_CURRENCY", "USD"),
+		OrderIDNode:            getInt("ORDER_ID_NODE", 0),
+		Server: server.Config{
+			ReadHeaderTimeout: getDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+			ReadTimeout:       getDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+			WriteTimeout:      getDuration("HTTP_WRITE_TIMEOUT", 60*time.Second),
+			IdleTimeout:       getDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+			DrainDelay:        getDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+			ShutdownTimeout:   getDuration("SHUTDOWN_TIMEOUT", 20*time.Second),
+			CheckTimeout:      getDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		},
+	}
+	if cfg.DatabaseURL == "" {
+		cfg.DatabaseURL = "host=localhost user=glassbreak password=glassbreak dbname=glassbreak port=5432 sslmode=disable"
+		log.Println("DATABASE_URL not set, using glassbreak fallback config")
+	}
+	if cfg.Outbox.PollInterval <= 0 {
+		return Config{}, fmt.Errorf("OUTBOX_POLL_INTERVAL must be positive, got %s", cfg.Outbox.PollInterval)
+	}
+	if cfg.Outbox.BatchSize <= 0 {
+		return Config{}, fmt.Errorf("OUTBOX_BATCH_SIZE must be positive, got %d", cfg.Outbox.BatchSize)
+	}
+	if cfg.IdempotencyLockTimeout <= 0 {
+		return Config{}, fmt.Errorf("IDEMPOTENCY_LOCK_TIMEOUT must be positive, got %s", cfg.IdempotencyLockTimeout)
+	}
+	return cfg, nil
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("invalid duration %q for %s, using %s", v, key, fallback)
+		return fallback
+	}
+	return d
+}
+
+func getInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("invalid integer %q for %s, using %d", v, key, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getList reads a comma-separated list, ignoring empty entries.
+func getList(key string, fallback []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_Outbox(t *testing.T) {
+	cfg, err := Load()
+	assert.NoError(t, err)
+	assert.Positive(t, cfg.Outbox.PollInterval)
+	assert.Positive(t, cfg.Outbox.BatchSize)
+
+	tests := []struct {
+		key, value string
+	}{
+		{"OUTBOX_POLL_INTERVAL", "0s"},
+		{"OUTBOX_POLL_INTERVAL", "-1s"},
+		{"OUTBOX_BATCH_SIZE", "0"},
+		{"OUTBOX_BATCH_SIZE", "-5"},
+		{"IDEMPOTENCY_LOCK_TIMEOUT", "0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			_, err := Load()
+			assert.ErrorContains(t, err, tt.key)
+		})
+	}
+}
@@ -1,30 +1,132 @@
 package contracts
 
-import "order-service/models"
+import (
+	"order-service/models"
+	"time"
+	"zamato/pkg/money"
+)
 
 type CheckoutRequest struct {
-	Items   []models.OrderItem `json:"items"`
-	Address string             `json:"delivery_address"`
+	Items   []CheckoutItem `json:"items"`
+	Address string         `json:"delivery_address"`
+}
+
+// CheckoutItem is what a client may say about an item it orders. Name and
+// price are looked up server-side from the menu catalog.
+type CheckoutItem struct {
+	MenuItemID uint `json:"menu_item_id"`
+	Quantity   int  `json:"quantity"`
 }
 
 type CheckoutResponse struct {
-	OrderID string `json:"order_id"`
+	OrderID   string             `json:"order_id"`
+	Status    models.OrderStatus `json:"status"`
+	PaymentID *string            `json:"payment_id,omitempty"`
+}
+
+// Sort orders of OrderHistoryQuery.
+const (
+	SortNewestFirst = "-created_at"
+	SortOldestFirst = "created_at"
+)
+
+// OrderHistoryQuery asks for a page of a user's orders. Statuses and the
+// creation time range (From inclusive, To exclusive) filter the orders, Sort
+// is SortNewestFirst (the default) or SortOldestFirst, and Limit defaults to
+// 20 and may be at most 100. Cursor is the next_cursor of the previous page,
+// which must be requested with the same filters and sort.
+type OrderHistoryQuery struct {
+	Statuses []models.OrderStatus
+	From     *time.Time
+	To       *time.Time
+	Sort     string
+	Limit    int
+	Cursor   string
+}
+
+// OrderPage is a page of GET /orders. NextCursor is set when more orders
+// follow; pass it as the cursor parameter to get them.
+type OrderPage struct {
+	Orders     []models.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
 }
 
 type UpdateOrderStatusRequest struct {
 	Status models.OrderStatus `json:"status"`
+	Reason string             `json:"reason,omitempty"`
+}
+
+// AssignCourierRequest is the body of POST /orders/{id}/courier.
+type AssignCourierRequest struct {
+	CourierID uint `json:"courier_id"`
 }
 
+// CancelOrderRequest is the optional body of POST /orders/{id}/cancel.
+type CancelOrderRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// ProcessPaymentRequest is the body of the callback payment-service sends to
+// POST /orders/{orderId}/payment when a payment of the order completes or
+// fails. Status is PaymentStatusCompleted or PaymentStatusFailed.
 type ProcessPaymentRequest struct {
 	PaymentID string `json:"payment_id"`
+	Status    string `json:"status"`
 }
 
 type PaymentRequest struct {
-	OrderID string  `json:"order_id"`
-	Amount  float64 `json:"amount"`
+	OrderID string      `json:"order_id"`
+	Amount  money.Money `json:"amount"`
 }
 
+// PaymentResponse is the subset of payment-service's payment resource that
+// order-service needs.
 type PaymentResponse struct {
-	PaymentID string `json:"payment_id"`
-	Status    string `json:"status"`
+	PaymentID     string `json:"id"`
+	Status        string `json:"status"`
+	TransactionID string `json:"transaction_id"`
+}
+
+// Payment statuses reported by payment-service. A completed payment was
+// charged; an authorized one only holds the funds until it is captured or
+// voided, and a pending one waits for the gateway to confirm its capture.
+const (
+	PaymentStatusPending    = "pending"
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCompleted  = "completed"
+	PaymentStatusVoided     = "voided"
+	PaymentStatusFailed     = "failed"
+)
+
+// RefundRequest asks payment-service to refund whatever has not been refunded
+// of a payment yet.
+type RefundRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// RefundResponse is the subset of payment-service's refund resource that
+// order-service needs.
+type RefundResponse struct {
+	RefundID string `json:"id"`
+	Status   string `json:"status"`
+}
+
+// OrderCreatedEvent is the payload of models.EventOrderCreated.
+type OrderCreatedEvent struct {
+	OrderID         uint64             `json:"order_id,string"`
+	UserID          uint               `json:"user_id"`
+	TotalAmount     money.Money        `json:"total_amount"`
+	Status          models.OrderStatus `json:"status"`
+	DeliveryAddress string             `json:"delivery_address"`
+	CreatedAt       time.Time          `json:"created_at"`
+}
+
+// OrderStatusChangedEvent is the payload of models.EventOrderStatusChanged.
+type OrderStatusChangedEvent struct {
+	OrderID    uint64             `json:"order_id,string"`
+	FromStatus models.OrderStatus `json:"from_status"`
+	ToStatus   models.OrderStatus `json:"to_status"`
+	ActorID    uint               `json:"actor_id"`
+	Reason     string             `json:"reason,omitempty"`
+	ChangedAt  time.Time          `json:"changed_at"`
 }
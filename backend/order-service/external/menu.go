@@ -0,0 +1,106 @@
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"zamato/pkg/money"
+)
+
+// MenuItem is the authoritative description of something a customer can
+// order. RestaurantID is the user ID of the restaurant that serves it.
+type MenuItem struct {
+	ID           uint        `json:"id"`
+	RestaurantID uint        `json:"restaurant_id"`
+	Name         string      `json:"name"`
+	Price        money.Money `json:"price"`
+	Available    bool        `json:"available"`
+}
+
+// MenuCatalog resolves menu item IDs to their current name, price and
+// availability. IDs the catalog does not know are left out of the result.
+type MenuCatalog interface {
+	GetMenuItems(ids []uint) (map[uint]MenuItem, error)
+}
+
+// StaticMenuCatalog serves a fixed set of menu items. It is meant for tests
+// and local development.
+type StaticMenuCatalog map[uint]MenuItem
+
+func NewStaticMenuCatalog(items ...MenuItem) StaticMenuCatalog {
+	c := make(StaticMenuCatalog, len(items))
+	for _, item := range items {
+		c[item.ID] = item
+	}
+	return c
+}
+
+// LoadMenuCatalogFile reads a JSON array of menu items from path.
+func LoadMenuCatalogFile(path string) (StaticMenuCatalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var items []MenuItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("parse menu catalog %s: %w", path, err)
+	}
+	return NewStaticMenuCatalog(items...), nil
+}
+
+func (c StaticMenuCatalog) GetMenuItems(ids []uint) (map[uint]MenuItem, error) {
+	result := make(map[uint]MenuItem, len(ids))
+	for _, id := range ids {
+		if item, ok := c[id]; ok {
+			result[id] = item
+		}
+	}
+	return result, nil
+}
+
+type httpMenuCatalog struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPMenuCatalog returns a catalog backed by the menu service's
+// `GET /menu-items?ids=1,2,3` endpoint.
+func NewHTTPMenuCatalog(baseURL string, timeout time.Duration) MenuCatalog {
+	return &httpMenuCatalog{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *httpMenuCatalog) GetMenuItems(ids []uint) (map[uint]MenuItem, error) {
+	params := make([]string, len(ids))
+	for i, id := range ids {
+		params[i] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	resp, err := c.client.Get(c.baseURL + "/menu-items?ids=" + strings.Join(params, ","))
+	if err != nil {
+		return nil, fmt.Errorf("fetch menu items: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("fetch menu items: menu service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var items []MenuItem
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("decode menu items: %w", err)
+	}
+	result := make(map[uint]MenuItem, len(items))
+	for _, item := range items {
+		result[item.ID] = item
+	}
+	return result, nil
+}
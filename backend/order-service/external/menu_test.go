@@ -0,0 +1,56 @@
+package external
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"zamato/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMenuCatalog_GetMenuItems(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query().Get("ids")
+		json.NewEncoder(w).Encode([]MenuItem{{ID: 1, Name: "Margherita", Price: money.MustParse("10.00", "USD"), Available: true}})
+	}))
+	defer srv.Close()
+
+	items, err := NewHTTPMenuCatalog(srv.URL, time.Second).GetMenuItems([]uint{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "1,2", gotQuery)
+	assert.Len(t, items, 1)
+	assert.Equal(t, money.MustParse("10.00", "USD"), items[1].Price)
+}
+
+func TestHTTPMenuCatalog_ServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := NewHTTPMenuCatalog(srv.URL, time.Second).GetMenuItems([]uint{1})
+	assert.ErrorContains(t, err, "503")
+}
+
+func TestLoadMenuCatalogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "menu.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"id":3,"name":"Tiramisu","price":{"amount":"6.50","currency":"USD"},"available":true}]`), 0o644))
+
+	catalog, err := LoadMenuCatalogFile(path)
+	assert.NoError(t, err)
+	items, _ := catalog.GetMenuItems([]uint{3, 4})
+	assert.Equal(t, map[uint]MenuItem{3: {ID: 3, Name: "Tiramisu", Price: money.MustParse("6.50", "USD"), Available: true}}, items)
+}
+
+func TestLoadMenuCatalogFile_Shipped(t *testing.T) {
+	catalog, err := LoadMenuCatalogFile("../menu.json")
+	assert.NoError(t, err)
+	items, _ := catalog.GetMenuItems([]uint{1, 2})
+	assert.Len(t, items, 2)
+}
@@ -3,26 +3,200 @@ package external
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"order-service/contracts"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
-func ProcessPayment(url string, request contracts.PaymentRequest) (*contracts.PaymentResponse, error) {
+// PaymentClient requests payments from payment-service.
+type PaymentClient interface {
+	CreatePayment(request contracts.PaymentRequest) (*contracts.PaymentResponse, error)
+	GetPayment(paymentID string) (*contracts.PaymentResponse, error)
+	VoidPayment(paymentID string) (*contracts.PaymentResponse, error)
+	RefundPayment(paymentID string, request contracts.RefundRequest) (*contracts.RefundResponse, error)
+}
+
+// PaymentClientConfig configures the HTTP payment client. Requests that fail
+// with a network error, a 5xx response or a 409 saying the same request is
+// still in progress are retried up to MaxRetries times,
+// waiting Backoff, 2*Backoff, 4*Backoff, ... (capped at MaxBackoff) between
+// attempts. ServiceName is the name payment-service accepts service tokens
+// for.
+type PaymentClientConfig struct {
+	BaseURL     string
+	ServiceName string
+	Timeout     time.Duration
+	MaxRetries  int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// TokenSource supplies the service tokens order-service presents to the
+// services it calls.
+type TokenSource interface {
+	Token(audience string) (string, error)
+}
+
+// StatusError is returned when payment-service answers with a non-2xx status.
+// Code is the problem code of the response, if it had one.
+type StatusError struct {
+	StatusCode int
+	Code       string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("payment-service returned %d: %s", e.StatusCode, e.Body)
+}
+
+// Declined reports whether payment-service refused to charge the payment.
+func (e *StatusError) Declined() bool {
+	return e.StatusCode == http.StatusPaymentRequired
+}
+
+// InProgress reports whether payment-service is still processing an earlier
+// request with the same Idempotency-Key, such as one the client gave up on
+// after a timeout.
+func (e *StatusError) InProgress() bool {
+	return e.StatusCode == http.StatusConflict && e.Code == "idempotency_in_progress"
+}
+
+// Retryable reports whether the request may succeed if sent again.
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.InProgress()
+}
+
+type httpPaymentClient struct {
+	cfg    PaymentClientConfig
+	tokens TokenSource
+	client *http.Client
+	sleep  func(time.Duration)
+}
+
+// NewPaymentClient returns a client that authenticates every request with a
+// token from tokens.
+func NewPaymentClient(cfg PaymentClientConfig, tokens TokenSource) PaymentClient {
+	return &httpPaymentClient{
+		cfg:    cfg,
+		tokens: tokens,
+		client: &http.Client{Timeout: cfg.Timeout},
+		sleep:  time.Sleep,
+	}
+}
+
+func (c *httpPaymentClient) CreatePayment(request contracts.PaymentRequest) (*contracts.PaymentResponse, error) {
 	body, err := json.Marshal(request)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
-	if err != nil {
+	// Every payment attempt gets its own key, which its retries reuse: a
+	// retry is charged at most once, while a new attempt for the same order
+	// is not answered with the outcome of an earlier one, such as a decline.
+	headers := http.Header{"Idempotency-Key": {"order-" + request.OrderID + "-" + uuid.NewString()}}
+
+	var response contracts.PaymentResponse
+	if err := c.do(http.MethodPost, "/payments", headers, body, &response); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &response, nil
+}
 
+func (c *httpPaymentClient) GetPayment(paymentID string) (*contracts.PaymentResponse, error) {
 	var response contracts.PaymentResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := c.do(http.MethodGet, "/payments/"+url.PathEscape(paymentID), nil, nil, &response); err != nil {
 		return nil, err
 	}
+	return &response, nil
+}
 
+func (c *httpPaymentClient) VoidPayment(paymentID string) (*contracts.PaymentResponse, error) {
+	var response contracts.PaymentResponse
+	if err := c.do(http.MethodPost, "/payments/"+url.PathEscape(paymentID)+"/void", nil, nil, &response); err != nil {
+		return nil, err
+	}
 	return &response, nil
 }
+
+func (c *httpPaymentClient) RefundPayment(paymentID string, request contracts.RefundRequest) (*contracts.RefundResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	var response contracts.RefundResponse
+	if err := c.do(http.MethodPost, "/payments/"+url.PathEscape(paymentID)+"/cancellation-refund", nil, body, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// do sends the request, retrying transient failures, and decodes a 2xx
+// response body into out.
+func (c *httpPaymentClient) do(method, path string, headers http.Header, body []byte, out interface{}) error {
+	url := strings.TrimRight(c.cfg.BaseURL, "/") + path
+	backoff := c.cfg.Backoff
+
+	var lastErr error
+	for attempt := 0; attempt <= c.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			c.sleep(backoff)
+			backoff *= 2
+			if c.cfg.MaxBackoff > 0 && backoff > c.cfg.MaxBackoff {
+				backoff = c.cfg.MaxBackoff
+			}
+		}
+
+		var retryable bool
+		retryable, lastErr = c.attempt(method, url, headers, body, out)
+		if lastErr == nil || !retryable {
+			return lastErr
+		}
+	}
+	return fmt.Errorf("payment request failed after %d attempts: %w", c.cfg.MaxRetries+1, lastErr)
+}
+
+// attempt performs a single request. The returned bool reports whether a
+// failure is transient and the request may be retried.
+func (c *httpPaymentClient) attempt(method, url string, headers http.Header, body []byte, out interface{}) (bool, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token, err := c.tokens.Token(c.cfg.ServiceName)
+	if err != nil {
+		return false, fmt.Errorf("service token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		statusErr := &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+		var details struct {
+			Code string `json:"code"`
+		}
+		if json.Unmarshal(msg, &details) == nil {
+			statusErr.Code = details.Code
+		}
+		return statusErr.Retryable(), statusErr
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("decode payment-service response: %w", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,204 @@
+package external
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"order-service/contracts"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"zamato/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticTokens string
+
+func (s staticTokens) Token(audience string) (string, error) {
+	return string(s) + "-for-" + audience, nil
+}
+
+func newTestClient(url string, maxRetries int) *httpPaymentClient {
+	c := NewPaymentClient(PaymentClientConfig{
+		BaseURL:     url,
+		ServiceName: "payment-service",
+		Timeout:     time.Second,
+		MaxRetries:  maxRetries,
+		Backoff:     time.Millisecond,
+	}, staticTokens("svc")).(*httpPaymentClient)
+	c.sleep = func(time.Duration) {}
+	return c
+}
+
+func TestPaymentClient_CreatePayment(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    []int
+		maxRetries   int
+		wantErr      bool
+		wantAttempts int32
+	}{
+		{name: "success", responses: []int{http.StatusCreated}, maxRetries: 3, wantAttempts: 1},
+		{name: "retry on 5xx then success", responses: []int{http.StatusBadGateway, http.StatusInternalServerError, http.StatusCreated}, maxRetries: 3, wantAttempts: 3},
+		{name: "no retry on 4xx", responses: []int{http.StatusBadRequest}, maxRetries: 3, wantErr: true, wantAttempts: 1},
+		{name: "retries exhausted", responses: []int{http.StatusServiceUnavailable}, maxRetries: 2, wantErr: true, wantAttempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			var keys []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				assert.Equal(t, "/payments", r.URL.Path)
+				assert.Equal(t, http.MethodPost, r.Method)
+				keys = append(keys, r.Header.Get("Idempotency-Key"))
+				assert.True(t, strings.HasPrefix(keys[n-1], "order-42-"), keys[n-1])
+				assert.Equal(t, keys[0], keys[n-1], "retries reuse the key")
+				assert.Equal(t, "Bearer svc-for-payment-service", r.Header.Get("Authorization"))
+
+				var req contracts.PaymentRequest
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, "42", req.OrderID)
+
+				status := tt.responses[len(tt.responses)-1]
+				if int(n) <= len(tt.responses) {
+					status = tt.responses[n-1]
+				}
+				w.WriteHeader(status)
+				if status == http.StatusCreated {
+					json.NewEncoder(w).Encode(map[string]interface{}{"id": "pay_1", "status": "completed", "transaction_id": "tx"})
+				} else {
+					w.Write([]byte("boom"))
+				}
+			}))
+			defer srv.Close()
+
+			resp, err := newTestClient(srv.URL, tt.maxRetries).CreatePayment(contracts.PaymentRequest{OrderID: "42", Amount: money.MustParse("10.00", "USD")})
+			assert.Equal(t, tt.wantAttempts, atomic.LoadInt32(&attempts))
+			if tt.wantErr {
+				assert.Error(t, err)
+				var statusErr *StatusError
+				assert.ErrorAs(t, err, &statusErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "pay_1", resp.PaymentID)
+			assert.Equal(t, contracts.PaymentStatusCompleted, resp.Status)
+		})
+	}
+}
+
+func TestPaymentClient_CreatePaymentKeyPerAttempt(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		w.WriteHeader(http.StatusPaymentRequired)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL, 0)
+	for i := 0; i < 2; i++ {
+		_, err := c.CreatePayment(contracts.PaymentRequest{OrderID: "42", Amount: money.MustParse("10.00", "USD")})
+		assert.Error(t, err)
+	}
+	if assert.Len(t, keys, 2) {
+		assert.NotEqual(t, keys[0], keys[1], "a new attempt must not replay the decline")
+	}
+}
+
+func TestPaymentClient_InProgressIsRetried(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"status":409,"code":"idempotency_in_progress"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "pay_1", "status": "completed"})
+	}))
+	defer srv.Close()
+
+	resp, err := newTestClient(srv.URL, 2).CreatePayment(contracts.PaymentRequest{OrderID: "42", Amount: money.MustParse("10.00", "USD")})
+	assert.NoError(t, err)
+	assert.Equal(t, "pay_1", resp.PaymentID)
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, keys[0], keys[1])
+	}
+}
+
+func TestPaymentClient_OtherConflictIsNotRetried(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"status":409,"code":"invalid_state"}`))
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient(srv.URL, 2).CreatePayment(contracts.PaymentRequest{OrderID: "42", Amount: money.MustParse("10.00", "USD")})
+	var statusErr *StatusError
+	if assert.ErrorAs(t, err, &statusErr) {
+		assert.Equal(t, "invalid_state", statusErr.Code)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestPaymentClient_NetworkErrorIsRetried(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	c := newTestClient(url, 2)
+	var sleeps []time.Duration
+	c.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	_, err := c.CreatePayment(contracts.PaymentRequest{OrderID: "42", Amount: money.MustParse("10.00", "USD")})
+	assert.Error(t, err)
+	assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond}, sleeps)
+}
+
+func TestPaymentClient_CancelPayment(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /payments/pay_1":
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "pay_1", "status": "authorized"})
+		case "POST /payments/pay_1/void":
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "pay_1", "status": "voided"})
+		case "POST /payments/pay_1/cancellation-refund":
+			var req contracts.RefundRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "changed my mind", req.Reason)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "re_1", "status": "completed"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	c := newTestClient(srv.URL, 0)
+
+	payment, err := c.GetPayment("pay_1")
+	assert.NoError(t, err)
+	assert.Equal(t, contracts.PaymentStatusAuthorized, payment.Status)
+
+	payment, err = c.VoidPayment("pay_1")
+	assert.NoError(t, err)
+	assert.Equal(t, contracts.PaymentStatusVoided, payment.Status)
+
+	refund, err := c.RefundPayment("pay_1", contracts.RefundRequest{Reason: "changed my mind"})
+	assert.NoError(t, err)
+	assert.Equal(t, "re_1", refund.RefundID)
+
+	_, err = c.GetPayment("missing")
+	var statusErr *StatusError
+	assert.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+
+	assert.Equal(t, []string{"GET /payments/pay_1", "POST /payments/pay_1/void", "POST /payments/pay_1/cancellation-refund", "GET /payments/missing"}, requests)
+}
@@ -2,15 +2,29 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"order-service/contracts"
+	"order-service/models"
 	"order-service/service"
+	"zamato/pkg/auth"
+	"zamato/pkg/pagination"
+	"zamato/pkg/problem"
 
 	"github.com/gorilla/mux"
 )
 
+var (
+	errInvalidOrderID = problem.New(problem.Invalid, "invalid_order_id", "invalid order id")
+	errNoCaller       = fmt.Errorf("%w: userID not found in context", problem.ErrUnauthorized)
+)
+
 type OrderHandler struct {
 	service service.OrderService
 }
@@ -22,38 +36,77 @@ func NewOrderHandler(service service.OrderService) *OrderHandler {
 func (h *OrderHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 	var request contracts.CheckoutRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, fmt.Errorf("%w: %v", problem.ErrInvalidRequest, err))
 		return
 	}
-	userID, ok := r.Context().Value("userID").(uint)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "userID not found in context", http.StatusUnauthorized)
+		problem.Write(w, r, errNoCaller)
 		return
 	}
 	order, err := h.service.CreateOrder(userID, request.Items, request.Address)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(contracts.CheckoutResponse{
-		OrderID: strconv.FormatUint(order.ID, 10),
+		OrderID:   strconv.FormatUint(order.ID, 10),
+		Status:    order.Status,
+		PaymentID: order.PaymentID,
 	})
 }
 
 func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(uint)
+	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "userID not found in context", http.StatusUnauthorized)
+		problem.Write(w, r, errNoCaller)
 		return
 	}
-	orders, err := h.service.GetOrderHistory(userID)
+	query, err := orderHistoryQuery(r.URL.Query())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
+		return
+	}
+	page, err := h.service.GetOrderHistory(userID, query)
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(orders)
+	json.NewEncoder(w).Encode(page)
+}
+
+// orderHistoryQuery reads the parameters of GET /orders: limit, cursor,
+// sort, status (repeated or comma-separated) and the from/to creation time
+// range, each an RFC 3339 time or a date. A date in to includes that day.
+func orderHistoryQuery(params url.Values) (contracts.OrderHistoryQuery, error) {
+	query := contracts.OrderHistoryQuery{
+		Sort:   params.Get("sort"),
+		Cursor: params.Get("cursor"),
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("%w: invalid limit %q", problem.ErrInvalidRequest, v)
+		}
+		query.Limit = limit
+	}
+	for _, v := range params["status"] {
+		for _, status := range strings.Split(v, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				query.Statuses = append(query.Statuses, models.OrderStatus(strings.ToUpper(status)))
+			}
+		}
+	}
+	var err error
+	if query.From, err = pagination.TimeParam(params, "from", false); err != nil {
+		return query, err
+	}
+	if query.To, err = pagination.TimeParam(params, "to", true); err != nil {
+		return query, err
+	}
+	return query, nil
 }
 
 func (h *OrderHandler) GetOrderById(w http.ResponseWriter, r *http.Request) {
@@ -61,17 +114,19 @@ func (h *OrderHandler) GetOrderById(w http.ResponseWriter, r *http.Request) {
 	orderID := vars["id"]
 
 	if _, err := strconv.ParseUint(orderID, 10, 64); err != nil {
-		http.Error(w, "invalid order id", http.StatusBadRequest)
+		problem.Write(w, r, errInvalidOrderID)
 		return
 	}
 
-	order, err := h.service.GetOrder(orderID)
+	caller, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, errNoCaller)
+		return
+	}
+
+	order, err := h.service.GetOrder(orderID, caller)
 	if err != nil {
-		if err.Error() == "record not found" {
-			http.Error(w, "order not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 
@@ -84,41 +139,162 @@ func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 	orderID := vars["id"]
 
 	if _, err := strconv.ParseUint(orderID, 10, 64); err != nil {
-		http.Error(w, "invalid order id", http.StatusBadRequest)
+		problem.Write(w, r, errInvalidOrderID)
+		return
+	}
+
+	caller, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, errNoCaller)
 		return
 	}
 
 	var req contracts.UpdateOrderStatusRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, fmt.Errorf("%w: invalid request body: %v", problem.ErrInvalidRequest, err))
 		return
 	}
 
-	if err := h.service.UpdateOrderStatus(orderID, req.Status); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.UpdateOrderStatus(orderID, req.Status, caller, req.Reason); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *OrderHandler) AssignCourier(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID := vars["id"]
+
+	if _, err := strconv.ParseUint(orderID, 10, 64); err != nil {
+		problem.Write(w, r, errInvalidOrderID)
+		return
+	}
+
+	caller, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, errNoCaller)
+		return
+	}
+
+	var req contracts.AssignCourierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, fmt.Errorf("%w: invalid request body: %v", problem.ErrInvalidRequest, err))
+		return
+	}
+
+	order, err := h.service.AssignCourier(orderID, req.CourierID, caller)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID := vars["id"]
+
+	if _, err := strconv.ParseUint(orderID, 10, 64); err != nil {
+		problem.Write(w, r, errInvalidOrderID)
+		return
+	}
+
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, errNoCaller)
+		return
+	}
+
+	var req contracts.CancelOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(w, r, fmt.Errorf("%w: invalid request body: %v", problem.ErrInvalidRequest, err))
+		return
+	}
+
+	order, err := h.service.CancelOrder(orderID, userID, req.Reason)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// RetryPayment charges an order of the caller whose payment failed again.
+func (h *OrderHandler) RetryPayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID := vars["id"]
+
+	if _, err := strconv.ParseUint(orderID, 10, 64); err != nil {
+		problem.Write(w, r, errInvalidOrderID)
+		return
+	}
+
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, errNoCaller)
+		return
+	}
+
+	order, err := h.service.RetryPayment(orderID, userID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+func (h *OrderHandler) GetOrderStatusHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID := vars["id"]
+
+	if _, err := strconv.ParseUint(orderID, 10, 64); err != nil {
+		problem.Write(w, r, errInvalidOrderID)
+		return
+	}
+
+	caller, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, errNoCaller)
+		return
+	}
+
+	events, err := h.service.GetOrderStatusHistory(orderID, caller)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// ProcessPayment receives payment-service's report that a payment of the
+// order completed or failed. Only other services may call it.
 func (h *OrderHandler) ProcessPayment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderID := vars["orderId"]
 
 	if _, err := strconv.ParseUint(orderID, 10, 64); err != nil {
-		http.Error(w, "invalid order id", http.StatusBadRequest)
+		problem.Write(w, r, errInvalidOrderID)
 		return
 	}
 
 	var req contracts.ProcessPaymentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, fmt.Errorf("%w: invalid request body: %v", problem.ErrInvalidRequest, err))
 		return
 	}
 
-	if err := h.service.ProcessPayment(orderID, req.PaymentID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.ProcessPayment(orderID, req.PaymentID, req.Status); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
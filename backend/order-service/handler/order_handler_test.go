@@ -5,11 +5,18 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"order-service/contracts"
 	"order-service/mocks"
 	"order-service/models"
+	"order-service/service"
 	"testing"
+	"time"
+	"zamato/pkg/auth"
+	"zamato/pkg/money"
+	"zamato/pkg/problem"
 
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
@@ -17,7 +24,7 @@ import (
 )
 
 func withUserID(ctx context.Context, userID uint) context.Context {
-	return context.WithValue(ctx, "userID", userID)
+	return auth.WithUserID(ctx, userID)
 }
 
 func TestOrderHandler_Checkout(t *testing.T) {
@@ -36,13 +43,13 @@ func TestOrderHandler_Checkout(t *testing.T) {
 			name:   "success",
 			userID: uint(1),
 			body: map[string]interface{}{
-				"items":            []models.OrderItem{{MenuItemID: 1, Quantity: 2, Price: 10}},
+				"items":            []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 2}},
 				"delivery_address": "addr",
 			},
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					CreateOrder(uint(1), []models.OrderItem{{MenuItemID: 1, Quantity: 2, Price: 10}}, "addr").
-					Return(&models.Order{ID: 1, UserID: 1, OrderItems: []models.OrderItem{{MenuItemID: 1, Quantity: 2, Price: 10}}, DeliveryAddress: "addr"}, nil)
+					CreateOrder(uint(1), []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 2}}, "addr").
+					Return(&models.Order{ID: 1, UserID: 1, OrderItems: []models.OrderItem{{MenuItemID: 1, Quantity: 2, Price: money.MustParse("10.00", "USD")}}, DeliveryAddress: "addr"}, nil)
 			},
 			wantStatus: http.StatusOK,
 		},
@@ -57,7 +64,7 @@ func TestOrderHandler_Checkout(t *testing.T) {
 		{
 			name:           "missing userID",
 			userID:         nil,
-			body:           map[string]interface{}{"items": []models.OrderItem{}, "delivery_address": "addr"},
+			body:           map[string]interface{}{"items": []contracts.CheckoutItem{}, "delivery_address": "addr"},
 			mockSetup:      func(m *mocks.MockOrderService) {},
 			wantStatus:     http.StatusUnauthorized,
 			wantErrContain: "userID not found",
@@ -65,15 +72,38 @@ func TestOrderHandler_Checkout(t *testing.T) {
 		{
 			name:   "service error",
 			userID: uint(1),
-			body:   map[string]interface{}{"items": []models.OrderItem{}, "delivery_address": "addr"},
+			body:   map[string]interface{}{"items": []contracts.CheckoutItem{}, "delivery_address": "addr"},
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					CreateOrder(uint(1), []models.OrderItem{}, "addr").
-					Return(nil, errors.New("order must have at least one item"))
+					CreateOrder(uint(1), []contracts.CheckoutItem{}, "addr").
+					Return(nil, fmt.Errorf("%w: order must have at least one item", service.ErrInvalidOrder))
 			},
 			wantStatus:     http.StatusBadRequest,
 			wantErrContain: "order must have at least one item",
 		},
+		{
+			name:   "unavailable item",
+			userID: uint(1),
+			body:   map[string]interface{}{"items": []contracts.CheckoutItem{{MenuItemID: 2, Quantity: 1}}, "delivery_address": "addr"},
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					CreateOrder(uint(1), []contracts.CheckoutItem{{MenuItemID: 2, Quantity: 1}}, "addr").
+					Return(nil, service.ErrMenuItemUnavailable)
+			},
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantErrContain: "not available",
+		},
+		{
+			name:   "menu lookup failed",
+			userID: uint(1),
+			body:   map[string]interface{}{"items": []contracts.CheckoutItem{{MenuItemID: 2, Quantity: 1}}, "delivery_address": "addr"},
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					CreateOrder(uint(1), []contracts.CheckoutItem{{MenuItemID: 2, Quantity: 1}}, "addr").
+					Return(nil, service.ErrMenuLookupFailed)
+			},
+			wantStatus: http.StatusBadGateway,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -107,9 +137,12 @@ func TestOrderHandler_GetOrderHistory(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
 	tests := []struct {
 		name           string
 		userID         interface{}
+		query          string
 		mockSetup      func(m *mocks.MockOrderService)
 		wantStatus     int
 		wantErrContain string
@@ -119,11 +152,55 @@ func TestOrderHandler_GetOrderHistory(t *testing.T) {
 			userID: uint(1),
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					GetOrderHistory(uint(1)).
-					Return([]models.Order{{ID: 1, UserID: 1}}, nil)
+					GetOrderHistory(uint(1), contracts.OrderHistoryQuery{}).
+					Return(&contracts.OrderPage{Orders: []models.Order{{ID: 1, UserID: 1}}, NextCursor: "abc"}, nil)
 			},
 			wantStatus: http.StatusOK,
 		},
+		{
+			name:   "filters",
+			userID: uint(1),
+			query:  "?limit=10&cursor=abc&sort=created_at&status=paid,DELIVERED&status=CANCELLED&from=2024-05-01&to=2024-05-31",
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					GetOrderHistory(uint(1), contracts.OrderHistoryQuery{
+						Statuses: []models.OrderStatus{models.StatusPaid, models.StatusDelivered, models.StatusCancelled},
+						From:     &from,
+						To:       &to,
+						Sort:     contracts.SortOldestFirst,
+						Limit:    10,
+						Cursor:   "abc",
+					}).
+					Return(&contracts.OrderPage{Orders: []models.Order{}}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid limit",
+			userID:         uint(1),
+			query:          "?limit=-1",
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid limit",
+		},
+		{
+			name:           "invalid date",
+			userID:         uint(1),
+			query:          "?from=yesterday",
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid from",
+		},
+		{
+			name:   "invalid query",
+			userID: uint(1),
+			query:  "?cursor=zzz",
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					GetOrderHistory(uint(1), contracts.OrderHistoryQuery{Cursor: "zzz"}).
+					Return(nil, service.ErrInvalidQuery)
+			},
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid order query",
+		},
 		{
 			name:           "missing userID",
 			userID:         nil,
@@ -136,11 +213,11 @@ func TestOrderHandler_GetOrderHistory(t *testing.T) {
 			userID: uint(1),
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					GetOrderHistory(uint(1)).
+					GetOrderHistory(uint(1), contracts.OrderHistoryQuery{}).
 					Return(nil, errors.New("db error"))
 			},
 			wantStatus:     http.StatusInternalServerError,
-			wantErrContain: "db error",
+			wantErrContain: "internal_error",
 		},
 	}
 	for _, tt := range tests {
@@ -149,7 +226,7 @@ func TestOrderHandler_GetOrderHistory(t *testing.T) {
 			if tt.mockSetup != nil {
 				tt.mockSetup(mockSvc)
 			}
-			req := httptest.NewRequest("GET", "/orders", nil)
+			req := httptest.NewRequest("GET", "/orders"+tt.query, nil)
 			if tt.userID != nil {
 				req = req.WithContext(withUserID(req.Context(), tt.userID.(uint)))
 			}
@@ -160,6 +237,11 @@ func TestOrderHandler_GetOrderHistory(t *testing.T) {
 			if tt.wantErrContain != "" {
 				assert.Contains(t, rr.Body.String(), tt.wantErrContain)
 			}
+			if tt.wantStatus == http.StatusOK {
+				var page map[string]interface{}
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+				assert.Contains(t, page, "orders")
+			}
 		})
 	}
 }
@@ -171,16 +253,18 @@ func TestOrderHandler_GetOrderById(t *testing.T) {
 	tests := []struct {
 		name           string
 		id             string
+		userID         interface{}
 		mockSetup      func(m *mocks.MockOrderService)
 		wantStatus     int
 		wantErrContain string
 	}{
 		{
-			name: "success",
-			id:   "1",
+			name:   "success",
+			id:     "1",
+			userID: uint(1),
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					GetOrder("1").
+					GetOrder("1", auth.Principal{UserID: 1, Role: auth.RoleCustomer}).
 					Return(&models.Order{ID: 1, UserID: 1}, nil)
 			},
 			wantStatus: http.StatusOK,
@@ -188,21 +272,43 @@ func TestOrderHandler_GetOrderById(t *testing.T) {
 		{
 			name:           "invalid id",
 			id:             "abc",
+			userID:         uint(1),
 			mockSetup:      func(m *mocks.MockOrderService) {},
 			wantStatus:     http.StatusBadRequest,
 			wantErrContain: "invalid order id",
 		},
 		{
-			name: "not found",
-			id:   "999",
+			name:           "missing userID",
+			id:             "1",
+			userID:         nil,
+			mockSetup:      func(m *mocks.MockOrderService) {},
+			wantStatus:     http.StatusUnauthorized,
+			wantErrContain: "userID not found",
+		},
+		{
+			name:   "not found or not owned",
+			id:     "999",
+			userID: uint(1),
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					GetOrder("999").
-					Return(nil, errors.New("record not found"))
+					GetOrder("999", auth.Principal{UserID: 1, Role: auth.RoleCustomer}).
+					Return(nil, service.ErrOrderNotFound)
 			},
 			wantStatus:     http.StatusNotFound,
 			wantErrContain: "order not found",
 		},
+		{
+			name:   "service error",
+			id:     "1",
+			userID: uint(1),
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					GetOrder("1", auth.Principal{UserID: 1, Role: auth.RoleCustomer}).
+					Return(nil, errors.New("db down"))
+			},
+			wantStatus:     http.StatusInternalServerError,
+			wantErrContain: "internal_error",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -211,6 +317,9 @@ func TestOrderHandler_GetOrderById(t *testing.T) {
 				tt.mockSetup(mockSvc)
 			}
 			req := httptest.NewRequest("GET", "/orders/"+tt.id, nil)
+			if tt.userID != nil {
+				req = req.WithContext(withUserID(req.Context(), tt.userID.(uint)))
+			}
 			rr := httptest.NewRecorder()
 			h := NewOrderHandler(mockSvc)
 			vars := map[string]string{"id": tt.id}
@@ -231,18 +340,20 @@ func TestOrderHandler_UpdateOrderStatus(t *testing.T) {
 	tests := []struct {
 		name           string
 		id             string
+		userID         interface{}
 		body           interface{}
 		mockSetup      func(m *mocks.MockOrderService)
 		wantStatus     int
 		wantErrContain string
 	}{
 		{
-			name: "success",
-			id:   "1",
-			body: map[string]interface{}{"status": models.StatusDelivered},
+			name:   "success",
+			id:     "1",
+			userID: uint(7),
+			body:   map[string]interface{}{"status": models.StatusDelivered},
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					UpdateOrderStatus("1", models.StatusDelivered).
+					UpdateOrderStatus("1", models.StatusDelivered, auth.Principal{UserID: 7, Role: auth.RoleCustomer}, "").
 					Return(nil)
 			},
 			wantStatus: http.StatusNoContent,
@@ -250,30 +361,94 @@ func TestOrderHandler_UpdateOrderStatus(t *testing.T) {
 		{
 			name:           "invalid id",
 			id:             "abc",
+			userID:         uint(7),
 			body:           map[string]interface{}{"status": models.StatusDelivered},
 			mockSetup:      func(m *mocks.MockOrderService) {},
 			wantStatus:     http.StatusBadRequest,
 			wantErrContain: "invalid order id",
 		},
+		{
+			name:           "missing userID",
+			id:             "1",
+			userID:         nil,
+			body:           map[string]interface{}{"status": models.StatusDelivered},
+			mockSetup:      func(m *mocks.MockOrderService) {},
+			wantStatus:     http.StatusUnauthorized,
+			wantErrContain: "userID not found",
+		},
 		{
 			name:           "invalid body",
 			id:             "1",
+			userID:         uint(7),
 			body:           "invalid-json",
 			mockSetup:      func(m *mocks.MockOrderService) {},
 			wantStatus:     http.StatusBadRequest,
 			wantErrContain: "invalid character",
 		},
 		{
-			name: "service error",
-			id:   "1",
-			body: map[string]interface{}{"status": models.StatusDelivered},
+			name:   "unknown status",
+			id:     "1",
+			userID: uint(7),
+			body:   map[string]interface{}{"status": "SHIPPED"},
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					UpdateOrderStatus("1", models.OrderStatus("SHIPPED"), auth.Principal{UserID: 7, Role: auth.RoleCustomer}, "").
+					Return(service.ErrInvalidStatus)
+			},
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid order status",
+		},
+		{
+			name:   "illegal transition",
+			id:     "1",
+			userID: uint(7),
+			body:   map[string]interface{}{"status": models.StatusPending},
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					UpdateOrderStatus("1", models.StatusDelivered).
+					UpdateOrderStatus("1", models.StatusPending, auth.Principal{UserID: 7, Role: auth.RoleCustomer}, "").
+					Return(service.ErrInvalidTransition)
+			},
+			wantStatus:     http.StatusConflict,
+			wantErrContain: "invalid order status transition",
+		},
+		{
+			name:   "transition not permitted for role",
+			id:     "1",
+			userID: uint(7),
+			body:   map[string]interface{}{"status": models.StatusDelivered},
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					UpdateOrderStatus("1", models.StatusDelivered, auth.Principal{UserID: 7, Role: auth.RoleCustomer}, "").
+					Return(service.ErrForbiddenTransition)
+			},
+			wantStatus:     http.StatusForbidden,
+			wantErrContain: "order status change not permitted",
+		},
+		{
+			name:   "order of another user",
+			id:     "2",
+			userID: uint(7),
+			body:   map[string]interface{}{"status": models.StatusCancelled},
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					UpdateOrderStatus("2", models.StatusCancelled, auth.Principal{UserID: 7, Role: auth.RoleCustomer}, "").
+					Return(service.ErrOrderNotFound)
+			},
+			wantStatus:     http.StatusNotFound,
+			wantErrContain: "order not found",
+		},
+		{
+			name:   "service error",
+			id:     "1",
+			userID: uint(7),
+			body:   map[string]interface{}{"status": models.StatusDelivered},
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					UpdateOrderStatus("1", models.StatusDelivered, auth.Principal{UserID: 7, Role: auth.RoleCustomer}, "").
 					Return(errors.New("update error"))
 			},
 			wantStatus:     http.StatusInternalServerError,
-			wantErrContain: "update error",
+			wantErrContain: "internal_error",
 		},
 	}
 	for _, tt := range tests {
@@ -289,7 +464,10 @@ func TestOrderHandler_UpdateOrderStatus(t *testing.T) {
 			default:
 				bodyBytes, _ = json.Marshal(tt.body)
 			}
-			req := httptest.NewRequest("PUT", "/orders/"+tt.id+"/status", bytes.NewReader(bodyBytes))
+			req := httptest.NewRequest("PATCH", "/orders/"+tt.id+"/status", bytes.NewReader(bodyBytes))
+			if tt.userID != nil {
+				req = req.WithContext(withUserID(req.Context(), tt.userID.(uint)))
+			}
 			rr := httptest.NewRecorder()
 			h := NewOrderHandler(mockSvc)
 			vars := map[string]string{"id": tt.id}
@@ -303,6 +481,254 @@ func TestOrderHandler_UpdateOrderStatus(t *testing.T) {
 	}
 }
 
+func TestOrderHandler_CancelOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	paymentID := "pay_1"
+	tests := []struct {
+		name           string
+		id             string
+		userID         interface{}
+		body           string
+		mockSetup      func(m *mocks.MockOrderService)
+		wantStatus     int
+		wantErrContain string
+	}{
+		{
+			name:   "success with reason",
+			id:     "1",
+			userID: uint(7),
+			body:   `{"reason": "changed my mind"}`,
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					CancelOrder("1", uint(7), "changed my mind").
+					Return(&models.Order{ID: 1, Status: models.StatusCancelled, PaymentID: &paymentID, RefundStatus: models.RefundStatusRefunded}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "success without body",
+			id:     "1",
+			userID: uint(7),
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					CancelOrder("1", uint(7), "").
+					Return(&models.Order{ID: 1, Status: models.StatusCancelled}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid id",
+			id:             "abc",
+			userID:         uint(7),
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid order id",
+		},
+		{
+			name:           "missing userID",
+			id:             "1",
+			wantStatus:     http.StatusUnauthorized,
+			wantErrContain: "userID not found",
+		},
+		{
+			name:           "invalid body",
+			id:             "1",
+			userID:         uint(7),
+			body:           "{",
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid request body",
+		},
+		{
+			name:   "not found or not owner",
+			id:     "1",
+			userID: uint(7),
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().CancelOrder("1", uint(7), "").Return(nil, service.ErrOrderNotFound)
+			},
+			wantStatus:     http.StatusNotFound,
+			wantErrContain: "order not found",
+		},
+		{
+			name:   "not cancellable",
+			id:     "1",
+			userID: uint(7),
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().CancelOrder("1", uint(7), "").Return(nil, service.ErrInvalidTransition)
+			},
+			wantStatus:     http.StatusConflict,
+			wantErrContain: "invalid order status transition",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := mocks.NewMockOrderService(ctrl)
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockSvc)
+			}
+			req := httptest.NewRequest("POST", "/orders/"+tt.id+"/cancel", bytes.NewReader([]byte(tt.body)))
+			if tt.userID != nil {
+				req = req.WithContext(withUserID(req.Context(), tt.userID.(uint)))
+			}
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			rr := httptest.NewRecorder()
+			NewOrderHandler(mockSvc).CancelOrder(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantErrContain != "" {
+				assert.Contains(t, rr.Body.String(), tt.wantErrContain)
+			}
+			if rr.Code == http.StatusOK {
+				var order map[string]interface{}
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&order))
+				assert.Equal(t, string(models.StatusCancelled), order["status"])
+			}
+		})
+	}
+}
+
+func TestOrderHandler_RetryPayment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name           string
+		id             string
+		userID         interface{}
+		mockSetup      func(m *mocks.MockOrderService)
+		wantStatus     int
+		wantErrContain string
+	}{
+		{
+			name:   "success",
+			id:     "1",
+			userID: uint(7),
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().RetryPayment("1", uint(7)).Return(&models.Order{ID: 1, Status: models.StatusPaid}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid id",
+			id:             "abc",
+			userID:         uint(7),
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid order id",
+		},
+		{
+			name:           "missing userID",
+			id:             "1",
+			wantStatus:     http.StatusUnauthorized,
+			wantErrContain: "userID not found",
+		},
+		{
+			name:   "payment did not fail",
+			id:     "1",
+			userID: uint(7),
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().RetryPayment("1", uint(7)).Return(nil, service.ErrPaymentNotRetryable)
+			},
+			wantStatus:     http.StatusConflict,
+			wantErrContain: "payment_not_retryable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := mocks.NewMockOrderService(ctrl)
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockSvc)
+			}
+			req := httptest.NewRequest("POST", "/orders/"+tt.id+"/pay", nil)
+			if tt.userID != nil {
+				req = req.WithContext(withUserID(req.Context(), tt.userID.(uint)))
+			}
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			rr := httptest.NewRecorder()
+			NewOrderHandler(mockSvc).RetryPayment(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantErrContain != "" {
+				assert.Contains(t, rr.Body.String(), tt.wantErrContain)
+			}
+		})
+	}
+}
+
+func TestOrderHandler_AssignCourier(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	restaurant := auth.Principal{UserID: 8, Role: auth.RoleRestaurant}
+	courierID := uint(9)
+	tests := []struct {
+		name           string
+		id             string
+		body           string
+		mockSetup      func(m *mocks.MockOrderService)
+		wantStatus     int
+		wantErrContain string
+	}{
+		{
+			name: "success",
+			id:   "1",
+			body: `{"courier_id": 9}`,
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					AssignCourier("1", uint(9), restaurant).
+					Return(&models.Order{ID: 1, Status: models.StatusPreparing, RestaurantID: 8, CourierID: &courierID}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid body",
+			id:             "1",
+			body:           "{",
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid request body",
+		},
+		{
+			name: "order of another restaurant",
+			id:   "1",
+			body: `{"courier_id": 9}`,
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().AssignCourier("1", uint(9), restaurant).Return(nil, service.ErrOrderNotFound)
+			},
+			wantStatus:     http.StatusNotFound,
+			wantErrContain: "order not found",
+		},
+		{
+			name: "unpaid order",
+			id:   "1",
+			body: `{"courier_id": 9}`,
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().AssignCourier("1", uint(9), restaurant).Return(nil, service.ErrCourierNotAllowed)
+			},
+			wantStatus:     http.StatusConflict,
+			wantErrContain: "courier_not_allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := mocks.NewMockOrderService(ctrl)
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockSvc)
+			}
+			req := httptest.NewRequest("POST", "/orders/"+tt.id+"/courier", bytes.NewReader([]byte(tt.body)))
+			req = req.WithContext(auth.WithPrincipal(req.Context(), restaurant))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			rr := httptest.NewRecorder()
+			NewOrderHandler(mockSvc).AssignCourier(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantErrContain != "" {
+				assert.Contains(t, rr.Body.String(), tt.wantErrContain)
+			}
+			if rr.Code == http.StatusOK {
+				var order map[string]interface{}
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&order))
+				assert.Equal(t, float64(9), order["courier_id"])
+			}
+		})
+	}
+}
+
 func TestOrderHandler_ProcessPayment(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -318,14 +744,26 @@ func TestOrderHandler_ProcessPayment(t *testing.T) {
 		{
 			name:    "success",
 			orderID: "1",
-			body:    map[string]interface{}{"payment_id": "pay_123"},
+			body:    map[string]interface{}{"payment_id": "pay_123", "status": "completed"},
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					ProcessPayment("1", "pay_123").
+					ProcessPayment("1", "pay_123", "completed").
 					Return(nil)
 			},
 			wantStatus: http.StatusNoContent,
 		},
+		{
+			name:    "unknown payment status",
+			orderID: "1",
+			body:    map[string]interface{}{"payment_id": "pay_123", "status": "pending"},
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					ProcessPayment("1", "pay_123", "pending").
+					Return(fmt.Errorf("%w: unknown payment status %q", service.ErrInvalidPayment, "pending"))
+			},
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid_payment",
+		},
 		{
 			name:           "invalid order id",
 			orderID:        "abc",
@@ -345,14 +783,14 @@ func TestOrderHandler_ProcessPayment(t *testing.T) {
 		{
 			name:    "service error",
 			orderID: "1",
-			body:    map[string]interface{}{"payment_id": "pay_123"},
+			body:    map[string]interface{}{"payment_id": "pay_123", "status": "completed"},
 			mockSetup: func(m *mocks.MockOrderService) {
 				m.EXPECT().
-					ProcessPayment("1", "pay_123").
+					ProcessPayment("1", "pay_123", "completed").
 					Return(errors.New("payment error"))
 			},
 			wantStatus:     http.StatusInternalServerError,
-			wantErrContain: "payment error",
+			wantErrContain: "internal_error",
 		},
 	}
 	for _, tt := range tests {
@@ -381,3 +819,111 @@ func TestOrderHandler_ProcessPayment(t *testing.T) {
 		})
 	}
 }
+
+func TestOrderHandler_GetOrderStatusHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name           string
+		id             string
+		userID         interface{}
+		mockSetup      func(m *mocks.MockOrderService)
+		wantStatus     int
+		wantErrContain string
+		wantEvents     int
+	}{
+		{
+			name:   "success",
+			id:     "1",
+			userID: uint(1),
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					GetOrderStatusHistory("1", auth.Principal{UserID: 1, Role: auth.RoleCustomer}).
+					Return([]models.OrderStatusEvent{
+						{OrderID: 1, ToStatus: models.StatusPending, ActorID: 1},
+						{OrderID: 1, FromStatus: models.StatusPending, ToStatus: models.StatusPaid},
+					}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantEvents: 2,
+		},
+		{
+			name:           "invalid id",
+			id:             "abc",
+			userID:         uint(1),
+			mockSetup:      func(m *mocks.MockOrderService) {},
+			wantStatus:     http.StatusBadRequest,
+			wantErrContain: "invalid order id",
+		},
+		{
+			name:           "missing userID",
+			id:             "1",
+			userID:         nil,
+			mockSetup:      func(m *mocks.MockOrderService) {},
+			wantStatus:     http.StatusUnauthorized,
+			wantErrContain: "userID not found",
+		},
+		{
+			name:   "not found or not owned",
+			id:     "999",
+			userID: uint(1),
+			mockSetup: func(m *mocks.MockOrderService) {
+				m.EXPECT().
+					GetOrderStatusHistory("999", auth.Principal{UserID: 1, Role: auth.RoleCustomer}).
+					Return(nil, service.ErrOrderNotFound)
+			},
+			wantStatus:     http.StatusNotFound,
+			wantErrContain: "order not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := mocks.NewMockOrderService(ctrl)
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockSvc)
+			}
+			req := httptest.NewRequest("GET", "/orders/"+tt.id+"/history", nil)
+			if tt.userID != nil {
+				req = req.WithContext(withUserID(req.Context(), tt.userID.(uint)))
+			}
+			rr := httptest.NewRecorder()
+			h := NewOrderHandler(mockSvc)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			h.GetOrderStatusHistory(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantErrContain != "" {
+				assert.Contains(t, rr.Body.String(), tt.wantErrContain)
+			}
+			if tt.wantEvents > 0 {
+				var events []models.OrderStatusEvent
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &events))
+				assert.Len(t, events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestOrderHandler_ProblemResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockService := mocks.NewMockOrderService(ctrl)
+	h := NewOrderHandler(mockService)
+
+	caller := auth.Principal{UserID: 1, Role: auth.RoleCustomer}
+	mockService.EXPECT().GetOrder("7", caller).Return(nil, service.ErrOrderNotFound)
+
+	req := httptest.NewRequest("GET", "/orders/7", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	ctx := problem.WithRequestID(auth.WithPrincipal(req.Context(), caller), "req-7")
+	rr := httptest.NewRecorder()
+	h.GetOrderById(rr, req.WithContext(ctx))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	var got problem.Details
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+	assert.Equal(t, "order_not_found", got.Code)
+	assert.Equal(t, "req-7", got.RequestID)
+	assert.Equal(t, "/orders/7", got.Instance)
+}
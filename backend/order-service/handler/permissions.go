@@ -0,0 +1,29 @@
+package handler
+
+import "zamato/pkg/auth"
+
+// Permissions required by the order routes.
+const (
+	PermCreateOrder  auth.Permission = "orders:create"
+	PermReadOrders   auth.Permission = "orders:read"
+	PermUpdateStatus auth.Permission = "orders:update_status"
+	PermCancelOrder  auth.Permission = "orders:cancel"
+	// PermPayOrder lets customers pay again for orders whose payment failed.
+	PermPayOrder auth.Permission = "orders:pay"
+	// PermAssignCourier lets restaurants hand their orders to couriers.
+	PermAssignCourier auth.Permission = "orders:assign_courier"
+	// PermConfirmPayment lets payment-service report payment outcomes.
+	PermConfirmPayment auth.Permission = "orders:confirm_payment"
+)
+
+// Policy grants the order permissions to roles. Which orders a role may
+// read, and which statuses it may set, is narrowed further by the order
+// service.
+var Policy = auth.Policy{
+	auth.RoleCustomer:   {PermCreateOrder, PermReadOrders, PermCancelOrder, PermPayOrder},
+	auth.RoleRestaurant: {PermReadOrders, PermUpdateStatus, PermAssignCourier},
+	auth.RoleCourier:    {PermReadOrders, PermUpdateStatus},
+	auth.RoleSupport:    {PermReadOrders},
+	auth.RoleAdmin:      {PermReadOrders, PermUpdateStatus, PermAssignCourier},
+	auth.RoleService:    {PermConfirmPayment},
+}
@@ -0,0 +1,101 @@
+// Package idgen generates order IDs.
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Generator hands out unique order IDs.
+type Generator interface {
+	NextID() (uint64, error)
+}
+
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+
+	// MaxNode is the largest node ID a Snowflake accepts.
+	MaxNode     = 1<<nodeBits - 1
+	maxSequence = 1<<sequenceBits - 1
+
+	// maxClockRollback is how far the clock may move back before NextID
+	// fails instead of waiting for it to catch up.
+	maxClockRollback = time.Second
+)
+
+// Epoch is the start of Snowflake time. Every ID generated more than a second
+// after it is larger than any 32-bit ID, so IDs from before Snowflake cannot
+// collide with new ones.
+var Epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var ErrClockMovedBackwards = errors.New("clock moved backwards")
+
+// Snowflake generates time-ordered 63-bit IDs: 41 bits of milliseconds since
+// Epoch, 10 bits of node ID and a 12-bit sequence within the millisecond.
+// Every instance sharing a database needs its own node ID.
+type Snowflake struct {
+	mu       sync.Mutex
+	node     uint64
+	lastMs   int64
+	sequence uint64
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func NewSnowflake(node int) (*Snowflake, error) {
+	if node < 0 || node > MaxNode {
+		return nil, fmt.Errorf("snowflake node %d out of range 0-%d", node, MaxNode)
+	}
+	return &Snowflake{node: uint64(node), now: time.Now, sleep: time.Sleep}, nil
+}
+
+// NextID returns the next ID. When 4096 IDs were handed out within one
+// millisecond it waits for the next one; a clock that moved back by up to a
+// second is waited out as well.
+func (s *Snowflake) NextID() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := s.millis()
+	if ms < s.lastMs {
+		behind := time.Duration(s.lastMs-ms) * time.Millisecond
+		if behind > maxClockRollback {
+			return 0, fmt.Errorf("%w by %s", ErrClockMovedBackwards, behind)
+		}
+		s.sleep(behind)
+		ms = s.waitAfter(s.lastMs - 1)
+	}
+	if ms == s.lastMs {
+		s.sequence = (s.sequence + 1) & maxSequence
+		if s.sequence == 0 {
+			ms = s.waitAfter(s.lastMs)
+		}
+	} else {
+		s.sequence = 0
+	}
+	s.lastMs = ms
+	return uint64(ms)<<(nodeBits+sequenceBits) | s.node<<sequenceBits | s.sequence, nil
+}
+
+// waitAfter waits until the clock is past ms and returns the new time.
+func (s *Snowflake) waitAfter(ms int64) int64 {
+	now := s.millis()
+	for now <= ms {
+		s.sleep(time.Duration(ms-now+1) * time.Millisecond)
+		now = s.millis()
+	}
+	return now
+}
+
+func (s *Snowflake) millis() int64 {
+	return s.now().Sub(Epoch).Milliseconds()
+}
+
+// Time returns when the Snowflake ID id was generated.
+func Time(id uint64) time.Time {
+	return Epoch.Add(time.Duration(id>>(nodeBits+sequenceBits)) * time.Millisecond)
+}
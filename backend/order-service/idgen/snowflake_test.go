@@ -0,0 +1,118 @@
+package idgen
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock that only moves when told to, including while the
+// generator sleeps.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+func newTestSnowflake(t *testing.T, node int, clock *fakeClock) *Snowflake {
+	s, err := NewSnowflake(node)
+	assert.NoError(t, err)
+	s.now = clock.Now
+	s.sleep = clock.Sleep
+	return s
+}
+
+func TestNewSnowflake_NodeRange(t *testing.T) {
+	for _, node := range []int{0, MaxNode} {
+		_, err := NewSnowflake(node)
+		assert.NoError(t, err)
+	}
+	for _, node := range []int{-1, MaxNode + 1} {
+		_, err := NewSnowflake(node)
+		assert.Error(t, err)
+	}
+}
+
+func TestSnowflake_Layout(t *testing.T) {
+	clock := &fakeClock{now: Epoch.Add(2 * time.Second)}
+	s := newTestSnowflake(t, 5, clock)
+
+	first, err := s.NextID()
+	assert.NoError(t, err)
+	second, err := s.NextID()
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(2000)<<22|5<<12, first)
+	assert.Equal(t, first+1, second)
+	assert.Equal(t, Epoch.Add(2*time.Second), Time(first))
+	assert.Greater(t, first, uint64(math.MaxUint32), "new IDs must not overlap 32-bit legacy IDs")
+}
+
+func TestSnowflake_SequenceOverflowWaitsForNextMillisecond(t *testing.T) {
+	clock := &fakeClock{now: Epoch.Add(time.Hour)}
+	s := newTestSnowflake(t, 1, clock)
+
+	var last uint64
+	for i := 0; i <= maxSequence+1; i++ {
+		id, err := s.NextID()
+		assert.NoError(t, err)
+		assert.Greater(t, id, last)
+		last = id
+	}
+	assert.Equal(t, []time.Duration{time.Millisecond}, clock.sleeps)
+	assert.Equal(t, Epoch.Add(time.Hour+time.Millisecond), Time(last))
+}
+
+func TestSnowflake_ClockRollback(t *testing.T) {
+	clock := &fakeClock{now: Epoch.Add(time.Hour)}
+	s := newTestSnowflake(t, 1, clock)
+	before, err := s.NextID()
+	assert.NoError(t, err)
+
+	clock.now = clock.now.Add(-10 * time.Millisecond)
+	after, err := s.NextID()
+	assert.NoError(t, err)
+	assert.Greater(t, after, before)
+
+	clock.now = clock.now.Add(-time.Minute)
+	_, err = s.NextID()
+	assert.ErrorIs(t, err, ErrClockMovedBackwards)
+}
+
+func TestSnowflake_ConcurrentIDsAreUnique(t *testing.T) {
+	s, err := NewSnowflake(3)
+	assert.NoError(t, err)
+
+	const workers, perWorker = 8, 2000
+	ids := make(chan uint64, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id, err := s.NextID()
+				assert.NoError(t, err)
+				ids <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[uint64]bool)
+	for id := range ids {
+		assert.False(t, seen[id], "duplicate id %d", id)
+		seen[id] = true
+	}
+	assert.Len(t, seen, workers*perWorker)
+}
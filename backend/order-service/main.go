@@ -1,14 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"order-service/config"
+	"order-service/external"
 	"order-service/handler"
+	"order-service/idgen"
 	"order-service/middleware"
 	"order-service/models"
+	"order-service/outbox"
 	"order-service/repository"
 	"order-service/service"
-	"os"
+	"os/signal"
+	"syscall"
+	"zamato/pkg/auth"
+	"zamato/pkg/idempotency"
+	"zamato/pkg/problem"
+	"zamato/pkg/schema"
+	"zamato/pkg/server"
 
 	"github.com/gorilla/mux"
 	"gorm.io/driver/postgres"
@@ -16,64 +27,126 @@ import (
 )
 
 func main() {
-	// Database connection
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		dsn = "host=localhost user=glassbreak password=glassbreak dbname=glassbreak port=5432 sslmode=disable"
-		log.Println("DATABASE_URL not set, using glassbreak fallback config")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Database connection
+	db, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
 	// Auto migrate models
-	if err := db.AutoMigrate(&models.Order{}, &models.OrderItem{}); err != nil {
+	if err := db.AutoMigrate(&models.Order{}, &models.OrderItem{}, &models.OrderStatusEvent{}, &models.OutboxEvent{}, &idempotency.Record{}, &schema.Migration{}); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
+	if err := repository.MigrateLegacyAmounts(db, cfg.DefaultCurrency); err != nil {
+		log.Fatal("Failed to migrate amounts:", err)
+	}
+	if err := schema.Record(db, repository.SchemaVersion); err != nil {
+		log.Fatal("Failed to record schema version:", err)
+	}
+
+	verifier, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		log.Fatal("Failed to configure JWT verification:", err)
+	}
 
 	// Initialize layers
 	orderRepo := repository.NewOrderRepository(db)
-	orderService := service.NewOrderService(orderRepo)
+	serviceTokens, err := auth.NewServiceTokens(cfg.Auth)
+	if err != nil {
+		log.Fatal("Failed to configure service tokens:", err)
+	}
+	paymentClient := external.NewPaymentClient(cfg.Payment, serviceTokens)
+	var menu external.MenuCatalog
+	switch cfg.Menu.Source {
+	case "http":
+		menu = external.NewHTTPMenuCatalog(cfg.Menu.ServiceURL, cfg.Menu.Timeout)
+	case "file":
+		menu, err = external.LoadMenuCatalogFile(cfg.Menu.File)
+		if err != nil {
+			log.Fatal("Failed to load menu catalog:", err)
+		}
+	default:
+		log.Fatalf("Unknown MENU_CATALOG %q", cfg.Menu.Source)
+	}
+	orderIDs, err := idgen.NewSnowflake(cfg.OrderIDNode)
+	if err != nil {
+		log.Fatal("Invalid ORDER_ID_NODE:", err)
+	}
+	orderService := service.NewOrderService(orderRepo, paymentClient, menu, orderIDs)
 	orderHandler := handler.NewOrderHandler(orderService)
 
+	// Outbox relay
+	var broker outbox.Broker
+	switch cfg.Outbox.Broker {
+	case "memory":
+		broker = outbox.NewMemoryBroker()
+	case "file":
+		broker = outbox.NewFileBroker(cfg.Outbox.FilePath)
+	default:
+		log.Fatalf("Unknown OUTBOX_BROKER %q", cfg.Outbox.Broker)
+	}
+	relay := outbox.NewRelay(repository.NewOutboxRepository(db), broker, cfg.Outbox.PollInterval, cfg.Outbox.BatchSize)
+	workers := server.NewWorkers()
+	workers.Go(relay.Run)
+
 	// Setup router
 	r := mux.NewRouter()
+	r.NotFoundHandler = problem.Handler(problem.ErrNotFound)
+	r.MethodNotAllowedHandler = problem.Handler(problem.ErrMethodNotAllowed)
 
 	// API versioning
 	api := r.PathPrefix("/api/v1").Subrouter()
 
 	// Middleware
-	api.Use(middleware.AuthMiddleware)
+	guard := auth.NewRouteGuard(handler.Policy)
+	api.Use(auth.Middleware(verifier))
 	api.Use(middleware.LoggingMiddleware)
+	api.Use(guard.Middleware)
 
-	// Order routes
-	api.HandleFunc("/checkout", orderHandler.Checkout).Methods("POST")
-	api.HandleFunc("/orders", orderHandler.GetOrderHistory).Methods("GET")
-	api.HandleFunc("/orders/{id}", orderHandler.GetOrderById).Methods("GET")
-	api.HandleFunc("/orders/{id}/status", orderHandler.UpdateOrderStatus).Methods("PATCH")
+	// Order routes, each with the permission it requires
+	idempotent := idempotency.Middleware(idempotency.NewRepository(db), idempotency.Config{
+		TTL:         cfg.IdempotencyTTL,
+		LockTimeout: cfg.IdempotencyLockTimeout,
+		Scope:       middleware.IdempotencyScope,
+	})
+	guard.Require(api.Handle("/checkout", idempotent(http.HandlerFunc(orderHandler.Checkout))).Methods("POST"), handler.PermCreateOrder)
+	guard.Require(api.HandleFunc("/orders", orderHandler.GetOrderHistory).Methods("GET"), handler.PermReadOrders)
+	guard.Require(api.HandleFunc("/orders/{id}", orderHandler.GetOrderById).Methods("GET"), handler.PermReadOrders)
+	guard.Require(api.HandleFunc("/orders/{id}/status", orderHandler.UpdateOrderStatus).Methods("PATCH"), handler.PermUpdateStatus)
+	guard.Require(api.HandleFunc("/orders/{id}/history", orderHandler.GetOrderStatusHistory).Methods("GET"), handler.PermReadOrders)
+	guard.Require(api.HandleFunc("/orders/{id}/cancel", orderHandler.CancelOrder).Methods("POST"), handler.PermCancelOrder)
+	guard.Require(api.Handle("/orders/{id}/pay", idempotent(http.HandlerFunc(orderHandler.RetryPayment))).Methods("POST"), handler.PermPayOrder)
+	guard.Require(api.HandleFunc("/orders/{id}/courier", orderHandler.AssignCourier).Methods("POST"), handler.PermAssignCourier)
+	guard.Require(api.HandleFunc("/orders/{orderId}/payment", orderHandler.ProcessPayment).Methods("POST"), handler.PermConfirmPayment)
 
-	// Health check
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
-
-	// Server configuration
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: r,
-	}
+	// Health checks: /livez while the process answers, /readyz while it
+	// serves and its dependencies work. /health is the old name of /readyz.
+	var readiness server.Readiness
+	health := server.NewHealth(&readiness, cfg.Server.CheckTimeout)
+	health.Add("database", schema.Ping(db))
+	health.Add("schema", schema.Check(db, repository.SchemaVersion))
+	health.Add("payment-service", server.HTTPCheck(http.DefaultClient, cfg.Payment.BaseURL+"/livez"))
+	r.Handle("/livez", health.Live()).Methods("GET")
+	r.Handle("/readyz", health.Ready()).Methods("GET")
+	r.Handle("/health", health.Ready()).Methods("GET")
 
-	// Start server
-	log.Printf("Starting order-service on port %s", port)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal("Server failed to start order-service:", err)
+	// Serve until SIGINT or SIGTERM, then drain before stopping the workers
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	srv := server.New(":"+cfg.Port, problem.RequestIDMiddleware(r), cfg.Server)
+	log.Printf("Starting order-service on port %s", cfg.Port)
+	runErr := server.Run(ctx, srv, cfg.Server, &readiness, func(ctx context.Context) {
+		if err := workers.Stop(ctx); err != nil {
+			log.Printf("Background workers did not stop: %v", err)
+		}
+	})
+	if runErr != nil {
+		log.Fatal("order-service stopped with an error:", runErr)
 	}
+	log.Println("order-service stopped")
 }
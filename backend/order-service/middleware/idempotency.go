@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"zamato/pkg/auth"
+)
+
+// IdempotencyScope namespaces Idempotency-Key records by route and, when
+// known, by user so that one caller can never replay another caller's
+// response.
+func IdempotencyScope(r *http.Request) string {
+	scope := r.Method + " " + r.URL.Path
+	if userID, ok := auth.UserIDFromContext(r.Context()); ok {
+		scope += " user:" + strconv.FormatUint(uint64(userID), 10)
+	}
+	return scope
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"zamato/pkg/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyScope(t *testing.T) {
+	req := httptest.NewRequest("POST", "/checkout", nil)
+	assert.Equal(t, "POST /checkout", IdempotencyScope(req))
+
+	req = req.WithContext(auth.WithUserID(req.Context(), 7))
+	assert.Equal(t, "POST /checkout user:7", IdempotencyScope(req))
+}
@@ -4,12 +4,14 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"zamato/pkg/problem"
 )
 
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
+		log.Printf("%s %s %s request_id=%s", r.Method, r.RequestURI, time.Since(start), problem.RequestID(r.Context()))
 	})
 }
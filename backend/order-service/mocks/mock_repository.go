@@ -5,6 +5,7 @@ package mocks
 
 import (
 	"order-service/models"
+	"order-service/repository"
 	"reflect"
 
 	"github.com/golang/mock/gomock"
@@ -54,39 +55,77 @@ func (mr *MockOrderRepositoryMockRecorder) GetByID(id interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockOrderRepository)(nil).GetByID), id)
 }
 
-func (m *MockOrderRepository) GetUserOrders(userID uint) ([]models.Order, error) {
+func (m *MockOrderRepository) FindUserOrders(query repository.OrderQuery) ([]models.Order, *repository.OrderCursor, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserOrders", userID)
+	ret := m.ctrl.Call(m, "FindUserOrders", query)
 	ret0, _ := ret[0].([]models.Order)
+	ret1, _ := ret[1].(*repository.OrderCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (mr *MockOrderRepositoryMockRecorder) FindUserOrders(query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserOrders", reflect.TypeOf((*MockOrderRepository)(nil).FindUserOrders), query)
+}
+
+func (m *MockOrderRepository) UpdateStatus(event *models.OrderStatusEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateStatus", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (mr *MockOrderRepositoryMockRecorder) UpdateStatus(event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockOrderRepository)(nil).UpdateStatus), event)
+}
+
+func (m *MockOrderRepository) GetStatusHistory(id string) ([]models.OrderStatusEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStatusHistory", id)
+	ret0, _ := ret[0].([]models.OrderStatusEvent)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (mr *MockOrderRepositoryMockRecorder) GetUserOrders(userID interface{}) *gomock.Call {
+func (mr *MockOrderRepositoryMockRecorder) GetStatusHistory(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatusHistory", reflect.TypeOf((*MockOrderRepository)(nil).GetStatusHistory), id)
+}
+
+func (m *MockOrderRepository) UpdatePaymentID(id string, paymentID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePaymentID", id, paymentID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (mr *MockOrderRepositoryMockRecorder) UpdatePaymentID(id, paymentID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserOrders", reflect.TypeOf((*MockOrderRepository)(nil).GetUserOrders), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePaymentID", reflect.TypeOf((*MockOrderRepository)(nil).UpdatePaymentID), id, paymentID)
 }
 
-func (m *MockOrderRepository) UpdateStatus(id string, status models.OrderStatus) error { // Updated to use string
+func (m *MockOrderRepository) UpdateCourier(id string, courierID uint) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateStatus", id, status)
+	ret := m.ctrl.Call(m, "UpdateCourier", id, courierID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (mr *MockOrderRepositoryMockRecorder) UpdateStatus(id, status interface{}) *gomock.Call {
+func (mr *MockOrderRepositoryMockRecorder) UpdateCourier(id, courierID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockOrderRepository)(nil).UpdateStatus), id, status)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCourier", reflect.TypeOf((*MockOrderRepository)(nil).UpdateCourier), id, courierID)
 }
 
-func (m *MockOrderRepository) UpdatePayment(orderID uint, paymentID string) error {
+func (m *MockOrderRepository) UpdateRefund(id string, status models.RefundStatus, refundID *string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdatePayment", orderID, paymentID)
+	ret := m.ctrl.Call(m, "UpdateRefund", id, status, refundID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (mr *MockOrderRepositoryMockRecorder) UpdatePayment(orderID, paymentID interface{}) *gomock.Call {
+func (mr *MockOrderRepositoryMockRecorder) UpdateRefund(id, status, refundID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePayment", reflect.TypeOf((*MockOrderRepository)(nil).UpdatePayment), orderID, paymentID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRefund", reflect.TypeOf((*MockOrderRepository)(nil).UpdateRefund), id, status, refundID)
 }
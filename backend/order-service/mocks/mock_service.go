@@ -4,8 +4,10 @@
 package mocks
 
 import (
+	"order-service/contracts"
 	"order-service/models"
 	"reflect"
+	"zamato/pkg/auth"
 
 	"github.com/golang/mock/gomock"
 )
@@ -29,7 +31,7 @@ func (m *MockOrderService) EXPECT() *MockOrderServiceMockRecorder {
 	return m.recorder
 }
 
-func (m *MockOrderService) CreateOrder(userID uint, items []models.OrderItem, address string) (*models.Order, error) {
+func (m *MockOrderService) CreateOrder(userID uint, items []contracts.CheckoutItem, address string) (*models.Order, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "CreateOrder", userID, items, address)
 	ret0, _ := ret[0].(*models.Order)
@@ -42,52 +44,104 @@ func (mr *MockOrderServiceMockRecorder) CreateOrder(userID, items, address inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrder", reflect.TypeOf((*MockOrderService)(nil).CreateOrder), userID, items, address)
 }
 
-func (m *MockOrderService) GetOrderHistory(userID uint) ([]models.Order, error) {
+func (m *MockOrderService) GetOrderHistory(userID uint, query contracts.OrderHistoryQuery) (*contracts.OrderPage, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOrderHistory", userID)
-	ret0, _ := ret[0].([]models.Order)
+	ret := m.ctrl.Call(m, "GetOrderHistory", userID, query)
+	ret0, _ := ret[0].(*contracts.OrderPage)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (mr *MockOrderServiceMockRecorder) GetOrderHistory(userID interface{}) *gomock.Call {
+func (mr *MockOrderServiceMockRecorder) GetOrderHistory(userID, query interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderHistory", reflect.TypeOf((*MockOrderService)(nil).GetOrderHistory), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderHistory", reflect.TypeOf((*MockOrderService)(nil).GetOrderHistory), userID, query)
 }
 
-func (m *MockOrderService) GetOrder(id string) (*models.Order, error) {
+func (m *MockOrderService) GetOrder(id string, caller auth.Principal) (*models.Order, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOrder", id)
+	ret := m.ctrl.Call(m, "GetOrder", id, caller)
 	ret0, _ := ret[0].(*models.Order)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (mr *MockOrderServiceMockRecorder) GetOrder(id interface{}) *gomock.Call {
+func (mr *MockOrderServiceMockRecorder) GetOrder(id, caller interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockOrderService)(nil).GetOrder), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockOrderService)(nil).GetOrder), id, caller)
 }
 
-func (m *MockOrderService) UpdateOrderStatus(id string, status models.OrderStatus) error {
+func (m *MockOrderService) UpdateOrderStatus(id string, status models.OrderStatus, caller auth.Principal, reason string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateOrderStatus", id, status)
+	ret := m.ctrl.Call(m, "UpdateOrderStatus", id, status, caller, reason)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (mr *MockOrderServiceMockRecorder) UpdateOrderStatus(id, status interface{}) *gomock.Call {
+func (mr *MockOrderServiceMockRecorder) UpdateOrderStatus(id, status, caller, reason interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderStatus", reflect.TypeOf((*MockOrderService)(nil).UpdateOrderStatus), id, status)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderStatus", reflect.TypeOf((*MockOrderService)(nil).UpdateOrderStatus), id, status, caller, reason)
 }
 
-func (m *MockOrderService) ProcessPayment(orderID string, paymentID string) error { // Updated to use string for orderID
+func (m *MockOrderService) GetOrderStatusHistory(id string, caller auth.Principal) ([]models.OrderStatusEvent, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ProcessPayment", orderID, paymentID)
+	ret := m.ctrl.Call(m, "GetOrderStatusHistory", id, caller)
+	ret0, _ := ret[0].([]models.OrderStatusEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockOrderServiceMockRecorder) GetOrderStatusHistory(id, caller interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderStatusHistory", reflect.TypeOf((*MockOrderService)(nil).GetOrderStatusHistory), id, caller)
+}
+
+func (m *MockOrderService) ProcessPayment(orderID string, paymentID string, status string) error { // Updated to use string for orderID
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProcessPayment", orderID, paymentID, status)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (mr *MockOrderServiceMockRecorder) ProcessPayment(orderID, paymentID interface{}) *gomock.Call {
+func (mr *MockOrderServiceMockRecorder) ProcessPayment(orderID, paymentID, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessPayment", reflect.TypeOf((*MockOrderService)(nil).ProcessPayment), orderID, paymentID, status)
+}
+
+func (m *MockOrderService) AssignCourier(orderID string, courierID uint, caller auth.Principal) (*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AssignCourier", orderID, courierID, caller)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockOrderServiceMockRecorder) AssignCourier(orderID, courierID, caller interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssignCourier", reflect.TypeOf((*MockOrderService)(nil).AssignCourier), orderID, courierID, caller)
+}
+
+func (m *MockOrderService) CancelOrder(orderID string, userID uint, reason string) (*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelOrder", orderID, userID, reason)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockOrderServiceMockRecorder) CancelOrder(orderID, userID, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelOrder", reflect.TypeOf((*MockOrderService)(nil).CancelOrder), orderID, userID, reason)
+}
+
+func (m *MockOrderService) RetryPayment(orderID string, userID uint) (*models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryPayment", orderID, userID)
+	ret0, _ := ret[0].(*models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockOrderServiceMockRecorder) RetryPayment(orderID, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessPayment", reflect.TypeOf((*MockOrderService)(nil).ProcessPayment), orderID, paymentID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryPayment", reflect.TypeOf((*MockOrderService)(nil).RetryPayment), orderID, userID)
 }
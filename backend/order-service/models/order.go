@@ -2,6 +2,7 @@ package models
 
 import (
 	"time"
+	"zamato/pkg/money"
 
 	"gorm.io/gorm"
 )
@@ -14,26 +15,98 @@ const (
 	StatusPreparing OrderStatus = "PREPARING"
 	StatusDelivered OrderStatus = "DELIVERED"
 	StatusCancelled OrderStatus = "CANCELLED"
+	// StatusPaymentFailed marks an order whose payment was declined or
+	// failed. It is not terminal: a later successful payment still moves the
+	// order to PAID, the customer may pay it again, which moves it back to
+	// PENDING, or cancel it.
+	StatusPaymentFailed OrderStatus = "PAYMENT_FAILED"
 )
 
+// RefundStatus records what happened to the payment of a cancelled order.
+type RefundStatus string
+
+const (
+	// RefundStatusVoided means nothing was charged: the hold on the funds was
+	// released, or the payment never went through.
+	RefundStatusVoided   RefundStatus = "VOIDED"
+	RefundStatusRefunded RefundStatus = "REFUNDED"
+	// RefundStatusFailed means the payment could not be given back yet;
+	// cancelling the order again retries.
+	RefundStatusFailed RefundStatus = "FAILED"
+)
+
+// SystemActor is recorded as the actor of status changes that are not made
+// on behalf of an authenticated user, such as payment confirmations.
+const SystemActor uint = 0
+
+// orderTransitions lists, for every status, the statuses an order may move to
+// next. Statuses missing from the map are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	StatusPending:       {StatusPaid, StatusPaymentFailed, StatusCancelled},
+	StatusPaymentFailed: {StatusPending, StatusPaid, StatusCancelled},
+	StatusPaid:          {StatusPreparing, StatusCancelled},
+	StatusPreparing:     {StatusDelivered},
+}
+
+// IsValid reports whether s is one of the known order statuses.
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case StatusPending, StatusPaid, StatusPreparing, StatusDelivered, StatusCancelled, StatusPaymentFailed:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether an order in status s may move to next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Order is a customer's order. Its ID comes from idgen and is written to JSON
+// as a string, since it exceeds the integers JavaScript can represent.
+// RestaurantID is the restaurant that prepares it and CourierID the courier
+// it was assigned to, if any; both are the user IDs of those accounts.
 type Order struct {
-	ID              uint64      `json:"id" gorm:"primaryKey"`
-	UserID          uint        `json:"user_id" gorm:"index"`
-	OrderItems      []OrderItem `json:"order_items" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	TotalAmount     float64     `json:"total_amount"`
-	Status          OrderStatus `json:"status" gorm:"type:varchar(20);index"`
-	PaymentID       *string     `json:"payment_id"`
-	DeliveryAddress string      `json:"delivery_address"`
-	CreatedAt       time.Time   `json:"created_at"`
-	UpdatedAt       time.Time   `json:"updated_at"`
-	DeletedAt       *time.Time  `json:"deleted_at,omitempty" gorm:"index"`
+	ID              uint64       `json:"id,string" gorm:"primaryKey;index:idx_orders_user_created,priority:3"`
+	UserID          uint         `json:"user_id" gorm:"index;index:idx_orders_user_created,priority:1"`
+	RestaurantID    uint         `json:"restaurant_id" gorm:"index"`
+	CourierID       *uint        `json:"courier_id,omitempty" gorm:"index"`
+	OrderItems      []OrderItem  `json:"order_items" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	TotalAmount     money.Money  `json:"total_amount" gorm:"embedded;embeddedPrefix:total_"`
+	Status          OrderStatus  `json:"status" gorm:"type:varchar(20);index"`
+	PaymentID       *string      `json:"payment_id"`
+	RefundStatus    RefundStatus `json:"refund_status,omitempty" gorm:"type:varchar(20)"`
+	RefundID        *string      `json:"refund_id,omitempty"`
+	DeliveryAddress string       `json:"delivery_address"`
+	StatusUpdatedBy uint         `json:"status_updated_by"`
+	StatusUpdatedAt *time.Time   `json:"status_updated_at,omitempty"`
+	CreatedAt       time.Time    `json:"created_at" gorm:"index:idx_orders_user_created,priority:2"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	DeletedAt       *time.Time   `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 type OrderItem struct {
 	gorm.Model
-	OrderID    uint    `json:"order_id" gorm:"index"`
-	MenuItemID uint    `json:"menu_item_id"`
-	Quantity   int     `json:"quantity"`
-	Price      float64 `json:"price"`
-	Name       string  `json:"name"`
+	OrderID    uint        `json:"order_id,string" gorm:"index"`
+	MenuItemID uint        `json:"menu_item_id"`
+	Quantity   int         `json:"quantity"`
+	Price      money.Money `json:"price" gorm:"embedded;embeddedPrefix:price_"`
+	Name       string      `json:"name"`
+}
+
+// OrderStatusEvent is one entry in an order's status history. A row is
+// written for the initial status and for every transition after that.
+type OrderStatusEvent struct {
+	ID         uint64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrderID    uint64      `json:"order_id,string" gorm:"index"`
+	FromStatus OrderStatus `json:"from_status" gorm:"type:varchar(20)"`
+	ToStatus   OrderStatus `json:"to_status" gorm:"type:varchar(20)"`
+	ActorID    uint        `json:"actor_id"`
+	Reason     string      `json:"reason,omitempty"`
+	CreatedAt  time.Time   `json:"created_at" gorm:"index"`
 }
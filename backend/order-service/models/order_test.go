@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"zamato/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to OrderStatus
+		want     bool
+	}{
+		{StatusPending, StatusPaid, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusPending, StatusPreparing, false},
+		{StatusPending, StatusPaymentFailed, true},
+		{StatusPaymentFailed, StatusPaid, true},
+		{StatusPaymentFailed, StatusPending, true},
+		{StatusPaid, StatusPending, false},
+		{StatusPaymentFailed, StatusCancelled, true},
+		{StatusPaymentFailed, StatusPreparing, false},
+		{StatusPaid, StatusPreparing, true},
+		{StatusPaid, StatusCancelled, true},
+		{StatusPaid, StatusPending, false},
+		{StatusPreparing, StatusDelivered, true},
+		{StatusPreparing, StatusCancelled, false},
+		{StatusDelivered, StatusPending, false},
+		{StatusCancelled, StatusPaid, false},
+		{StatusPending, StatusPending, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.from.CanTransitionTo(tt.to))
+		})
+	}
+}
+
+func TestOrderStatus_IsValid(t *testing.T) {
+	assert.True(t, StatusPreparing.IsValid())
+	assert.False(t, OrderStatus("SHIPPED").IsValid())
+	assert.False(t, OrderStatus("delivered").IsValid())
+}
+
+func TestOrder_JSONIDIsString(t *testing.T) {
+	const id = 1<<62 + 1 // not exactly representable as a float64
+	usd := money.MustParse("1.00", "USD")
+	data, err := json.Marshal(Order{ID: id, TotalAmount: usd, OrderItems: []OrderItem{{OrderID: id, Price: usd}}})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"id":"4611686018427387905"`)
+	assert.Contains(t, string(data), `"order_id":"4611686018427387905"`)
+
+	var order Order
+	assert.NoError(t, json.Unmarshal(data, &order))
+	assert.Equal(t, uint64(id), order.ID)
+}
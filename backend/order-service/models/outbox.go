@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+const (
+	EventOrderCreated       = "OrderCreated"
+	EventOrderStatusChanged = "OrderStatusChanged"
+)
+
+// OutboxEvent is a domain event waiting to be published to the message
+// broker. Events are written in the same transaction as the order change they
+// describe and published afterwards by outbox.Relay.
+type OutboxEvent struct {
+	ID          uint64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	AggregateID uint64     `json:"aggregate_id" gorm:"index"`
+	EventType   string     `json:"event_type" gorm:"type:varchar(50)"`
+	Payload     string     `json:"payload" gorm:"type:text"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty" gorm:"index"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+}
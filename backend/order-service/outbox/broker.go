@@ -0,0 +1,84 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message is what the relay hands to a Broker. ID is stable across
+// redeliveries so consumers can deduplicate.
+type Message struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Key        string          `json:"key"`
+	Payload    json.RawMessage `json:"payload"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// Broker publishes messages to downstream consumers. Publish must only return
+// nil once the message has been durably accepted.
+type Broker interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// MemoryBroker keeps published messages in memory. It is meant for tests and
+// local development.
+type MemoryBroker struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of everything published so far.
+func (b *MemoryBroker) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.messages...)
+}
+
+// FileBroker appends every message as one JSON line to a file.
+type FileBroker struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileBroker(path string) *FileBroker {
+	return &FileBroker{path: path}
+}
+
+func (b *FileBroker) Publish(ctx context.Context, msg Message) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f, err := os.OpenFile(b.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
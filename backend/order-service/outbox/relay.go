@@ -0,0 +1,80 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"order-service/models"
+	"order-service/repository"
+	"strconv"
+	"time"
+)
+
+// Relay polls the outbox table and publishes pending events to a Broker.
+//
+// An event is marked as published only after the broker accepted it, so a
+// crash between the two steps causes a redelivery rather than a lost event:
+// delivery is at-least-once and consumers must deduplicate on Message.ID.
+type Relay struct {
+	repo      repository.OutboxRepository
+	broker    Broker
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRelay(repo repository.OutboxRepository, broker Broker, interval time.Duration, batchSize int) *Relay {
+	return &Relay{repo: repo, broker: broker, interval: interval, batchSize: batchSize}
+}
+
+// Run publishes pending events every interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.PublishPending(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("outbox relay: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishPending publishes one batch of pending events in order and returns
+// how many were published. It stops at the first failure so that events of
+// the same order are never delivered out of sequence; the failed event is
+// retried on the next call.
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	events, err := r.repo.FetchUnpublished(r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, event := range events {
+		if err := r.broker.Publish(ctx, toMessage(event)); err != nil {
+			if markErr := r.repo.MarkFailed(event.ID, err.Error()); markErr != nil {
+				log.Printf("outbox relay: failed to record error for event %d: %v", event.ID, markErr)
+			}
+			return published, err
+		}
+		if err := r.repo.MarkPublished(event.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+func toMessage(event models.OutboxEvent) Message {
+	return Message{
+		ID:         strconv.FormatUint(event.ID, 10),
+		Type:       event.EventType,
+		Key:        strconv.FormatUint(event.AggregateID, 10),
+		Payload:    json.RawMessage(event.Payload),
+		OccurredAt: event.CreatedAt,
+	}
+}
@@ -0,0 +1,93 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"order-service/models"
+	"order-service/repository"
+	"testing"
+	"zamato/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type flakyBroker struct {
+	MemoryBroker
+	failures int
+}
+
+func (b *flakyBroker) Publish(ctx context.Context, msg Message) error {
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("broker unavailable")
+	}
+	return b.MemoryBroker.Publish(ctx, msg)
+}
+
+func setupRelay(t *testing.T, broker Broker) (*Relay, repository.OrderRepository, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.Order{}, &models.OrderItem{}, &models.OrderStatusEvent{}, &models.OutboxEvent{}))
+	relay := NewRelay(repository.NewOutboxRepository(db), broker, 0, 10)
+	return relay, repository.NewOrderRepository(db), db
+}
+
+func TestRelay_PublishPending(t *testing.T) {
+	broker := NewMemoryBroker()
+	relay, orders, db := setupRelay(t, broker)
+
+	order := &models.Order{UserID: 1, TotalAmount: money.MustParse("10.00", "USD"), Status: models.StatusPending}
+	assert.NoError(t, orders.Create(order))
+	assert.NoError(t, orders.UpdateStatus(&models.OrderStatusEvent{
+		OrderID:    order.ID,
+		FromStatus: models.StatusPending,
+		ToStatus:   models.StatusPaid,
+	}))
+
+	n, err := relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	msgs := broker.Messages()
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, models.EventOrderCreated, msgs[0].Type)
+	assert.Equal(t, models.EventOrderStatusChanged, msgs[1].Type)
+	assert.NotEqual(t, msgs[0].ID, msgs[1].ID)
+
+	var pending int64
+	db.Model(&models.OutboxEvent{}).Where("published_at IS NULL").Count(&pending)
+	assert.Zero(t, pending)
+
+	// Nothing left to publish.
+	n, err = relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestRelay_RetriesFailedEvents(t *testing.T) {
+	broker := &flakyBroker{failures: 1}
+	relay, orders, db := setupRelay(t, broker)
+
+	assert.NoError(t, orders.Create(&models.Order{UserID: 1, Status: models.StatusPending}))
+	assert.NoError(t, orders.Create(&models.Order{UserID: 2, Status: models.StatusPending}))
+
+	n, err := relay.PublishPending(context.Background())
+	assert.Error(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, broker.Messages())
+
+	var failed models.OutboxEvent
+	assert.NoError(t, db.Order("id asc").First(&failed).Error)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "broker unavailable", failed.LastError)
+	assert.Nil(t, failed.PublishedAt)
+
+	n, err = relay.PublishPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	msgs := broker.Messages()
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "1", msgs[0].ID)
+}
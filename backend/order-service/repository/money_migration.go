@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"order-service/models"
+	"zamato/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+// legacyAmountColumns lists the float columns that amounts were stored in
+// before they became money.Money, and the prefix of their replacement.
+var legacyAmountColumns = []struct {
+	model  interface{}
+	column string
+	prefix string
+}{
+	{&models.Order{}, "total_amount", "total_"},
+	{&models.OrderItem{}, "price", "price_"},
+}
+
+// MigrateLegacyAmounts copies amounts from the old float columns into the
+// minor-unit columns, assuming they were in currency, and drops the old
+// columns. It must run after AutoMigrate and is a no-op once the old columns
+// are gone.
+func MigrateLegacyAmounts(db *gorm.DB, currency string) error {
+	if !money.ValidCurrency(currency) {
+		return fmt.Errorf("%w: %q", money.ErrInvalidCurrency, currency)
+	}
+	scale := math.Pow10(money.Exponent(currency))
+
+	for _, c := range legacyAmountColumns {
+		if !db.Migrator().HasColumn(c.model, c.column) {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Unscoped().Model(c.model).
+				Where(c.prefix + "currency = '' OR " + c.prefix + "currency IS NULL").
+				UpdateColumns(map[string]interface{}{
+					c.prefix + "minor":    gorm.Expr("ROUND("+c.column+" * ?)", scale),
+					c.prefix + "currency": currency,
+				}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(c.model, c.column)
+		})
+		if err != nil {
+			return fmt.Errorf("migrate %s: %w", c.column, err)
+		}
+	}
+	return nil
+}
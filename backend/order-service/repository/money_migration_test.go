@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"order-service/models"
+	"testing"
+	"zamato/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type legacyOrder struct {
+	ID          uint64 `gorm:"primaryKey"`
+	TotalAmount float64
+}
+
+func (legacyOrder) TableName() string { return "orders" }
+
+type legacyOrderItem struct {
+	gorm.Model
+	OrderID uint
+	Price   float64
+}
+
+func (legacyOrderItem) TableName() string { return "order_items" }
+
+func TestMigrateLegacyAmounts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&legacyOrder{}, &legacyOrderItem{}))
+	assert.NoError(t, db.Create(&legacyOrder{ID: 1, TotalAmount: 26.97}).Error)
+	assert.NoError(t, db.Create(&legacyOrderItem{OrderID: 1, Price: 8.99}).Error)
+
+	assert.NoError(t, db.AutoMigrate(&models.Order{}, &models.OrderItem{}))
+	assert.NoError(t, MigrateLegacyAmounts(db, "USD"))
+
+	var order models.Order
+	assert.NoError(t, db.Preload("OrderItems").First(&order, 1).Error)
+	assert.Equal(t, money.MustParse("26.97", "USD"), order.TotalAmount)
+	assert.Len(t, order.OrderItems, 1)
+	assert.Equal(t, money.MustParse("8.99", "USD"), order.OrderItems[0].Price)
+
+	assert.False(t, db.Migrator().HasColumn(&models.Order{}, "total_amount"))
+	assert.False(t, db.Migrator().HasColumn(&models.OrderItem{}, "price"))
+
+	// Running again is a no-op.
+	assert.NoError(t, MigrateLegacyAmounts(db, "USD"))
+}
@@ -1,17 +1,52 @@
 package repository
 
 import (
+	"errors"
+	"order-service/contracts"
 	"order-service/models"
 	"strconv"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+// ErrStatusConflict is returned by UpdateStatus when the order is no longer in
+// the expected status, i.e. it was changed concurrently.
+var ErrStatusConflict = errors.New("order status changed concurrently")
+
+// ErrDuplicateOrderID is returned by Create when another order already has
+// the new order's ID.
+var ErrDuplicateOrderID = errors.New("order id already taken")
+
 type OrderRepository interface {
 	Create(order *models.Order) error
 	GetByID(id string) (*models.Order, error) // Changed id type to string
-	GetUserOrders(userID uint) ([]models.Order, error)
-	UpdateStatus(id string, status models.OrderStatus) error // Changed id type to string
+	FindUserOrders(query OrderQuery) ([]models.Order, *OrderCursor, error)
+	UpdateStatus(event *models.OrderStatusEvent) error
+	GetStatusHistory(id string) ([]models.OrderStatusEvent, error)
+	UpdatePaymentID(id string, paymentID string) error
+	UpdateCourier(id string, courierID uint) error
+	UpdateRefund(id string, status models.RefundStatus, refundID *string) error
+}
+
+// OrderQuery selects a page of a user's orders, newest first unless
+// Ascending. CreatedFrom is inclusive and CreatedTo exclusive. After, if set,
+// is the position of the last order of the previous page.
+type OrderQuery struct {
+	UserID      uint
+	Statuses    []models.OrderStatus
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Ascending   bool
+	Limit       int
+	After       *OrderCursor
+}
+
+// OrderCursor is a position in a list of orders sorted by creation time and
+// ID.
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        uint64
 }
 
 type orderRepository struct {
@@ -22,8 +57,41 @@ func NewOrderRepository(db *gorm.DB) OrderRepository {
 	return &orderRepository{db: db}
 }
 
+// Create inserts the order with its items, records the initial status in the
+// order's history and queues an OrderCreated event, all in one transaction.
 func (r *orderRepository) Create(order *models.Order) error {
-	return r.db.Create(order).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			if isDuplicateKey(tx, err) {
+				return ErrDuplicateOrderID
+			}
+			return err
+		}
+		if err := tx.Create(&models.OrderStatusEvent{
+			OrderID:  order.ID,
+			ToStatus: order.Status,
+			ActorID:  order.UserID,
+		}).Error; err != nil {
+			return err
+		}
+		return enqueue(tx, order.ID, models.EventOrderCreated, contracts.OrderCreatedEvent{
+			OrderID:         order.ID,
+			UserID:          order.UserID,
+			TotalAmount:     order.TotalAmount,
+			Status:          order.Status,
+			DeliveryAddress: order.DeliveryAddress,
+			CreatedAt:       order.CreatedAt,
+		})
+	})
+}
+
+// isDuplicateKey reports whether err is a unique constraint violation, using
+// the dialect's error translation.
+func isDuplicateKey(db *gorm.DB, err error) bool {
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = translator.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
 }
 
 func (r *orderRepository) GetByID(id string) (*models.Order, error) {
@@ -39,16 +107,112 @@ func (r *orderRepository) GetByID(id string) (*models.Order, error) {
 	return &order, nil
 }
 
-func (r *orderRepository) GetUserOrders(userID uint) ([]models.Order, error) {
+// FindUserOrders returns up to query.Limit orders matching query, and the
+// position of the last one if more orders follow. It walks the
+// idx_orders_user_created index, so pages cost the same however many orders
+// the user has.
+func (r *orderRepository) FindUserOrders(query OrderQuery) ([]models.Order, *OrderCursor, error) {
+	db := r.db.Where("user_id = ?", query.UserID)
+	if len(query.Statuses) > 0 {
+		db = db.Where("status IN ?", query.Statuses)
+	}
+	if query.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", *query.CreatedFrom)
+	}
+	if query.CreatedTo != nil {
+		db = db.Where("created_at < ?", *query.CreatedTo)
+	}
+	cmp, dir := "<", "desc"
+	if query.Ascending {
+		cmp, dir = ">", "asc"
+	}
+	if after := query.After; after != nil {
+		db = db.Where("(created_at "+cmp+" ? OR (created_at = ? AND id "+cmp+" ?))", after.CreatedAt, after.CreatedAt, after.ID)
+	}
+
 	var orders []models.Order
-	err := r.db.Where("user_id = ?", userID).Preload("OrderItems").Order("created_at desc").Find(&orders).Error
-	return orders, err
+	err := db.Preload("OrderItems").Order("created_at " + dir + ", id " + dir).Limit(query.Limit + 1).Find(&orders).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(orders) <= query.Limit {
+		return orders, nil, nil
+	}
+	orders = orders[:query.Limit]
+	last := orders[len(orders)-1]
+	return orders, &OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+// UpdateStatus applies the transition described by event, appends it to the
+// order's history and queues an OrderStatusChanged event, all in one
+// transaction. The update only applies if the
+// order is still in event.FromStatus, so concurrent transitions cannot
+// overwrite each other.
+func (r *orderRepository) UpdateStatus(event *models.OrderStatusEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		event.CreatedAt = time.Now()
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ?", event.OrderID, event.FromStatus).
+			Updates(map[string]interface{}{
+				"status":            event.ToStatus,
+				"status_updated_by": event.ActorID,
+				"status_updated_at": event.CreatedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrStatusConflict
+		}
+		if err := tx.Create(event).Error; err != nil {
+			return err
+		}
+		return enqueue(tx, event.OrderID, models.EventOrderStatusChanged, contracts.OrderStatusChangedEvent{
+			OrderID:    event.OrderID,
+			FromStatus: event.FromStatus,
+			ToStatus:   event.ToStatus,
+			ActorID:    event.ActorID,
+			Reason:     event.Reason,
+			ChangedAt:  event.CreatedAt,
+		})
+	})
+}
+
+func (r *orderRepository) GetStatusHistory(id string) ([]models.OrderStatusEvent, error) {
+	orderID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	var events []models.OrderStatusEvent
+	err = r.db.Where("order_id = ?", orderID).Order("created_at asc, id asc").Find(&events).Error
+	return events, err
+}
+
+func (r *orderRepository) UpdatePaymentID(id string, paymentID string) error {
+	orderID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	return r.db.Model(&models.Order{}).Where("id = ?", orderID).Update("payment_id", paymentID).Error
+}
+
+// UpdateCourier assigns the order to a courier.
+func (r *orderRepository) UpdateCourier(id string, courierID uint) error {
+	orderID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	return r.db.Model(&models.Order{}).Where("id = ?", orderID).Update("courier_id", courierID).Error
 }
 
-func (r *orderRepository) UpdateStatus(id string, status models.OrderStatus) error {
+// UpdateRefund records what happened to the payment of a cancelled order.
+func (r *orderRepository) UpdateRefund(id string, status models.RefundStatus, refundID *string) error {
 	orderID, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
 		return err
 	}
-	return r.db.Model(&models.Order{}).Where("id = ?", orderID).Update("status", status).Error
+	return r.db.Model(&models.Order{}).Where("id = ?", orderID).Updates(map[string]interface{}{
+		"refund_status": status,
+		"refund_id":     refundID,
+	}).Error
 }
@@ -4,6 +4,8 @@ import (
 	"order-service/models"
 	"strconv"
 	"testing"
+	"time"
+	"zamato/pkg/money"
 
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
@@ -13,7 +15,7 @@ import (
 func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
-	err = db.AutoMigrate(&models.Order{}, &models.OrderItem{})
+	err = db.AutoMigrate(&models.Order{}, &models.OrderItem{}, &models.OrderStatusEvent{}, &models.OutboxEvent{})
 	assert.NoError(t, err)
 	return db
 }
@@ -26,9 +28,9 @@ func TestOrderRepository_CRUD(t *testing.T) {
 		order := &models.Order{
 			UserID: 1,
 			OrderItems: []models.OrderItem{
-				{MenuItemID: 1, Quantity: 2, Price: 10},
+				{MenuItemID: 1, Quantity: 2, Price: money.MustParse("10.00", "USD")},
 			},
-			TotalAmount:     20,
+			TotalAmount:     money.MustParse("20.00", "USD"),
 			Status:          models.StatusPending,
 			DeliveryAddress: "addr",
 		}
@@ -43,41 +45,165 @@ func TestOrderRepository_CRUD(t *testing.T) {
 		assert.Equal(t, 1, len(got.OrderItems))
 	})
 
-	t.Run("GetUserOrders", func(t *testing.T) {
-		order := &models.Order{
-			UserID: 2,
-			OrderItems: []models.OrderItem{
-				{MenuItemID: 2, Quantity: 1, Price: 5},
-			},
-			TotalAmount:     5,
-			Status:          models.StatusPending,
-			DeliveryAddress: "addr2",
+	t.Run("Create with a taken ID", func(t *testing.T) {
+		newOrder := func() *models.Order {
+			return &models.Order{
+				ID:     1 << 40,
+				UserID: 1,
+				OrderItems: []models.OrderItem{
+					{MenuItemID: 1, Quantity: 1, Price: money.MustParse("10.00", "USD")},
+				},
+				TotalAmount: money.MustParse("10.00", "USD"),
+				Status:      models.StatusPending,
+			}
 		}
-		err := repo.Create(order)
+		assert.NoError(t, repo.Create(newOrder()))
+		assert.ErrorIs(t, repo.Create(newOrder()), ErrDuplicateOrderID)
+
+		var items int64
+		assert.NoError(t, db.Model(&models.OrderItem{}).Where("order_id = ?", uint64(1<<40)).Count(&items).Error)
+		assert.Equal(t, int64(1), items)
+	})
+
+	t.Run("FindUserOrders", func(t *testing.T) {
+		start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		statuses := []models.OrderStatus{models.StatusPending, models.StatusPaid, models.StatusDelivered, models.StatusPaid, models.StatusCancelled}
+		ids := make([]uint64, len(statuses))
+		for i, status := range statuses {
+			order := &models.Order{
+				UserID: 2,
+				OrderItems: []models.OrderItem{
+					{MenuItemID: 2, Quantity: 1, Price: money.MustParse("5.00", "USD")},
+				},
+				TotalAmount:     money.MustParse("5.00", "USD"),
+				Status:          status,
+				DeliveryAddress: "addr2",
+				CreatedAt:       start.Add(time.Duration(i) * time.Hour),
+			}
+			assert.NoError(t, repo.Create(order))
+			ids[i] = order.ID
+		}
+		idsOf := func(orders []models.Order) []uint64 {
+			var got []uint64
+			for _, o := range orders {
+				got = append(got, o.ID)
+			}
+			return got
+		}
+
+		orders, next, err := repo.FindUserOrders(OrderQuery{UserID: 2, Limit: 2})
 		assert.NoError(t, err)
+		assert.Equal(t, []uint64{ids[4], ids[3]}, idsOf(orders))
+		assert.Len(t, orders[0].OrderItems, 1)
+		assert.NotNil(t, next)
 
-		orders, err := repo.GetUserOrders(2)
+		orders, next, err = repo.FindUserOrders(OrderQuery{UserID: 2, Limit: 2, After: next})
 		assert.NoError(t, err)
-		assert.Len(t, orders, 1)
-		assert.Equal(t, uint(2), orders[0].UserID)
+		assert.Equal(t, []uint64{ids[2], ids[1]}, idsOf(orders))
+
+		orders, next, err = repo.FindUserOrders(OrderQuery{UserID: 2, Limit: 2, After: next})
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{ids[0]}, idsOf(orders))
+		assert.Nil(t, next, "last page")
+
+		orders, _, err = repo.FindUserOrders(OrderQuery{UserID: 2, Limit: 10, Ascending: true, Statuses: []models.OrderStatus{models.StatusPaid, models.StatusCancelled}})
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{ids[1], ids[3], ids[4]}, idsOf(orders))
+
+		from, to := start.Add(time.Hour), start.Add(3*time.Hour)
+		orders, _, err = repo.FindUserOrders(OrderQuery{UserID: 2, Limit: 10, CreatedFrom: &from, CreatedTo: &to})
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{ids[2], ids[1]}, idsOf(orders))
+
+		orders, _, err = repo.FindUserOrders(OrderQuery{UserID: 99, Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, orders)
 	})
 
 	t.Run("UpdateStatus", func(t *testing.T) {
 		order := &models.Order{
 			UserID: 3,
 			OrderItems: []models.OrderItem{
-				{MenuItemID: 3, Quantity: 1, Price: 7},
+				{MenuItemID: 3, Quantity: 1, Price: money.MustParse("7.00", "USD")},
 			},
-			TotalAmount:     7,
+			TotalAmount:     money.MustParse("7.00", "USD"),
 			Status:          models.StatusPending,
 			DeliveryAddress: "addr3",
 		}
 		err := repo.Create(order)
 		assert.NoError(t, err)
-		err = repo.UpdateStatus(strconv.FormatUint(order.ID, 10), models.StatusDelivered)
+		err = repo.UpdateStatus(&models.OrderStatusEvent{
+			OrderID:    order.ID,
+			FromStatus: models.StatusPending,
+			ToStatus:   models.StatusPaid,
+			ActorID:    9,
+			Reason:     "payment confirmed",
+		})
 		assert.NoError(t, err)
 		got, _ := repo.GetByID(strconv.FormatUint(order.ID, 10))
-		assert.Equal(t, models.StatusDelivered, got.Status)
+		assert.Equal(t, models.StatusPaid, got.Status)
+		assert.Equal(t, uint(9), got.StatusUpdatedBy)
+		assert.NotNil(t, got.StatusUpdatedAt)
+
+		history, err := repo.GetStatusHistory(strconv.FormatUint(order.ID, 10))
+		assert.NoError(t, err)
+		assert.Len(t, history, 2)
+		assert.Equal(t, models.StatusPending, history[0].ToStatus)
+		assert.Equal(t, uint(3), history[0].ActorID)
+		assert.Equal(t, models.StatusPending, history[1].FromStatus)
+		assert.Equal(t, models.StatusPaid, history[1].ToStatus)
+		assert.Equal(t, "payment confirmed", history[1].Reason)
+	})
+
+	t.Run("UpdateStatus stale from status", func(t *testing.T) {
+		order := &models.Order{
+			UserID:          4,
+			TotalAmount:     money.MustParse("7.00", "USD"),
+			Status:          models.StatusPaid,
+			DeliveryAddress: "addr4",
+		}
+		err := repo.Create(order)
+		assert.NoError(t, err)
+		err = repo.UpdateStatus(&models.OrderStatusEvent{
+			OrderID:    order.ID,
+			FromStatus: models.StatusPending,
+			ToStatus:   models.StatusCancelled,
+			ActorID:    9,
+		})
+		assert.ErrorIs(t, err, ErrStatusConflict)
+		got, _ := repo.GetByID(strconv.FormatUint(order.ID, 10))
+		assert.Equal(t, models.StatusPaid, got.Status)
+
+		history, err := repo.GetStatusHistory(strconv.FormatUint(order.ID, 10))
+		assert.NoError(t, err)
+		assert.Len(t, history, 1)
+	})
+
+	t.Run("UpdateRefund", func(t *testing.T) {
+		order := &models.Order{UserID: 4, TotalAmount: money.MustParse("9.00", "USD"), Status: models.StatusCancelled}
+		assert.NoError(t, repo.Create(order))
+		id := strconv.FormatUint(order.ID, 10)
+
+		refundID := "re_1"
+		assert.NoError(t, repo.UpdateRefund(id, models.RefundStatusRefunded, &refundID))
+		got, err := repo.GetByID(id)
+		assert.NoError(t, err)
+		assert.Equal(t, models.RefundStatusRefunded, got.RefundStatus)
+		assert.Equal(t, &refundID, got.RefundID)
+	})
+
+	t.Run("UpdateCourier", func(t *testing.T) {
+		order := &models.Order{UserID: 4, RestaurantID: 8, TotalAmount: money.MustParse("9.00", "USD"), Status: models.StatusPaid}
+		assert.NoError(t, repo.Create(order))
+		id := strconv.FormatUint(order.ID, 10)
+
+		assert.NoError(t, repo.UpdateCourier(id, 9))
+		got, err := repo.GetByID(id)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(8), got.RestaurantID)
+		if assert.NotNil(t, got.CourierID) {
+			assert.Equal(t, uint(9), *got.CourierID)
+		}
 	})
 
 	t.Run("GetByID not found", func(t *testing.T) {
@@ -86,4 +212,35 @@ func TestOrderRepository_CRUD(t *testing.T) {
 		assert.Contains(t, err.Error(), "record not found")
 		assert.Nil(t, got)
 	})
+
+	t.Run("Create and UpdateStatus enqueue outbox events", func(t *testing.T) {
+		order := &models.Order{
+			UserID:          5,
+			TotalAmount:     money.MustParse("12.00", "USD"),
+			Status:          models.StatusPending,
+			DeliveryAddress: "addr5",
+		}
+		assert.NoError(t, repo.Create(order))
+		assert.NoError(t, repo.UpdateStatus(&models.OrderStatusEvent{
+			OrderID:    order.ID,
+			FromStatus: models.StatusPending,
+			ToStatus:   models.StatusCancelled,
+			ActorID:    5,
+		}))
+		// A rejected transition must not leave an event behind.
+		assert.ErrorIs(t, repo.UpdateStatus(&models.OrderStatusEvent{
+			OrderID:    order.ID,
+			FromStatus: models.StatusPending,
+			ToStatus:   models.StatusPaid,
+		}), ErrStatusConflict)
+
+		var events []models.OutboxEvent
+		assert.NoError(t, db.Where("aggregate_id = ?", order.ID).Order("id asc").Find(&events).Error)
+		assert.Len(t, events, 2)
+		assert.Equal(t, models.EventOrderCreated, events[0].EventType)
+		assert.Contains(t, events[0].Payload, `"user_id":5`)
+		assert.Equal(t, models.EventOrderStatusChanged, events[1].EventType)
+		assert.Contains(t, events[1].Payload, `"to_status":"CANCELLED"`)
+		assert.Nil(t, events[1].PublishedAt)
+	})
 }
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"encoding/json"
+	"order-service/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutboxRepository gives the outbox relay access to events that still have to
+// be published.
+type OutboxRepository interface {
+	FetchUnpublished(limit int) ([]models.OutboxEvent, error)
+	MarkPublished(id uint64) error
+	MarkFailed(id uint64, reason string) error
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// FetchUnpublished returns up to limit unpublished events, oldest first.
+func (r *outboxRepository) FetchUnpublished(limit int) ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	err := r.db.Where("published_at IS NULL").Order("id asc").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (r *outboxRepository) MarkPublished(id uint64) error {
+	return r.db.Model(&models.OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"published_at": time.Now(),
+		"attempts":     gorm.Expr("attempts + 1"),
+		"last_error":   "",
+	}).Error
+}
+
+func (r *outboxRepository) MarkFailed(id uint64, reason string) error {
+	return r.db.Model(&models.OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+	}).Error
+}
+
+// enqueue writes an event to the outbox using tx, so that it is committed or
+// rolled back together with the change it describes.
+func enqueue(tx *gorm.DB, aggregateID uint64, eventType string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboxEvent{
+		AggregateID: aggregateID,
+		EventType:   eventType,
+		Payload:     string(body),
+	}).Error
+}
@@ -2,113 +2,615 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"order-service/contracts"
 	"order-service/external"
+	"order-service/idgen"
 	"order-service/models"
 	"order-service/repository"
 	"strconv"
-	"sync"
+	"time"
+	"zamato/pkg/auth"
+	"zamato/pkg/money"
+	"zamato/pkg/pagination"
+	"zamato/pkg/problem"
 
-	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidOrder        = problem.New(problem.Invalid, "invalid_order", "invalid order")
+	ErrInvalidStatus       = problem.New(problem.Invalid, "invalid_status", "invalid order status")
+	ErrInvalidTransition   = problem.New(problem.Conflict, "invalid_transition", "invalid order status transition")
+	ErrUnknownMenuItem     = problem.New(problem.Invalid, "unknown_menu_item", "unknown menu item")
+	ErrMenuItemUnavailable = problem.New(problem.Unprocessable, "menu_item_unavailable", "menu item is not available")
+	ErrMenuLookupFailed    = problem.New(problem.Upstream, "menu_lookup_failed", "menu lookup failed")
+	ErrOrderNotFound       = problem.New(problem.NotFound, "order_not_found", "order not found")
+	ErrForbiddenTransition = problem.New(problem.Forbidden, "transition_forbidden", "order status change not permitted")
+	ErrInvalidQuery        = problem.New(problem.Invalid, "invalid_query", "invalid order query")
+	ErrInvalidPayment      = problem.New(problem.Invalid, "invalid_payment", "invalid payment outcome")
+	ErrInvalidCourier      = problem.New(problem.Invalid, "invalid_courier", "invalid courier")
+	ErrCourierNotAllowed   = problem.New(problem.Conflict, "courier_not_allowed", "order cannot be assigned to a courier")
+	ErrPaymentNotRetryable = problem.New(problem.Conflict, "payment_not_retryable", "only orders whose payment failed can be paid again")
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	// maxIDAttempts is how often CreateOrder draws a new ID when the last one
+	// was already taken.
+	maxIDAttempts = 3
+)
+
+// pageCursor is the position a next_cursor token holds.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint64    `json:"id"`
+	Sort      string    `json:"s"`
+}
+
+// staffTransitions lists the statuses each staff role may move an order to.
+// Admins may make any change the state machine allows except back to
+// PENDING, which only RetryPayment does, while customers change their orders
+// only through CancelOrder and RetryPayment.
+var staffTransitions = map[auth.Role][]models.OrderStatus{
+	auth.RoleRestaurant: {models.StatusPreparing},
+	auth.RoleCourier:    {models.StatusDelivered},
+}
+
+// canSetStatus reports whether role may move orders to status.
+func canSetStatus(role auth.Role, status models.OrderStatus) bool {
+	if role == auth.RoleAdmin {
+		return status != models.StatusPending
+	}
+	for _, allowed := range staffTransitions[role] {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+// canSee reports whether caller may access order: customers their own
+// orders, restaurants the orders placed with them, couriers the orders
+// assigned to them, support and admins every order.
+func canSee(caller auth.Principal, order *models.Order) bool {
+	switch caller.Role {
+	case auth.RoleSupport, auth.RoleAdmin:
+		return true
+	case auth.RoleRestaurant:
+		return order.RestaurantID == caller.UserID
+	case auth.RoleCourier:
+		return order.CourierID != nil && *order.CourierID == caller.UserID
+	case auth.RoleCustomer:
+		return order.UserID == caller.UserID
+	}
+	return false
+}
+
 type OrderService interface {
-	CreateOrder(userID uint, items []models.OrderItem, address string) (*models.Order, error)
-	GetOrderHistory(userID uint) ([]models.Order, error)
-	GetOrder(orderID string) (*models.Order, error)
-	UpdateOrderStatus(orderID string, status models.OrderStatus) error
-	ProcessPayment(orderID string, paymentID string) error
+	CreateOrder(userID uint, items []contracts.CheckoutItem, address string) (*models.Order, error)
+	GetOrderHistory(userID uint, query contracts.OrderHistoryQuery) (*contracts.OrderPage, error)
+	GetOrder(orderID string, caller auth.Principal) (*models.Order, error)
+	UpdateOrderStatus(orderID string, status models.OrderStatus, caller auth.Principal, reason string) error
+	GetOrderStatusHistory(orderID string, caller auth.Principal) ([]models.OrderStatusEvent, error)
+	ProcessPayment(orderID string, paymentID string, status string) error
+	CancelOrder(orderID string, userID uint, reason string) (*models.Order, error)
+	RetryPayment(orderID string, userID uint) (*models.Order, error)
+	AssignCourier(orderID string, courierID uint, caller auth.Principal) (*models.Order, error)
 }
 
 type orderService struct {
-	repo repository.OrderRepository
+	repo     repository.OrderRepository
+	payments external.PaymentClient
+	menu     external.MenuCatalog
+	ids      idgen.Generator
 }
 
-func NewOrderService(repo repository.OrderRepository) OrderService {
-	return &orderService{repo: repo}
+func NewOrderService(repo repository.OrderRepository, payments external.PaymentClient, menu external.MenuCatalog, ids idgen.Generator) OrderService {
+	return &orderService{repo: repo, payments: payments, menu: menu, ids: ids}
 }
 
-func (s *orderService) CreateOrder(userID uint, items []models.OrderItem, address string) (*models.Order, error) {
+func (s *orderService) CreateOrder(userID uint, items []contracts.CheckoutItem, address string) (*models.Order, error) {
 	if len(items) == 0 {
-		return nil, errors.New("order must have at least one item")
+		return nil, fmt.Errorf("%w: order must have at least one item", ErrInvalidOrder)
 	}
 
-	var total float64
-	for i := range items {
-		if items[i].Quantity <= 0 || items[i].Price < 0 {
-			return nil, errors.New("invalid item quantity or price")
-		}
-		total += float64(items[i].Quantity) * items[i].Price
+	orderItems, restaurantID, err := s.priceItems(items)
+	if err != nil {
+		return nil, err
 	}
 
-	// Generate a unique OrderID as uint64
-	orderID := uint64(uuid.New().ID())
+	total, err := orderTotal(orderItems)
+	if err != nil {
+		return nil, err
+	}
 
 	order := &models.Order{
-		ID:              orderID,
 		UserID:          userID,
-		OrderItems:      items,
+		RestaurantID:    restaurantID,
+		OrderItems:      orderItems,
 		TotalAmount:     total,
 		Status:          models.StatusPending,
 		DeliveryAddress: address,
 	}
+	if err := s.createWithNewID(order); err != nil {
+		return nil, err
+	}
+
+	s.requestPayment(order)
+	return order, nil
+}
+
+// createWithNewID stores order under a freshly generated ID, drawing another
+// one if the ID turns out to be taken.
+func (s *orderService) createWithNewID(order *models.Order) error {
+	for attempt := 1; ; attempt++ {
+		id, err := s.ids.NextID()
+		if err != nil {
+			return fmt.Errorf("generate order id: %w", err)
+		}
+		order.ID = id
+		err = s.repo.Create(order)
+		if !errors.Is(err, repository.ErrDuplicateOrderID) || attempt == maxIDAttempts {
+			return err
+		}
+		log.Printf("order id %d already taken, retrying", id)
+	}
+}
 
-	var wg sync.WaitGroup
-	var createErr error
+// priceItems turns the requested items into order items using the names and
+// prices from the menu catalog, and returns the restaurant that serves them.
+// Clients only choose what and how much to order; they never set prices. All
+// items must come from the same restaurant.
+func (s *orderService) priceItems(items []contracts.CheckoutItem) ([]models.OrderItem, uint, error) {
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, 0, fmt.Errorf("%w: invalid item quantity", ErrInvalidOrder)
+		}
+		ids = append(ids, item.MenuItemID)
+	}
 
-	// Goroutine for creating the order in the repository
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		createErr = s.repo.Create(order)
-	}()
+	menu, err := s.menu.GetMenuItems(ids)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrMenuLookupFailed, err)
+	}
 
-	// Goroutine for processing the payment
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		paymentRequest := contracts.PaymentRequest{
-			OrderID: strconv.FormatUint(orderID, 10), // Convert uint64 to string
-			Amount:  total,
+	orderItems := make([]models.OrderItem, 0, len(items))
+	var restaurantID uint
+	for i, item := range items {
+		menuItem, ok := menu[item.MenuItemID]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: %d", ErrUnknownMenuItem, item.MenuItemID)
+		}
+		if !menuItem.Available {
+			return nil, 0, fmt.Errorf("%w: %s", ErrMenuItemUnavailable, menuItem.Name)
 		}
-		_, err := external.ProcessPayment("https://payment-service/pay", paymentRequest)
+		if i == 0 {
+			restaurantID = menuItem.RestaurantID
+		} else if menuItem.RestaurantID != restaurantID {
+			return nil, 0, fmt.Errorf("%w: items come from more than one restaurant", ErrInvalidOrder)
+		}
+		orderItems = append(orderItems, models.OrderItem{
+			MenuItemID: item.MenuItemID,
+			Quantity:   item.Quantity,
+			Price:      menuItem.Price,
+			Name:       menuItem.Name,
+		})
+	}
+	return orderItems, restaurantID, nil
+}
+
+// orderTotal sums the line totals of items. All items must be priced in the
+// same currency.
+func orderTotal(items []models.OrderItem) (money.Money, error) {
+	total := money.Zero(items[0].Price.Currency)
+	for _, item := range items {
+		line, err := item.Price.Mul(int64(item.Quantity))
 		if err != nil {
-			// Log the error or handle it as needed
+			return money.Money{}, fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+		}
+		if total, err = total.Add(line); err != nil {
+			return money.Money{}, fmt.Errorf("%w: order total: %w", ErrInvalidOrder, err)
 		}
-	}()
+	}
+	return total, nil
+}
 
-	wg.Wait()
+// requestPayment charges the order through payment-service. A failed payment
+// does not fail the checkout: a declined order moves to PAYMENT_FAILED, where
+// the customer can pay it again through RetryPayment. Any other error leaves
+// the order PENDING without a payment ID. If payment-service did take the
+// payment, for example after the client timed out, it reports the outcome
+// to ProcessPayment later; otherwise the order can only be cancelled.
+func (s *orderService) requestPayment(order *models.Order) {
+	orderID := strconv.FormatUint(order.ID, 10)
+	resp, err := s.payments.CreatePayment(contracts.PaymentRequest{
+		OrderID: orderID,
+		Amount:  order.TotalAmount,
+	})
+	if err != nil {
+		log.Printf("payment for order %s failed: %v", orderID, err)
+		var statusErr *external.StatusError
+		if !errors.As(err, &statusErr) || !statusErr.Declined() {
+			return
+		}
+		if err := s.transitionOrder(order, models.StatusPaymentFailed, models.SystemActor, "payment declined"); err != nil {
+			log.Printf("failed to mark order %s as payment failed: %v", orderID, err)
+			return
+		}
+		order.Status = models.StatusPaymentFailed
+		return
+	}
 
-	if createErr != nil {
-		return nil, createErr
+	if err := s.repo.UpdatePaymentID(orderID, resp.PaymentID); err != nil {
+		log.Printf("failed to store payment %s for order %s: %v", resp.PaymentID, orderID, err)
+		return
 	}
+	order.PaymentID = &resp.PaymentID
 
-	return order, nil
+	if resp.Status != contracts.PaymentStatusCompleted {
+		return
+	}
+	if err := s.transition(orderID, models.StatusPaid, models.SystemActor, "payment "+resp.PaymentID+" completed"); err != nil {
+		log.Printf("failed to mark order %s as paid: %v", orderID, err)
+		return
+	}
+	order.Status = models.StatusPaid
 }
 
-func (s *orderService) GetOrderHistory(userID uint) ([]models.Order, error) {
-	return s.repo.GetUserOrders(userID)
+func (s *orderService) GetOrderHistory(userID uint, query contracts.OrderHistoryQuery) (*contracts.OrderPage, error) {
+	if query.Sort == "" {
+		query.Sort = contracts.SortNewestFirst
+	}
+	repoQuery, err := orderQuery(userID, query)
+	if err != nil {
+		return nil, err
+	}
+	orders, next, err := s.repo.FindUserOrders(repoQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &contracts.OrderPage{Orders: orders}
+	if page.Orders == nil {
+		page.Orders = []models.Order{}
+	}
+	if next != nil {
+		page.NextCursor = pagination.EncodeCursor(pageCursor{CreatedAt: next.CreatedAt, ID: next.ID, Sort: query.Sort})
+	}
+	return page, nil
 }
 
-func (s *orderService) GetOrder(orderID string) (*models.Order, error) {
-	return s.repo.GetByID(orderID)
+// orderQuery validates query and turns it into a repository query.
+func orderQuery(userID uint, query contracts.OrderHistoryQuery) (repository.OrderQuery, error) {
+	if query.Sort != contracts.SortNewestFirst && query.Sort != contracts.SortOldestFirst {
+		return repository.OrderQuery{}, fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, query.Sort)
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+	if query.Limit < 0 || query.Limit > maxPageSize {
+		return repository.OrderQuery{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxPageSize)
+	}
+	for _, status := range query.Statuses {
+		if !status.IsValid() {
+			return repository.OrderQuery{}, fmt.Errorf("%w: %q", ErrInvalidStatus, status)
+		}
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return repository.OrderQuery{}, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
+	repoQuery := repository.OrderQuery{
+		UserID:      userID,
+		Statuses:    query.Statuses,
+		CreatedFrom: query.From,
+		CreatedTo:   query.To,
+		Ascending:   query.Sort == contracts.SortOldestFirst,
+		Limit:       query.Limit,
+	}
+	if query.Cursor != "" {
+		var cursor pageCursor
+		if err := pagination.DecodeCursor(query.Cursor, &cursor); err != nil || cursor.ID == 0 {
+			return repository.OrderQuery{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+		if cursor.Sort != query.Sort {
+			return repository.OrderQuery{}, fmt.Errorf("%w: cursor was issued for sort %q", ErrInvalidQuery, cursor.Sort)
+		}
+		repoQuery.After = &repository.OrderCursor{CreatedAt: cursor.CreatedAt, ID: cursor.ID}
+	}
+	return repoQuery, nil
+}
+
+func (s *orderService) GetOrder(orderID string, caller auth.Principal) (*models.Order, error) {
+	return s.visibleOrder(orderID, caller)
+}
+
+// UpdateOrderStatus moves an order to status on behalf of caller, if the
+// caller's role permits that status.
+func (s *orderService) UpdateOrderStatus(orderID string, status models.OrderStatus, caller auth.Principal, reason string) error {
+	if !status.IsValid() {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, status)
+	}
+	order, err := s.visibleOrder(orderID, caller)
+	if err != nil {
+		return err
+	}
+	if !canSetStatus(caller.Role, status) {
+		return fmt.Errorf("%w: %s may not move orders to %s", ErrForbiddenTransition, caller.Role, status)
+	}
+	return s.transitionOrder(order, status, caller.UserID, reason)
 }
 
-func (s *orderService) UpdateOrderStatus(orderID string, status models.OrderStatus) error {
-	return s.repo.UpdateStatus(orderID, status)
+func (s *orderService) GetOrderStatusHistory(orderID string, caller auth.Principal) ([]models.OrderStatusEvent, error) {
+	if _, err := s.visibleOrder(orderID, caller); err != nil {
+		return nil, err
+	}
+	return s.repo.GetStatusHistory(orderID)
+}
+
+// visibleOrder loads an order caller may access. Orders of other users are
+// reported as not found, so that order IDs cannot be probed.
+func (s *orderService) visibleOrder(orderID string, caller auth.Principal) (*models.Order, error) {
+	order, err := s.repo.GetByID(orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !canSee(caller, order)) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
 }
 
-func (s *orderService) ProcessPayment(orderID string, paymentID string) error {
+// ProcessPayment applies the outcome of a payment that payment-service
+// reports for an order: a completed payment moves the order to PAID, a failed
+// one to PAYMENT_FAILED. Reports are delivered at least once, so a repeated
+// report is accepted without a change, and so is the failure of a payment
+// the order no longer uses or of an order whose payment already failed. A
+// payment that completes after its order was cancelled, or after another
+// payment already paid it, is given back.
+func (s *orderService) ProcessPayment(orderID string, paymentID string, status string) error {
+	if paymentID == "" {
+		return fmt.Errorf("%w: payment_id is required", ErrInvalidPayment)
+	}
+	var to models.OrderStatus
+	switch status {
+	case contracts.PaymentStatusCompleted:
+		to = models.StatusPaid
+	case contracts.PaymentStatusFailed:
+		to = models.StatusPaymentFailed
+	default:
+		return fmt.Errorf("%w: unknown payment status %q", ErrInvalidPayment, status)
+	}
+
 	order, err := s.repo.GetByID(orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOrderNotFound
+	}
 	if err != nil {
 		return err
 	}
-	if order.Status != models.StatusPending {
-		return errors.New("invalid order status")
+	current := order.PaymentID != nil && *order.PaymentID == paymentID
+	if current && order.Status == to {
+		return nil
+	}
+	if to == models.StatusPaymentFailed && order.PaymentID != nil && !current {
+		log.Printf("ignoring failure of payment %s: order %s uses payment %s", paymentID, orderID, *order.PaymentID)
+		return nil
+	}
+	if to == models.StatusPaymentFailed && order.Status == models.StatusPaymentFailed {
+		return nil
+	}
+	if to == models.StatusPaid && order.Status == models.StatusCancelled {
+		return s.releaseLatePayment(order, paymentID, current)
+	}
+	if to == models.StatusPaid && !current && order.PaymentID != nil && !order.Status.CanTransitionTo(to) {
+		s.releaseExtraPayment(order, paymentID)
+		return nil
+	}
+	if !order.Status.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.Status, to)
+	}
+
+	if !current {
+		if err := s.repo.UpdatePaymentID(orderID, paymentID); err != nil {
+			return err
+		}
+	}
+	return s.transitionOrder(order, to, models.SystemActor, "payment "+paymentID+" "+status)
+}
+
+// CancelOrder cancels an order of userID and gives its payment back: a hold
+// on the funds is voided, a charge refunded in full. The order stays
+// cancelled even if that fails; the outcome is recorded in its RefundStatus,
+// and cancelling it again retries a failed refund. Orders of other users are
+// reported as not found.
+func (s *orderService) CancelOrder(orderID string, userID uint, reason string) (*models.Order, error) {
+	order, err := s.repo.GetByID(orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && order.UserID != userID) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	retry := order.Status == models.StatusCancelled && order.RefundStatus == models.RefundStatusFailed
+	if !retry {
+		if err := s.transitionOrder(order, models.StatusCancelled, userID, reason); err != nil {
+			return nil, err
+		}
+		order.Status = models.StatusCancelled
+	}
+	if order.PaymentID != nil {
+		s.releasePayment(order, reason)
+	}
+	return order, nil
+}
+
+// RetryPayment charges a PAYMENT_FAILED order of userID again. The order
+// moves back to PENDING before payment-service is asked, so concurrent
+// retries cannot both charge it; the outcome is applied as at checkout.
+// Orders of other users are reported as not found.
+func (s *orderService) RetryPayment(orderID string, userID uint) (*models.Order, error) {
+	order, err := s.repo.GetByID(orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && order.UserID != userID) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.StatusPaymentFailed {
+		return nil, fmt.Errorf("%w: order is %s", ErrPaymentNotRetryable, order.Status)
+	}
+	if err := s.transitionOrder(order, models.StatusPending, userID, "payment retried"); err != nil {
+		if errors.Is(err, ErrInvalidTransition) {
+			return nil, fmt.Errorf("%w: %v", ErrPaymentNotRetryable, err)
+		}
+		return nil, err
+	}
+	order.Status = models.StatusPending
+
+	s.requestPayment(order)
+	return order, nil
+}
+
+// AssignCourier hands a paid order that is not yet delivered to courierID.
+// Restaurants assign couriers to their own orders, admins to any order; a
+// courier assigned earlier is replaced.
+func (s *orderService) AssignCourier(orderID string, courierID uint, caller auth.Principal) (*models.Order, error) {
+	if courierID == 0 {
+		return nil, fmt.Errorf("%w: courier_id is required", ErrInvalidCourier)
+	}
+	order, err := s.visibleOrder(orderID, caller)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.StatusPaid && order.Status != models.StatusPreparing {
+		return nil, fmt.Errorf("%w: order is %s", ErrCourierNotAllowed, order.Status)
+	}
+	if err := s.repo.UpdateCourier(orderID, courierID); err != nil {
+		return nil, err
+	}
+	order.CourierID = &courierID
+	return order, nil
+}
+
+// releaseLatePayment gives back paymentID, which completed after order was
+// cancelled. If the order had no payment yet, or this one could not be given
+// back at cancellation, the outcome is recorded on the order; a payment the
+// order does not use is only given back and logged.
+func (s *orderService) releaseLatePayment(order *models.Order, paymentID string, current bool) error {
+	orderID := strconv.FormatUint(order.ID, 10)
+	reason := "order cancelled before payment " + paymentID + " completed"
+	switch {
+	case current && (order.RefundStatus == models.RefundStatusRefunded || order.RefundStatus == models.RefundStatusVoided):
+		return nil
+	case order.PaymentID != nil && !current:
+		status, _, err := s.returnPayment(paymentID, reason)
+		if err != nil {
+			log.Printf("failed to give back payment %s of cancelled order %s: %v", paymentID, orderID, err)
+			return nil
+		}
+		log.Printf("gave back payment %s of cancelled order %s (%s); the order uses payment %s", paymentID, orderID, status, *order.PaymentID)
+		return nil
+	case order.PaymentID == nil:
+		if err := s.repo.UpdatePaymentID(orderID, paymentID); err != nil {
+			return err
+		}
+		order.PaymentID = &paymentID
 	}
-	// Optionally, update PaymentID if your model supports it
-	// order.PaymentID = &paymentID
-	// s.repo.UpdatePaymentID(orderID, paymentID) // If you have such a method
+	s.releasePayment(order, reason)
+	return nil
+}
+
+// releaseExtraPayment gives back paymentID, which completed for an order that
+// another payment already paid, such as when a retry raced an earlier
+// attempt. The order keeps its payment; a failure is only logged.
+func (s *orderService) releaseExtraPayment(order *models.Order, paymentID string) {
+	orderID := strconv.FormatUint(order.ID, 10)
+	status, _, err := s.returnPayment(paymentID, "order "+orderID+" was already paid by payment "+*order.PaymentID)
+	if err != nil {
+		log.Printf("failed to give back payment %s of order %s, which uses payment %s: %v", paymentID, orderID, *order.PaymentID, err)
+		return
+	}
+	log.Printf("gave back payment %s of order %s (%s); the order uses payment %s", paymentID, orderID, status, *order.PaymentID)
+}
+
+// releasePayment gives the payment of a cancelled order back and records the
+// outcome on the order.
+func (s *orderService) releasePayment(order *models.Order, reason string) {
+	orderID := strconv.FormatUint(order.ID, 10)
+	status, refundID, err := s.returnPayment(*order.PaymentID, reason)
+	if err != nil {
+		log.Printf("failed to give back payment %s of cancelled order %s: %v", *order.PaymentID, orderID, err)
+		status = models.RefundStatusFailed
+	}
+	if err := s.repo.UpdateRefund(orderID, status, refundID); err != nil {
+		log.Printf("failed to store refund outcome %s for order %s: %v", status, orderID, err)
+		return
+	}
+	order.RefundStatus = status
+	order.RefundID = refundID
+}
 
-	return s.repo.UpdateStatus(orderID, models.StatusPaid)
+// returnPayment voids or refunds a payment, depending on whether it was
+// captured.
+func (s *orderService) returnPayment(paymentID, reason string) (models.RefundStatus, *string, error) {
+	payment, err := s.payments.GetPayment(paymentID)
+	if err != nil {
+		return "", nil, err
+	}
+	switch payment.Status {
+	case contracts.PaymentStatusAuthorized:
+		if _, err := s.payments.VoidPayment(paymentID); err != nil {
+			return "", nil, err
+		}
+		return models.RefundStatusVoided, nil, nil
+	case contracts.PaymentStatusCompleted:
+		refund, err := s.payments.RefundPayment(paymentID, contracts.RefundRequest{Reason: reason})
+		if err != nil {
+			return "", nil, err
+		}
+		return models.RefundStatusRefunded, &refund.RefundID, nil
+	case contracts.PaymentStatusVoided, contracts.PaymentStatusFailed:
+		return models.RefundStatusVoided, nil, nil
+	}
+	return "", nil, fmt.Errorf("cannot give back a %s payment", payment.Status)
+}
+
+// transition moves an order to the given status if the state machine in
+// models.OrderStatus allows it, recording the change in the order's history.
+func (s *orderService) transition(orderID string, to models.OrderStatus, actorID uint, reason string) error {
+	order, err := s.repo.GetByID(orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.transitionOrder(order, to, actorID, reason)
+}
+
+func (s *orderService) transitionOrder(order *models.Order, to models.OrderStatus, actorID uint, reason string) error {
+	if !order.Status.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.Status, to)
+	}
+	event := &models.OrderStatusEvent{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   to,
+		ActorID:    actorID,
+		Reason:     reason,
+	}
+	if err := s.repo.UpdateStatus(event); err != nil {
+		if errors.Is(err, repository.ErrStatusConflict) {
+			return fmt.Errorf("%w: %v", ErrInvalidTransition, err)
+		}
+		return err
+	}
+	return nil
 }
@@ -2,54 +2,160 @@ package service
 
 import (
 	"errors"
+	"net/http"
+	"order-service/contracts"
+	"order-service/external"
 	"order-service/mocks"
 	"order-service/models"
+	"order-service/repository"
 	"testing"
+	"time"
+	"zamato/pkg/auth"
+	"zamato/pkg/money"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
+var testMenu = external.NewStaticMenuCatalog(
+	external.MenuItem{ID: 1, RestaurantID: 8, Name: "Margherita", Price: money.MustParse("10.00", "USD"), Available: true},
+	external.MenuItem{ID: 2, RestaurantID: 8, Name: "Calzone", Price: money.MustParse("12.00", "USD"), Available: false},
+	external.MenuItem{ID: 3, RestaurantID: 7, Name: "Ramen", Price: money.MustParse("14.00", "USD"), Available: true},
+)
+
+// sequenceIDs hands out 1, 2, 3, ...
+type sequenceIDs struct{ last uint64 }
+
+func (s *sequenceIDs) NextID() (uint64, error) {
+	s.last++
+	return s.last, nil
+}
+
 func TestOrderService_CreateOrder(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	createOK := func(m *mocks.MockOrderRepository) {
+		m.EXPECT().
+			Create(gomock.Any()).
+			DoAndReturn(func(order *models.Order) error {
+				assert.Equal(t, uint64(1), order.ID)
+				return nil
+			})
+	}
+
 	tests := []struct {
-		name        string
-		items       []models.OrderItem
-		mockSetup   func(m *mocks.MockOrderRepository)
-		wantErr     bool
-		errContains string
+		name          string
+		items         []contracts.CheckoutItem
+		mockSetup     func(m *mocks.MockOrderRepository)
+		paymentSetup  func(p *mocks.MockPaymentClient)
+		wantErr       bool
+		errContains   string
+		wantStatus    models.OrderStatus
+		wantPaymentID string
 	}{
 		{
-			name:  "success",
-			items: []models.OrderItem{{MenuItemID: 1, Quantity: 2, Price: 10}},
+			name:  "success with completed payment",
+			items: []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 2}},
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				createOK(m)
+				m.EXPECT().UpdatePaymentID("1", "pay_1").Return(nil)
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusPending}, nil)
+				m.EXPECT().UpdateStatus(gomock.Any()).Return(nil)
+			},
+			paymentSetup: func(p *mocks.MockPaymentClient) {
+				p.EXPECT().
+					CreatePayment(contracts.PaymentRequest{OrderID: "1", Amount: money.MustParse("20.00", "USD")}).
+					Return(&contracts.PaymentResponse{PaymentID: "pay_1", Status: "completed"}, nil)
+			},
+			wantStatus:    models.StatusPaid,
+			wantPaymentID: "pay_1",
+		},
+		{
+			name:  "payment not yet completed",
+			items: []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 1}},
 			mockSetup: func(m *mocks.MockOrderRepository) {
+				createOK(m)
+				m.EXPECT().UpdatePaymentID("1", "pay_2").Return(nil)
+			},
+			paymentSetup: func(p *mocks.MockPaymentClient) {
+				p.EXPECT().
+					CreatePayment(gomock.Any()).
+					Return(&contracts.PaymentResponse{PaymentID: "pay_2", Status: "pending"}, nil)
+			},
+			wantStatus:    models.StatusPending,
+			wantPaymentID: "pay_2",
+		},
+		{
+			name:      "payment failure leaves order pending",
+			items:     []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 1}},
+			mockSetup: createOK,
+			paymentSetup: func(p *mocks.MockPaymentClient) {
+				p.EXPECT().
+					CreatePayment(gomock.Any()).
+					Return(nil, errors.New("payment-service unavailable"))
+			},
+			wantStatus: models.StatusPending,
+		},
+		{
+			name:  "declined payment marks order payment failed",
+			items: []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 1}},
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				createOK(m)
 				m.EXPECT().
-					Create(gomock.Any()).
-					DoAndReturn(func(order *models.Order) error {
-						order.ID = 1
+					UpdateStatus(gomock.Any()).
+					DoAndReturn(func(event *models.OrderStatusEvent) error {
+						assert.Equal(t, models.StatusPending, event.FromStatus)
+						assert.Equal(t, models.StatusPaymentFailed, event.ToStatus)
 						return nil
 					})
 			},
+			paymentSetup: func(p *mocks.MockPaymentClient) {
+				p.EXPECT().
+					CreatePayment(gomock.Any()).
+					Return(nil, &external.StatusError{StatusCode: http.StatusPaymentRequired})
+			},
+			wantStatus: models.StatusPaymentFailed,
 		},
 		{
 			name:        "no items",
-			items:       []models.OrderItem{},
+			items:       []contracts.CheckoutItem{},
 			mockSetup:   func(m *mocks.MockOrderRepository) {},
 			wantErr:     true,
 			errContains: "at least one item",
 		},
 		{
 			name:        "invalid quantity",
-			items:       []models.OrderItem{{MenuItemID: 1, Quantity: 0, Price: 10}},
+			items:       []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 0}},
+			mockSetup:   func(m *mocks.MockOrderRepository) {},
+			wantErr:     true,
+			errContains: "invalid item quantity",
+		},
+		{
+			name:        "unknown menu item",
+			items:       []contracts.CheckoutItem{{MenuItemID: 99, Quantity: 1}},
 			mockSetup:   func(m *mocks.MockOrderRepository) {},
 			wantErr:     true,
-			errContains: "invalid item quantity or price",
+			errContains: "unknown menu item",
+		},
+		{
+			name:        "unavailable menu item",
+			items:       []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 1}, {MenuItemID: 2, Quantity: 1}},
+			mockSetup:   func(m *mocks.MockOrderRepository) {},
+			wantErr:     true,
+			errContains: "not available",
+		},
+		{
+			name:        "items of several restaurants",
+			items:       []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 1}, {MenuItemID: 3, Quantity: 1}},
+			mockSetup:   func(m *mocks.MockOrderRepository) {},
+			wantErr:     true,
+			errContains: "more than one restaurant",
 		},
 		{
 			name:  "repo error",
-			items: []models.OrderItem{{MenuItemID: 1, Quantity: 1, Price: 10}},
+			items: []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 1}},
 			mockSetup: func(m *mocks.MockOrderRepository) {
 				m.EXPECT().
 					Create(gomock.Any()).
@@ -58,14 +164,52 @@ func TestOrderService_CreateOrder(t *testing.T) {
 			wantErr:     true,
 			errContains: "db error",
 		},
+		{
+			name:  "taken id is replaced",
+			items: []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 1}},
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				var tried []uint64
+				m.EXPECT().
+					Create(gomock.Any()).
+					DoAndReturn(func(order *models.Order) error {
+						tried = append(tried, order.ID)
+						if len(tried) == 1 {
+							return repository.ErrDuplicateOrderID
+						}
+						assert.Equal(t, []uint64{1, 2}, tried)
+						return nil
+					}).Times(2)
+				m.EXPECT().UpdatePaymentID("2", "pay_3").Return(nil)
+			},
+			paymentSetup: func(p *mocks.MockPaymentClient) {
+				p.EXPECT().
+					CreatePayment(gomock.Any()).
+					Return(&contracts.PaymentResponse{PaymentID: "pay_3", Status: "pending"}, nil)
+			},
+			wantStatus:    models.StatusPending,
+			wantPaymentID: "pay_3",
+		},
+		{
+			name:  "ids keep colliding",
+			items: []contracts.CheckoutItem{{MenuItemID: 1, Quantity: 1}},
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				m.EXPECT().Create(gomock.Any()).Return(repository.ErrDuplicateOrderID).Times(maxIDAttempts)
+			},
+			wantErr:     true,
+			errContains: "order id already taken",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo := mocks.NewMockOrderRepository(ctrl)
+			mockPayments := mocks.NewMockPaymentClient(ctrl)
 			if tt.mockSetup != nil {
 				tt.mockSetup(mockRepo)
 			}
-			svc := NewOrderService(mockRepo)
+			if tt.paymentSetup != nil {
+				tt.paymentSetup(mockPayments)
+			}
+			svc := NewOrderService(mockRepo, mockPayments, testMenu, &sequenceIDs{})
 			order, err := svc.CreateOrder(1, tt.items, "addr")
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -75,23 +219,111 @@ func TestOrderService_CreateOrder(t *testing.T) {
 				assert.NoError(t, err)
 				assert.NotNil(t, order)
 				assert.Equal(t, "addr", order.DeliveryAddress)
+				assert.Equal(t, uint(8), order.RestaurantID)
+				assert.Equal(t, "Margherita", order.OrderItems[0].Name)
+				assert.Equal(t, money.MustParse("10.00", "USD"), order.OrderItems[0].Price)
+				assert.Equal(t, tt.wantStatus, order.Status)
+				if tt.wantPaymentID != "" {
+					assert.Equal(t, tt.wantPaymentID, *order.PaymentID)
+				} else {
+					assert.Nil(t, order.PaymentID)
+				}
 			}
 		})
 	}
 }
 
+func TestOrderTotal(t *testing.T) {
+	total, err := orderTotal([]models.OrderItem{
+		{Quantity: 3, Price: money.MustParse("0.10", "USD")},
+		{Quantity: 1, Price: money.MustParse("8.99", "USD")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, money.MustParse("9.29", "USD"), total)
+
+	_, err = orderTotal([]models.OrderItem{
+		{Quantity: 1, Price: money.MustParse("1.00", "USD")},
+		{Quantity: 1, Price: money.MustParse("1.00", "EUR")},
+	})
+	assert.ErrorIs(t, err, money.ErrCurrencyMismatch)
+}
+
 func TestOrderService_GetOrderHistory(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockOrderRepository(ctrl)
-	mockRepo.EXPECT().
-		GetUserOrders(uint(1)).
-		Return([]models.Order{{ID: 1, UserID: 1}}, nil)
-	svc := NewOrderService(mockRepo)
-	orders, err := svc.GetOrderHistory(1)
-	assert.NoError(t, err)
-	assert.Len(t, orders, 1)
+	svc := NewOrderService(mockRepo, nil, nil, nil)
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("first page", func(t *testing.T) {
+		mockRepo.EXPECT().
+			FindUserOrders(repository.OrderQuery{UserID: 1, Limit: 20}).
+			Return([]models.Order{{ID: 1, UserID: 1}}, &repository.OrderCursor{CreatedAt: createdAt, ID: 1}, nil)
+		page, err := svc.GetOrderHistory(1, contracts.OrderHistoryQuery{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Orders, 1)
+		assert.NotEmpty(t, page.NextCursor)
+
+		// The cursor resumes after the last order, with the same sort.
+		mockRepo.EXPECT().
+			FindUserOrders(repository.OrderQuery{UserID: 1, Limit: 20, After: &repository.OrderCursor{CreatedAt: createdAt, ID: 1}}).
+			Return(nil, nil, nil)
+		last, err := svc.GetOrderHistory(1, contracts.OrderHistoryQuery{Cursor: page.NextCursor})
+		assert.NoError(t, err)
+		assert.NotNil(t, last.Orders, "empty pages encode as []")
+		assert.Empty(t, last.NextCursor)
+
+		_, err = svc.GetOrderHistory(1, contracts.OrderHistoryQuery{Cursor: page.NextCursor, Sort: contracts.SortOldestFirst})
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+	})
+
+	t.Run("filters and sort", func(t *testing.T) {
+		from, to := createdAt, createdAt.AddDate(0, 0, 7)
+		mockRepo.EXPECT().
+			FindUserOrders(repository.OrderQuery{
+				UserID:      1,
+				Statuses:    []models.OrderStatus{models.StatusPaid},
+				CreatedFrom: &from,
+				CreatedTo:   &to,
+				Ascending:   true,
+				Limit:       5,
+			}).
+			Return([]models.Order{}, nil, nil)
+		_, err := svc.GetOrderHistory(1, contracts.OrderHistoryQuery{
+			Statuses: []models.OrderStatus{models.StatusPaid},
+			From:     &from,
+			To:       &to,
+			Sort:     contracts.SortOldestFirst,
+			Limit:    5,
+		})
+		assert.NoError(t, err)
+	})
+
+	from, to := createdAt, createdAt.Add(-time.Hour)
+	invalid := []struct {
+		name    string
+		query   contracts.OrderHistoryQuery
+		wantErr error
+	}{
+		{name: "limit too large", query: contracts.OrderHistoryQuery{Limit: 101}, wantErr: ErrInvalidQuery},
+		{name: "unknown sort", query: contracts.OrderHistoryQuery{Sort: "total"}, wantErr: ErrInvalidQuery},
+		{name: "malformed cursor", query: contracts.OrderHistoryQuery{Cursor: "not-a-cursor"}, wantErr: ErrInvalidQuery},
+		{name: "empty range", query: contracts.OrderHistoryQuery{From: &from, To: &to}, wantErr: ErrInvalidQuery},
+		{name: "unknown status", query: contracts.OrderHistoryQuery{Statuses: []models.OrderStatus{"SHIPPED"}}, wantErr: ErrInvalidStatus},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.GetOrderHistory(1, tt.query)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("repository error", func(t *testing.T) {
+		mockRepo.EXPECT().FindUserOrders(gomock.Any()).Return(nil, nil, errors.New("db down"))
+		_, err := svc.GetOrderHistory(1, contracts.OrderHistoryQuery{})
+		assert.EqualError(t, err, "db down")
+	})
 }
 
 func TestOrderService_GetOrder(t *testing.T) {
@@ -99,7 +331,8 @@ func TestOrderService_GetOrder(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockRepo := mocks.NewMockOrderRepository(ctrl)
-	service := NewOrderService(mockRepo)
+	service := NewOrderService(mockRepo, nil, nil, nil)
+	owner := auth.Principal{UserID: 1, Role: auth.RoleCustomer}
 
 	t.Run("success", func(t *testing.T) {
 		expectedOrder := &models.Order{
@@ -107,16 +340,732 @@ func TestOrderService_GetOrder(t *testing.T) {
 			UserID: 1,
 		}
 		mockRepo.EXPECT().GetByID("1").Return(expectedOrder, nil)
-		order, err := service.GetOrder("1")
+		order, err := service.GetOrder("1", owner)
 		assert.NoError(t, err)
 		assert.Equal(t, expectedOrder, order)
 	})
 
 	t.Run("not found", func(t *testing.T) {
-		mockRepo.EXPECT().GetByID("2").Return(nil, errors.New("record not found"))
-		order, err := service.GetOrder("2")
-		assert.Error(t, err)
+		mockRepo.EXPECT().GetByID("2").Return(nil, gorm.ErrRecordNotFound)
+		order, err := service.GetOrder("2", owner)
+		assert.ErrorIs(t, err, ErrOrderNotFound)
 		assert.Nil(t, order)
-		assert.Contains(t, err.Error(), "record not found")
 	})
+
+	t.Run("order of another customer", func(t *testing.T) {
+		mockRepo.EXPECT().GetByID("3").Return(&models.Order{ID: 3, UserID: 2}, nil)
+		order, err := service.GetOrder("3", owner)
+		assert.ErrorIs(t, err, ErrOrderNotFound)
+		assert.Nil(t, order)
+	})
+
+	t.Run("staff see the orders they handle", func(t *testing.T) {
+		courier := uint(9)
+		handled := &models.Order{ID: 3, UserID: 2, RestaurantID: 8, CourierID: &courier}
+		for _, caller := range []auth.Principal{
+			{UserID: 8, Role: auth.RoleRestaurant},
+			{UserID: 9, Role: auth.RoleCourier},
+			{UserID: 5, Role: auth.RoleSupport},
+			{UserID: 5, Role: auth.RoleAdmin},
+		} {
+			mockRepo.EXPECT().GetByID("3").Return(handled, nil)
+			order, err := service.GetOrder("3", caller)
+			assert.NoError(t, err, caller.Role)
+			assert.Equal(t, handled, order)
+		}
+	})
+
+	t.Run("restaurants and couriers do not see unrelated orders", func(t *testing.T) {
+		courier := uint(9)
+		for _, order := range []*models.Order{
+			{ID: 3, UserID: 2, RestaurantID: 7},
+			{ID: 3, UserID: 2, RestaurantID: 7, CourierID: &courier},
+		} {
+			mockRepo.EXPECT().GetByID("3").Return(order, nil)
+			_, err := service.GetOrder("3", auth.Principal{UserID: 8, Role: auth.RoleRestaurant})
+			assert.ErrorIs(t, err, ErrOrderNotFound)
+		}
+		for _, order := range []*models.Order{
+			{ID: 3, UserID: 2, RestaurantID: 9},
+			{ID: 3, UserID: 9, RestaurantID: 7},
+		} {
+			mockRepo.EXPECT().GetByID("3").Return(order, nil)
+			_, err := service.GetOrder("3", auth.Principal{UserID: 9, Role: auth.RoleCourier})
+			assert.ErrorIs(t, err, ErrOrderNotFound)
+		}
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		mockRepo.EXPECT().GetByID("4").Return(nil, errors.New("db down"))
+		_, err := service.GetOrder("4", owner)
+		assert.EqualError(t, err, "db down")
+	})
+}
+
+func TestOrderService_UpdateOrderStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	admin := auth.Principal{UserID: 5, Role: auth.RoleAdmin}
+	courier := uint(9)
+	tests := []struct {
+		name      string
+		caller    auth.Principal
+		current   models.OrderStatus
+		owner     uint
+		next      models.OrderStatus
+		mockSetup func(m *mocks.MockOrderRepository)
+		wantErr   error
+	}{
+		{
+			name:    "pending to paid",
+			caller:  admin,
+			current: models.StatusPending,
+			next:    models.StatusPaid,
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				m.EXPECT().UpdateStatus(&models.OrderStatusEvent{OrderID: 1, FromStatus: models.StatusPending, ToStatus: models.StatusPaid, ActorID: 5, Reason: "test"}).Return(nil)
+			},
+		},
+		{
+			name:    "paid to cancelled",
+			caller:  admin,
+			current: models.StatusPaid,
+			next:    models.StatusCancelled,
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				m.EXPECT().UpdateStatus(&models.OrderStatusEvent{OrderID: 1, FromStatus: models.StatusPaid, ToStatus: models.StatusCancelled, ActorID: 5, Reason: "test"}).Return(nil)
+			},
+		},
+		{
+			name:    "delivered back to paid",
+			caller:  admin,
+			current: models.StatusDelivered,
+			next:    models.StatusPaid,
+			wantErr: ErrInvalidTransition,
+		},
+		{
+			name:    "admin may not reopen a failed payment",
+			caller:  admin,
+			current: models.StatusPaymentFailed,
+			next:    models.StatusPending,
+			wantErr: ErrForbiddenTransition,
+		},
+		{
+			name:    "skip preparing",
+			caller:  admin,
+			current: models.StatusPaid,
+			next:    models.StatusDelivered,
+			wantErr: ErrInvalidTransition,
+		},
+		{
+			name:    "concurrent change",
+			caller:  admin,
+			current: models.StatusPending,
+			next:    models.StatusPaid,
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				m.EXPECT().UpdateStatus(&models.OrderStatusEvent{OrderID: 1, FromStatus: models.StatusPending, ToStatus: models.StatusPaid, ActorID: 5, Reason: "test"}).Return(repository.ErrStatusConflict)
+			},
+			wantErr: ErrInvalidTransition,
+		},
+		{
+			name:    "restaurant starts preparing",
+			caller:  auth.Principal{UserID: 8, Role: auth.RoleRestaurant},
+			current: models.StatusPaid,
+			next:    models.StatusPreparing,
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				m.EXPECT().UpdateStatus(&models.OrderStatusEvent{OrderID: 1, FromStatus: models.StatusPaid, ToStatus: models.StatusPreparing, ActorID: 8, Reason: "test"}).Return(nil)
+			},
+		},
+		{
+			name:    "courier delivers",
+			caller:  auth.Principal{UserID: 9, Role: auth.RoleCourier},
+			current: models.StatusPreparing,
+			next:    models.StatusDelivered,
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				m.EXPECT().UpdateStatus(&models.OrderStatusEvent{OrderID: 1, FromStatus: models.StatusPreparing, ToStatus: models.StatusDelivered, ActorID: 9, Reason: "test"}).Return(nil)
+			},
+		},
+		{
+			name:    "restaurant of another order",
+			caller:  auth.Principal{UserID: 7, Role: auth.RoleRestaurant},
+			current: models.StatusPaid,
+			next:    models.StatusPreparing,
+			wantErr: ErrOrderNotFound,
+		},
+		{
+			name:    "courier not assigned to the order",
+			caller:  auth.Principal{UserID: 10, Role: auth.RoleCourier},
+			current: models.StatusPreparing,
+			next:    models.StatusDelivered,
+			wantErr: ErrOrderNotFound,
+		},
+		{
+			name:    "courier may not prepare",
+			caller:  auth.Principal{UserID: 9, Role: auth.RoleCourier},
+			current: models.StatusPaid,
+			next:    models.StatusPreparing,
+			wantErr: ErrForbiddenTransition,
+		},
+		{
+			name:    "customer may not mark own order paid",
+			caller:  auth.Principal{UserID: 3, Role: auth.RoleCustomer},
+			owner:   3,
+			current: models.StatusPending,
+			next:    models.StatusPaid,
+			wantErr: ErrForbiddenTransition,
+		},
+		{
+			name:    "order of another customer",
+			caller:  auth.Principal{UserID: 4, Role: auth.RoleCustomer},
+			owner:   3,
+			current: models.StatusPending,
+			next:    models.StatusCancelled,
+			wantErr: ErrOrderNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := mocks.NewMockOrderRepository(ctrl)
+			mockRepo.EXPECT().GetByID("1").Return(&models.Order{ID: 1, UserID: tt.owner, RestaurantID: 8, CourierID: &courier, Status: tt.current}, nil)
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockRepo)
+			}
+			svc := NewOrderService(mockRepo, nil, nil, nil)
+			err := svc.UpdateOrderStatus("1", tt.next, tt.caller, "test")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("unknown status", func(t *testing.T) {
+		svc := NewOrderService(mocks.NewMockOrderRepository(ctrl), nil, nil, nil)
+		err := svc.UpdateOrderStatus("1", "SHIPPED", admin, "")
+		assert.ErrorIs(t, err, ErrInvalidStatus)
+	})
+}
+
+func TestOrderService_GetOrderStatusHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockOrderRepository(ctrl)
+	svc := NewOrderService(mockRepo, nil, nil, nil)
+	owner := auth.Principal{UserID: 1, Role: auth.RoleCustomer}
+
+	t.Run("success", func(t *testing.T) {
+		mockRepo.EXPECT().GetByID("1").Return(&models.Order{ID: 1, UserID: 1}, nil)
+		mockRepo.EXPECT().GetStatusHistory("1").Return([]models.OrderStatusEvent{{OrderID: 1, ToStatus: models.StatusPending}}, nil)
+		events, err := svc.GetOrderStatusHistory("1", owner)
+		assert.NoError(t, err)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("order not found", func(t *testing.T) {
+		mockRepo.EXPECT().GetByID("2").Return(nil, gorm.ErrRecordNotFound)
+		events, err := svc.GetOrderStatusHistory("2", owner)
+		assert.ErrorIs(t, err, ErrOrderNotFound)
+		assert.Nil(t, events)
+	})
+
+	t.Run("order of another customer", func(t *testing.T) {
+		mockRepo.EXPECT().GetByID("3").Return(&models.Order{ID: 3, UserID: 2}, nil)
+		events, err := svc.GetOrderStatusHistory("3", owner)
+		assert.ErrorIs(t, err, ErrOrderNotFound)
+		assert.Nil(t, events)
+	})
+}
+
+func TestOrderService_CancelOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	paymentID := "pay_1"
+	refundID := "re_1"
+	cancelEvent := func(from models.OrderStatus) *models.OrderStatusEvent {
+		return &models.OrderStatusEvent{OrderID: 1, FromStatus: from, ToStatus: models.StatusCancelled, ActorID: 5, Reason: "changed my mind"}
+	}
+
+	tests := []struct {
+		name             string
+		order            *models.Order
+		findErr          error
+		mockSetup        func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient)
+		wantErr          error
+		wantRefundStatus models.RefundStatus
+		wantRefundID     *string
+	}{
+		{
+			name:  "pending without payment",
+			order: &models.Order{ID: 1, UserID: 5, Status: models.StatusPending},
+			mockSetup: func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				r.EXPECT().UpdateStatus(cancelEvent(models.StatusPending)).Return(nil)
+			},
+		},
+		{
+			name:  "authorized payment is voided",
+			order: &models.Order{ID: 1, UserID: 5, Status: models.StatusPending, PaymentID: &paymentID},
+			mockSetup: func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				r.EXPECT().UpdateStatus(cancelEvent(models.StatusPending)).Return(nil)
+				p.EXPECT().GetPayment(paymentID).Return(&contracts.PaymentResponse{PaymentID: paymentID, Status: contracts.PaymentStatusAuthorized}, nil)
+				p.EXPECT().VoidPayment(paymentID).Return(&contracts.PaymentResponse{PaymentID: paymentID, Status: contracts.PaymentStatusVoided}, nil)
+				r.EXPECT().UpdateRefund("1", models.RefundStatusVoided, nil).Return(nil)
+			},
+			wantRefundStatus: models.RefundStatusVoided,
+		},
+		{
+			name:  "paid order is refunded",
+			order: &models.Order{ID: 1, UserID: 5, Status: models.StatusPaid, PaymentID: &paymentID},
+			mockSetup: func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				r.EXPECT().UpdateStatus(cancelEvent(models.StatusPaid)).Return(nil)
+				p.EXPECT().GetPayment(paymentID).Return(&contracts.PaymentResponse{PaymentID: paymentID, Status: contracts.PaymentStatusCompleted}, nil)
+				p.EXPECT().RefundPayment(paymentID, contracts.RefundRequest{Reason: "changed my mind"}).Return(&contracts.RefundResponse{RefundID: refundID, Status: "completed"}, nil)
+				r.EXPECT().UpdateRefund("1", models.RefundStatusRefunded, &refundID).Return(nil)
+			},
+			wantRefundStatus: models.RefundStatusRefunded,
+			wantRefundID:     &refundID,
+		},
+		{
+			name:  "refund failure is recorded",
+			order: &models.Order{ID: 1, UserID: 5, Status: models.StatusPaid, PaymentID: &paymentID},
+			mockSetup: func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				r.EXPECT().UpdateStatus(cancelEvent(models.StatusPaid)).Return(nil)
+				p.EXPECT().GetPayment(paymentID).Return(&contracts.PaymentResponse{PaymentID: paymentID, Status: contracts.PaymentStatusCompleted}, nil)
+				p.EXPECT().RefundPayment(paymentID, gomock.Any()).Return(nil, &external.StatusError{StatusCode: 502})
+				r.EXPECT().UpdateRefund("1", models.RefundStatusFailed, nil).Return(nil)
+			},
+			wantRefundStatus: models.RefundStatusFailed,
+		},
+		{
+			name:  "retry of a failed refund",
+			order: &models.Order{ID: 1, UserID: 5, Status: models.StatusCancelled, PaymentID: &paymentID, RefundStatus: models.RefundStatusFailed},
+			mockSetup: func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				p.EXPECT().GetPayment(paymentID).Return(&contracts.PaymentResponse{PaymentID: paymentID, Status: contracts.PaymentStatusCompleted}, nil)
+				p.EXPECT().RefundPayment(paymentID, gomock.Any()).Return(&contracts.RefundResponse{RefundID: refundID}, nil)
+				r.EXPECT().UpdateRefund("1", models.RefundStatusRefunded, &refundID).Return(nil)
+			},
+			wantRefundStatus: models.RefundStatusRefunded,
+			wantRefundID:     &refundID,
+		},
+		{
+			name:    "already cancelled",
+			order:   &models.Order{ID: 1, UserID: 5, Status: models.StatusCancelled, RefundStatus: models.RefundStatusRefunded},
+			wantErr: ErrInvalidTransition,
+		},
+		{
+			name:    "already preparing",
+			order:   &models.Order{ID: 1, UserID: 5, Status: models.StatusPreparing, PaymentID: &paymentID},
+			wantErr: ErrInvalidTransition,
+		},
+		{
+			name:    "someone else's order",
+			order:   &models.Order{ID: 1, UserID: 6, Status: models.StatusPending},
+			wantErr: ErrOrderNotFound,
+		},
+		{
+			name:    "not found",
+			findErr: gorm.ErrRecordNotFound,
+			wantErr: ErrOrderNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := mocks.NewMockOrderRepository(ctrl)
+			mockPayments := mocks.NewMockPaymentClient(ctrl)
+			mockRepo.EXPECT().GetByID("1").Return(tt.order, tt.findErr)
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockRepo, mockPayments)
+			}
+			svc := NewOrderService(mockRepo, mockPayments, nil, nil)
+			order, err := svc.CancelOrder("1", 5, "changed my mind")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, models.StatusCancelled, order.Status)
+			assert.Equal(t, tt.wantRefundStatus, order.RefundStatus)
+			assert.Equal(t, tt.wantRefundID, order.RefundID)
+		})
+	}
+}
+
+func TestOrderService_ProcessPayment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	paymentID := func(id string) *string { return &id }
+	expectTransition := func(m *mocks.MockOrderRepository, from, to models.OrderStatus) {
+		m.EXPECT().
+			UpdateStatus(gomock.Any()).
+			DoAndReturn(func(event *models.OrderStatusEvent) error {
+				assert.Equal(t, from, event.FromStatus)
+				assert.Equal(t, to, event.ToStatus)
+				assert.Equal(t, models.SystemActor, event.ActorID)
+				return nil
+			})
+	}
+
+	tests := []struct {
+		name      string
+		paymentID string
+		status    string
+		mockSetup func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient)
+		wantErr   error
+	}{
+		{
+			name:      "completed",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusPending, PaymentID: paymentID("pay_1")}, nil)
+				expectTransition(m, models.StatusPending, models.StatusPaid)
+			},
+		},
+		{
+			name:      "failed stores the payment",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusFailed,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusPending}, nil)
+				m.EXPECT().UpdatePaymentID("1", "pay_1").Return(nil)
+				expectTransition(m, models.StatusPending, models.StatusPaymentFailed)
+			},
+		},
+		{
+			name:      "later payment recovers a failed order",
+			paymentID: "pay_2",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusPaymentFailed, PaymentID: paymentID("pay_1")}, nil)
+				m.EXPECT().UpdatePaymentID("1", "pay_2").Return(nil)
+				expectTransition(m, models.StatusPaymentFailed, models.StatusPaid)
+			},
+		},
+		{
+			name:      "repeated report",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusPaid, PaymentID: paymentID("pay_1")}, nil)
+			},
+		},
+		{
+			name:      "failure of a replaced payment",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusFailed,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusPaid, PaymentID: paymentID("pay_2")}, nil)
+			},
+		},
+		{
+			name:      "failure of an order whose payment already failed",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusFailed,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusPaymentFailed}, nil)
+			},
+		},
+		{
+			name:      "second payment of a paid order is refunded",
+			paymentID: "pay_2",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusPreparing, PaymentID: paymentID("pay_1")}, nil)
+				p.EXPECT().GetPayment("pay_2").Return(&contracts.PaymentResponse{PaymentID: "pay_2", Status: contracts.PaymentStatusCompleted}, nil)
+				p.EXPECT().RefundPayment("pay_2", gomock.Any()).Return(&contracts.RefundResponse{RefundID: "re_2"}, nil)
+			},
+		},
+		{
+			name:      "completed after cancellation is refunded",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusCancelled, PaymentID: paymentID("pay_1"), RefundStatus: models.RefundStatusFailed}, nil)
+				p.EXPECT().GetPayment("pay_1").Return(&contracts.PaymentResponse{PaymentID: "pay_1", Status: contracts.PaymentStatusCompleted}, nil)
+				p.EXPECT().RefundPayment("pay_1", gomock.Any()).Return(&contracts.RefundResponse{RefundID: "re_1"}, nil)
+				m.EXPECT().UpdateRefund("1", models.RefundStatusRefunded, paymentID("re_1")).Return(nil)
+			},
+		},
+		{
+			name:      "completed after cancellation stores the payment",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusCancelled}, nil)
+				m.EXPECT().UpdatePaymentID("1", "pay_1").Return(nil)
+				p.EXPECT().GetPayment("pay_1").Return(&contracts.PaymentResponse{PaymentID: "pay_1", Status: contracts.PaymentStatusCompleted}, nil)
+				p.EXPECT().RefundPayment("pay_1", gomock.Any()).Return(&contracts.RefundResponse{RefundID: "re_1"}, nil)
+				m.EXPECT().UpdateRefund("1", models.RefundStatusRefunded, paymentID("re_1")).Return(nil)
+			},
+		},
+		{
+			name:      "repeated report of a refunded cancelled order",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusCancelled, PaymentID: paymentID("pay_1"), RefundStatus: models.RefundStatusRefunded}, nil)
+			},
+		},
+		{
+			name:      "completed payment a cancelled order does not use",
+			paymentID: "pay_2",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusCancelled, PaymentID: paymentID("pay_1"), RefundStatus: models.RefundStatusVoided}, nil)
+				p.EXPECT().GetPayment("pay_2").Return(&contracts.PaymentResponse{PaymentID: "pay_2", Status: contracts.PaymentStatusCompleted}, nil)
+				p.EXPECT().RefundPayment("pay_2", gomock.Any()).Return(&contracts.RefundResponse{RefundID: "re_2"}, nil)
+			},
+		},
+		{
+			name:      "delivered order",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusFailed,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(&models.Order{ID: 1, Status: models.StatusDelivered, PaymentID: paymentID("pay_1")}, nil)
+			},
+			wantErr: ErrInvalidTransition,
+		},
+		{
+			name:      "unknown order",
+			paymentID: "pay_1",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				m.EXPECT().GetByID("1").Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantErr: ErrOrderNotFound,
+		},
+		{
+			name:      "unknown status",
+			paymentID: "pay_1",
+			status:    "pending",
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {},
+			wantErr:   ErrInvalidPayment,
+		},
+		{
+			name:      "missing payment ID",
+			status:    contracts.PaymentStatusCompleted,
+			mockSetup: func(m *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {},
+			wantErr:   ErrInvalidPayment,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := mocks.NewMockOrderRepository(ctrl)
+			mockPayments := mocks.NewMockPaymentClient(ctrl)
+			tt.mockSetup(mockRepo, mockPayments)
+			svc := NewOrderService(mockRepo, mockPayments, testMenu, nil)
+			err := svc.ProcessPayment("1", tt.paymentID, tt.status)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOrderService_RetryPayment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	failedPayment := "pay_1"
+	retryEvent := &models.OrderStatusEvent{OrderID: 1, FromStatus: models.StatusPaymentFailed, ToStatus: models.StatusPending, ActorID: 5, Reason: "payment retried"}
+	amount := money.MustParse("20.00", "USD")
+
+	tests := []struct {
+		name          string
+		order         *models.Order
+		findErr       error
+		mockSetup     func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient)
+		wantErr       error
+		wantStatus    models.OrderStatus
+		wantPaymentID string
+	}{
+		{
+			name:  "paid on retry",
+			order: &models.Order{ID: 1, UserID: 5, Status: models.StatusPaymentFailed, PaymentID: &failedPayment, TotalAmount: amount},
+			mockSetup: func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				r.EXPECT().UpdateStatus(retryEvent).Return(nil)
+				p.EXPECT().CreatePayment(contracts.PaymentRequest{OrderID: "1", Amount: amount}).
+					Return(&contracts.PaymentResponse{PaymentID: "pay_2", Status: contracts.PaymentStatusCompleted}, nil)
+				r.EXPECT().UpdatePaymentID("1", "pay_2").Return(nil)
+				r.EXPECT().GetByID("1").Return(&models.Order{ID: 1, UserID: 5, Status: models.StatusPending}, nil)
+				r.EXPECT().UpdateStatus(gomock.Any()).Return(nil)
+			},
+			wantStatus:    models.StatusPaid,
+			wantPaymentID: "pay_2",
+		},
+		{
+			name:  "declined again",
+			order: &models.Order{ID: 1, UserID: 5, Status: models.StatusPaymentFailed, TotalAmount: amount},
+			mockSetup: func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				r.EXPECT().UpdateStatus(retryEvent).Return(nil)
+				p.EXPECT().CreatePayment(gomock.Any()).Return(nil, &external.StatusError{StatusCode: http.StatusPaymentRequired})
+				r.EXPECT().UpdateStatus(&models.OrderStatusEvent{OrderID: 1, FromStatus: models.StatusPending, ToStatus: models.StatusPaymentFailed, ActorID: models.SystemActor, Reason: "payment declined"}).Return(nil)
+			},
+			wantStatus: models.StatusPaymentFailed,
+		},
+		{
+			name:  "concurrent retry",
+			order: &models.Order{ID: 1, UserID: 5, Status: models.StatusPaymentFailed, TotalAmount: amount},
+			mockSetup: func(r *mocks.MockOrderRepository, p *mocks.MockPaymentClient) {
+				r.EXPECT().UpdateStatus(retryEvent).Return(repository.ErrStatusConflict)
+			},
+			wantErr: ErrPaymentNotRetryable,
+		},
+		{
+			name:    "pending order",
+			order:   &models.Order{ID: 1, UserID: 5, Status: models.StatusPending},
+			wantErr: ErrPaymentNotRetryable,
+		},
+		{
+			name:    "paid order",
+			order:   &models.Order{ID: 1, UserID: 5, Status: models.StatusPaid, PaymentID: &failedPayment},
+			wantErr: ErrPaymentNotRetryable,
+		},
+		{
+			name:    "someone else's order",
+			order:   &models.Order{ID: 1, UserID: 6, Status: models.StatusPaymentFailed},
+			wantErr: ErrOrderNotFound,
+		},
+		{
+			name:    "not found",
+			findErr: gorm.ErrRecordNotFound,
+			wantErr: ErrOrderNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := mocks.NewMockOrderRepository(ctrl)
+			mockPayments := mocks.NewMockPaymentClient(ctrl)
+			mockRepo.EXPECT().GetByID("1").Return(tt.order, tt.findErr)
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockRepo, mockPayments)
+			}
+			svc := NewOrderService(mockRepo, mockPayments, nil, nil)
+			order, err := svc.RetryPayment("1", 5)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, order.Status)
+			if tt.wantPaymentID != "" {
+				assert.Equal(t, tt.wantPaymentID, *order.PaymentID)
+			}
+		})
+	}
+}
+
+func TestOrderService_AssignCourier(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	restaurant := auth.Principal{UserID: 8, Role: auth.RoleRestaurant}
+	tests := []struct {
+		name      string
+		caller    auth.Principal
+		courierID uint
+		order     *models.Order
+		mockSetup func(m *mocks.MockOrderRepository)
+		wantErr   error
+	}{
+		{
+			name:      "restaurant assigns its order",
+			caller:    restaurant,
+			courierID: 9,
+			order:     &models.Order{ID: 1, RestaurantID: 8, Status: models.StatusPreparing},
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				m.EXPECT().UpdateCourier("1", uint(9)).Return(nil)
+			},
+		},
+		{
+			name:      "admin assigns any order",
+			caller:    auth.Principal{UserID: 5, Role: auth.RoleAdmin},
+			courierID: 9,
+			order:     &models.Order{ID: 1, RestaurantID: 7, Status: models.StatusPaid},
+			mockSetup: func(m *mocks.MockOrderRepository) {
+				m.EXPECT().UpdateCourier("1", uint(9)).Return(nil)
+			},
+		},
+		{
+			name:      "order of another restaurant",
+			caller:    restaurant,
+			courierID: 9,
+			order:     &models.Order{ID: 1, RestaurantID: 7, Status: models.StatusPaid},
+			wantErr:   ErrOrderNotFound,
+		},
+		{
+			name:      "unpaid order",
+			caller:    restaurant,
+			courierID: 9,
+			order:     &models.Order{ID: 1, RestaurantID: 8, Status: models.StatusPending},
+			wantErr:   ErrCourierNotAllowed,
+		},
+		{
+			name:    "missing courier",
+			caller:  restaurant,
+			wantErr: ErrInvalidCourier,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := mocks.NewMockOrderRepository(ctrl)
+			if tt.order != nil {
+				mockRepo.EXPECT().GetByID("1").Return(tt.order, nil)
+			}
+			if tt.mockSetup != nil {
+				tt.mockSetup(mockRepo)
+			}
+			svc := NewOrderService(mockRepo, nil, nil, nil)
+			order, err := svc.AssignCourier("1", tt.courierID, tt.caller)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, &tt.courierID, order.CourierID)
+		})
+	}
+}
+
+// TestOrderService_CancelThenPaid covers an order cancelled while its payment
+// was still pending: the payment cannot be given back then, so the refund is
+// made when payment-service reports that it completed.
+func TestOrderService_CancelThenPaid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockOrderRepository(ctrl)
+	mockPayments := mocks.NewMockPaymentClient(ctrl)
+	svc := NewOrderService(mockRepo, mockPayments, nil, nil)
+
+	paymentID, refundID := "pay_1", "re_1"
+	stored := models.Order{ID: 1, UserID: 5, Status: models.StatusPending, PaymentID: &paymentID}
+	mockRepo.EXPECT().GetByID("1").DoAndReturn(func(string) (*models.Order, error) {
+		order := stored
+		return &order, nil
+	}).Times(2)
+	mockRepo.EXPECT().UpdateStatus(gomock.Any()).DoAndReturn(func(event *models.OrderStatusEvent) error {
+		stored.Status = event.ToStatus
+		return nil
+	})
+	mockRepo.EXPECT().UpdateRefund("1", gomock.Any(), gomock.Any()).DoAndReturn(func(_ string, status models.RefundStatus, id *string) error {
+		stored.RefundStatus, stored.RefundID = status, id
+		return nil
+	}).Times(2)
+
+	mockPayments.EXPECT().GetPayment(paymentID).Return(&contracts.PaymentResponse{PaymentID: paymentID, Status: contracts.PaymentStatusPending}, nil)
+	_, err := svc.CancelOrder("1", 5, "changed my mind")
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusCancelled, stored.Status)
+	assert.Equal(t, models.RefundStatusFailed, stored.RefundStatus)
+
+	mockPayments.EXPECT().GetPayment(paymentID).Return(&contracts.PaymentResponse{PaymentID: paymentID, Status: contracts.PaymentStatusCompleted}, nil)
+	mockPayments.EXPECT().RefundPayment(paymentID, gomock.Any()).Return(&contracts.RefundResponse{RefundID: refundID}, nil)
+	assert.NoError(t, svc.ProcessPayment("1", paymentID, contracts.PaymentStatusCompleted))
+	assert.Equal(t, models.StatusCancelled, stored.Status)
+	assert.Equal(t, models.RefundStatusRefunded, stored.RefundStatus)
+	assert.Equal(t, &refundID, stored.RefundID)
 }
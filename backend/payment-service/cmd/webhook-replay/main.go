@@ -0,0 +1,63 @@
+// Command webhook-replay signs webhook fixtures the way the payment gateway
+// does and posts them to a running payment-service, for local testing.
+//
+//	WEBHOOK_SECRET=whsec go run ./cmd/webhook-replay webhook/testdata/payment_succeeded.json
+//
+// With -print the signed requests are written as curl commands instead of
+// being sent.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"payment-service/webhook"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8083/payments/webhook", "webhook endpoint")
+	secret := flag.String("secret", os.Getenv("WEBHOOK_SECRET"), "signing secret (default $WEBHOOK_SECRET)")
+	skew := flag.Duration("skew", 0, "shift the signature timestamp, e.g. -10m to test the tolerance")
+	printOnly := flag.Bool("print", false, "print curl commands instead of sending")
+	flag.Parse()
+
+	if *secret == "" || flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: webhook-replay [-url URL] [-secret SECRET] [-skew D] [-print] fixture.json...")
+		os.Exit(2)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, path := range flag.Args() {
+		payload, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		signature := webhook.Sign(*secret, time.Now().Add(*skew), payload)
+
+		if *printOnly {
+			fmt.Printf("curl -X POST %s -H 'Content-Type: application/json' -H '%s: %s' --data-binary @%s\n",
+				*url, webhook.SignatureHeader, signature, path)
+			continue
+		}
+
+		req, err := http.NewRequest(http.MethodPost, *url, bytes.NewReader(payload))
+		if err != nil {
+			log.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(webhook.SignatureHeader, signature)
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		fmt.Printf("%s: %s %s\n", path, resp.Status, bytes.TrimSpace(body))
+	}
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"payment-service/external"
+	"zamato/pkg/auth"
+	"zamato/pkg/server"
+)
+
+// Config holds the runtime settings of payment-service, read from the
+// environment.
+type Config struct {
+	Port        string
+	DatabaseURL string
+	Auth        auth.Config
+	// IdempotencyTTL is how long Idempotency-Key responses are kept for replay.
+	// IdempotencyLockTimeout is how long a request may hold its key before a
+	// retry may take it over.
+	IdempotencyTTL         time.Duration
+	IdempotencyLockTimeout time.Duration
+	// DefaultCurrency is assumed for amounts stored before they carried a
+	// currency.
+	DefaultCurrency string
+	// WebhookSecret signs gateway webhooks; WebhookTolerance is how far their
+	// timestamp may be from now.
+	WebhookSecret    string
+	WebhookTolerance time.Duration
+	// Routing chooses among the registered gateways, "dummy" and
+	// "simulator", for each payment.
+	Routing   external.RoutingPolicy
+	Simulator external.SimulatorConfig
+	// Orders is where payment outcomes are reported back to order-service.
+	Orders    external.OrderClientConfig
+	Callbacks CallbackConfig
+	Server    server.Config
+}
+
+// CallbackConfig controls the relay that delivers order callbacks from the
+// outbox table.
+type CallbackConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+// Load reads the configuration from the environment. Settings that cannot
+// be parsed but have a safe default are logged and defaulted. An invalid
+// GATEWAY_ROUTES is an error, since it would silently reroute payments, and
+// so are callback relay settings that parse but cannot work.
+func Load() (Config, error) {
+	routes, err := getRoutes("GATEWAY_ROUTES")
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{
+		Port:                   getEnv("PORT", "8080"),
+		DatabaseURL:            os.Getenv("DATABASE_URL"),
+		IdempotencyTTL:         getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		IdempotencyLockTimeout: getDuration("IDEMPOTENCY_LOCK_TIMEOUT", 2*time.Minute),
+		DefaultCurrency:        getEnv("DEFAULT_CURRENCY", "USD"),
+		WebhookSecret:          os.Getenv("WEBHOOK_SECRET"),
+		WebhookTolerance:       getDuration("WEBHOOK_TOLERANCE", 5*time.Minute),
+		Routing: external.RoutingPolicy{
+			Default:  getEnv("GATEWAY", "dummy"),
+			Fallback: os.Getenv("GATEWAY_FALLBACK"),
+			Routes:   routes,
+		},
+		Auth: auth.Config{
+			HMACSecret:       os.Getenv("JWT_SECRET"),
+			RSAPublicKeyFile: os.Getenv("JWT_PUBLIC_KEY_FILE"),
+			JWKSURL:          os.Getenv("JWT_JWKS_URL"),
+			Issuer:           os.Getenv("JWT_ISSUER"),
+			Leeway:           getDuration("JWT_LEEWAY", 30*time.Second),
+			ServiceName:      getEnv("SERVICE_NAME", "payment-service"),
+			ServiceSecret:    os.Getenv("SERVICE_TOKEN_SECRET"),
+			TrustedServices:  getList("TRUSTED_SERVICES", []string{"order-service"}),
+			ServiceTokenTTL:  getDuration("SERVICE_TOKEN_TTL", 5*time.Minute),
+		},
+	}
+	cfg.Simulator = external.SimulatorConfig{
+		WebhookURL:          getEnv("SIMULATOR_WEBHOOK_URL", "http://localhost:"+cfg.Port+"/payments/webhook"),
+		WebhookSecret:       cfg.WebhookSecret,
+		WebhookDelay:        getDuration("SIMULATOR_WEBHOOK_DELAY", 2*time.Second),
+		DelayedWebhookDelay: getDuration("SIMULATOR_DELAYED_WEBHOOK_DELAY", 30*time.Second),
+		WebhookRetries:      3,
+		Timeout:             getDuration("SIMULATOR_TIMEOUT", 30*time.Second),
+	}
+	cfg.Server = server.Config{
+		ReadHeaderTimeout: getDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       getDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:      getDuration("HTTP_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:       getDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+		DrainDelay:        getDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		ShutdownTimeout:   getDuration("SHUTDOWN_TIMEOUT", 20*time.Second),
+		CheckTimeout:      getDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+	}
+	cfg.Orders = external.OrderClientConfig{
+		BaseURL:     getEnv("ORDER_SERVICE_URL", "http://localhost:8082/api/v1"),
+		ServiceName: getEnv("ORDER_SERVICE_NAME", "order-service"),
+		Timeout:     getDuration("ORDER_CALLBACK_TIMEOUT", 5*time.Second),
+	}
+	cfg.Callbacks = CallbackConfig{
+		PollInterval: getDuration("ORDER_CALLBACK_POLL_INTERVAL", 2*time.Second),
+		BatchSize:    getInt("ORDER_CALLBACK_BATCH_SIZE", 100),
+	}
+	if cfg.DatabaseURL == "" {
+		cfg.DatabaseURL = "host=localhost user=glassbreak password=glassbreak dbname=glassbreak port=5432 sslmode=disable"
+		log.Println("DATABASE_URL not set, using glassbreak fallback config")
+	}
+	if cfg.Callbacks.PollInterval <= 0 {
+		return Config{}, fmt.Errorf("ORDER_CALLBACK_POLL_INTERVAL must be positive, got %s", cfg.Callbacks.PollInterval)
+	}
+	if cfg.Callbacks.BatchSize <= 0 {
+		return Config{}, fmt.Errorf("ORDER_CALLBACK_BATCH_SIZE must be positive, got %d", cfg.Callbacks.BatchSize)
+	}
+	if cfg.IdempotencyLockTimeout <= 0 {
+		return Config{}, fmt.Errorf("IDEMPOTENCY_LOCK_TIMEOUT must be positive, got %s", cfg.IdempotencyLockTimeout)
+	}
+	return cfg, nil
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("invalid duration %q for %s, using %s", v, key, fallback)
+		return fallback
+	}
+	return d
+}
+
+func getInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("invalid integer %q for %s, using %d", v, key, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getList reads a comma-separated list, ignoring empty entries.
+func getList(key string, fallback []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getRoutes reads a JSON array of routes, e.g.
+// [{"currency": "EUR", "providers": [{"name": "simulator", "weight": 1}]}].
+func getRoutes(key string) ([]external.Route, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil, nil
+	}
+	var routes []external.Route
+	if err := json.Unmarshal([]byte(v), &routes); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return routes, nil
+}
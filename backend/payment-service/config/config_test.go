@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_GatewayRoutes(t *testing.T) {
+	t.Setenv("GATEWAY_ROUTES", `[{"currency": "EUR", "providers": [{"name": "simulator", "weight": 1}]}]`)
+	cfg, err := Load()
+	assert.NoError(t, err)
+	if assert.Len(t, cfg.Routing.Routes, 1) {
+		assert.Equal(t, "EUR", cfg.Routing.Routes[0].Currency)
+	}
+
+	t.Setenv("GATEWAY_ROUTES", `[{"currency": "EUR"`)
+	_, err = Load()
+	assert.ErrorContains(t, err, "GATEWAY_ROUTES")
+}
+
+func TestLoad_Callbacks(t *testing.T) {
+	tests := []struct {
+		key, value string
+	}{
+		{"ORDER_CALLBACK_POLL_INTERVAL", "0s"},
+		{"ORDER_CALLBACK_POLL_INTERVAL", "-1s"},
+		{"ORDER_CALLBACK_BATCH_SIZE", "0"},
+		{"ORDER_CALLBACK_BATCH_SIZE", "-5"},
+		{"IDEMPOTENCY_LOCK_TIMEOUT", "0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			_, err := Load()
+			assert.ErrorContains(t, err, tt.key)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OrderNotifier tells order-service that a payment of one of its orders
+// completed or failed. Callbacks are delivered by outbox.Relay, which
+// retries them until order-service accepts or definitively refuses them.
+type OrderNotifier interface {
+	NotifyPayment(ctx context.Context, orderID, paymentID, status string) error
+}
+
+// OrderClientConfig configures the callbacks to order-service. ServiceName is
+// the name order-service accepts service tokens for.
+type OrderClientConfig struct {
+	BaseURL     string
+	ServiceName string
+	Timeout     time.Duration
+}
+
+// TokenSource supplies the service tokens payment-service presents to the
+// services it calls.
+type TokenSource interface {
+	Token(audience string) (string, error)
+}
+
+// StatusError is returned when order-service answers a callback with a
+// non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("order-service returned %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether sending the same callback again may succeed.
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+type orderClient struct {
+	cfg    OrderClientConfig
+	tokens TokenSource
+	client *http.Client
+}
+
+// NewOrderClient returns a notifier that calls order-service's
+// POST /orders/{id}/payment with a service token from tokens.
+func NewOrderClient(cfg OrderClientConfig, tokens TokenSource) OrderNotifier {
+	return &orderClient{
+		cfg:    cfg,
+		tokens: tokens,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+type paymentCallback struct {
+	PaymentID string `json:"payment_id"`
+	Status    string `json:"status"`
+}
+
+// NotifyPayment sends the callback once. Network errors and *StatusError
+// values with Retryable set are transient.
+func (c *orderClient) NotifyPayment(ctx context.Context, orderID, paymentID, status string) error {
+	body, err := json.Marshal(paymentCallback{PaymentID: paymentID, Status: status})
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(c.cfg.BaseURL, "/") + "/orders/" + url.PathEscape(orderID) + "/payment"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token, err := c.tokens.Token(c.cfg.ServiceName)
+	if err != nil {
+		return fmt.Errorf("service token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
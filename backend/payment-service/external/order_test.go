@@ -0,0 +1,65 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticTokens string
+
+func (s staticTokens) Token(audience string) (string, error) {
+	return string(s) + "-for-" + audience, nil
+}
+
+func TestOrderClient_NotifyPayment(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantErr       bool
+		wantRetryable bool
+	}{
+		{name: "success", status: http.StatusNoContent},
+		{name: "5xx is retryable", status: http.StatusServiceUnavailable, wantErr: true, wantRetryable: true},
+		{name: "429 is retryable", status: http.StatusTooManyRequests, wantErr: true, wantRetryable: true},
+		{name: "4xx is not retryable", status: http.StatusConflict, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/api/v1/orders/42/payment", r.URL.Path)
+				assert.Equal(t, "Bearer svc-for-order-service", r.Header.Get("Authorization"))
+
+				var body paymentCallback
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				assert.Equal(t, paymentCallback{PaymentID: "pay_1", Status: "completed"}, body)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			c := NewOrderClient(OrderClientConfig{
+				BaseURL:     srv.URL + "/api/v1",
+				ServiceName: "order-service",
+				Timeout:     time.Second,
+			}, staticTokens("svc"))
+
+			err := c.NotifyPayment(context.Background(), "42", "pay_1", "completed")
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			var statusErr *StatusError
+			if assert.True(t, errors.As(err, &statusErr)) {
+				assert.Equal(t, tt.status, statusErr.StatusCode)
+				assert.Equal(t, tt.wantRetryable, statusErr.Retryable())
+			}
+		})
+	}
+}
@@ -1,19 +1,160 @@
 package external
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"zamato/pkg/money"
+
+	"github.com/google/uuid"
+)
+
+// Errors a gateway may return. Declines, including ErrInsufficientFunds and
+// ErrAuthenticationRequired, match ErrDeclined with errors.Is.
+var (
+	ErrDeclined               = errors.New("card declined")
+	ErrInsufficientFunds      = fmt.Errorf("%w: insufficient funds", ErrDeclined)
+	ErrAuthenticationRequired = fmt.Errorf("%w: 3-D Secure authentication required", ErrDeclined)
+	ErrGatewayTimeout         = errors.New("gateway timed out")
+	// ErrCapturePending comes with a transaction ID when the gateway accepted
+	// a capture but reports its outcome later with a webhook.
+	ErrCapturePending = errors.New("capture pending")
 )
 
+// Retryable reports whether err is a transient failure of the gateway, so
+// that another provider may succeed where this one did not. Errors can say
+// so themselves with a Retryable method.
+func Retryable(err error) bool {
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	return errors.Is(err, ErrGatewayTimeout)
+}
+
+// PaymentGateway moves money through a payment provider in two phases: an
+// authorization places a hold on the customer's funds, and a capture (full
+// or partial) charges them. An authorization that is no longer needed is
+// voided. Captured money can be refunded, possibly in several parts.
 type PaymentGateway interface {
-	Process(amount float64) (string, error)
+	// Authorize places a hold of amount on paymentMethod, a card token, and
+	// returns the authorization ID. reference identifies the payment on the
+	// gateway side and comes back in its webhooks.
+	Authorize(amount money.Money, paymentMethod, reference string) (string, error)
+	// Capture charges amount, at most the authorized amount, and returns the
+	// transaction ID. Whatever is not captured is released.
+	Capture(authorizationID string, amount money.Money) (string, error)
+	// Void releases an authorization that has not been captured.
+	Void(authorizationID string) error
+	// Refund returns amount of a captured transaction and returns the refund's
+	// transaction ID. reference identifies the refund in webhooks.
+	Refund(transactionID string, amount money.Money, reference string) (string, error)
 }
 
-type DummyGateway struct{}
+// HealthChecker is implemented by gateways that can tell whether they are
+// able to take payments. Gateways that do not implement it, such as
+// DummyGateway, which never leaves the process, are assumed to be.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
 
-func (g *DummyGateway) Process(amount float64) (string, error) {
+// GatewayCheck returns a health check of gateway.
+func GatewayCheck(gateway PaymentGateway) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if checker, ok := gateway.(HealthChecker); ok {
+			return checker.CheckHealth(ctx)
+		}
+		return nil
+	}
+}
+
+// DummyGateway simulates a gateway in memory. It enforces the same rules a
+// real gateway would (no capture above the authorized amount, no void after
+// capture, no refund above the captured amount) but never contacts anyone.
+// IDs it did not issue itself, e.g. from before a restart, are accepted
+// without checks. The zero value is ready to use.
+type DummyGateway struct {
+	mu             sync.Mutex
+	authorizations map[string]*dummyAuthorization
+	transactions   map[string]*dummyTransaction
+}
+
+type dummyAuthorization struct {
+	amount money.Money
+	done   bool
+}
+
+type dummyTransaction struct {
+	captured money.Money
+	refunded money.Money
+}
+
+func (g *DummyGateway) Authorize(amount money.Money, paymentMethod, reference string) (string, error) {
 	// Simulate payment processing
-	if amount <= 0 {
+	if !amount.IsPositive() {
 		return "", fmt.Errorf("invalid amount")
 	}
-	return "dummy-transaction-id", nil
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.authorizations == nil {
+		g.authorizations = make(map[string]*dummyAuthorization)
+	}
+	id := "auth_" + uuid.NewString()
+	g.authorizations[id] = &dummyAuthorization{amount: amount}
+	return id, nil
+}
+
+func (g *DummyGateway) Capture(authorizationID string, amount money.Money) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !amount.IsPositive() {
+		return "", fmt.Errorf("invalid capture amount %s", amount)
+	}
+	if auth, ok := g.authorizations[authorizationID]; ok {
+		if auth.done {
+			return "", fmt.Errorf("authorization %s was already captured or voided", authorizationID)
+		}
+		if cmp, err := amount.Cmp(auth.amount); err != nil || cmp > 0 {
+			return "", fmt.Errorf("invalid capture amount %s for authorization of %s", amount, auth.amount)
+		}
+		auth.done = true
+	}
+	if g.transactions == nil {
+		g.transactions = make(map[string]*dummyTransaction)
+	}
+	id := "txn_" + uuid.NewString()
+	g.transactions[id] = &dummyTransaction{captured: amount, refunded: money.Zero(amount.Currency)}
+	return id, nil
+}
+
+func (g *DummyGateway) Void(authorizationID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if auth, ok := g.authorizations[authorizationID]; ok {
+		if auth.done {
+			return fmt.Errorf("authorization %s was already captured or voided", authorizationID)
+		}
+		auth.done = true
+	}
+	return nil
+}
+
+func (g *DummyGateway) Refund(transactionID string, amount money.Money, reference string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !amount.IsPositive() {
+		return "", fmt.Errorf("invalid refund amount %s", amount)
+	}
+	if txn, ok := g.transactions[transactionID]; ok {
+		refunded, err := txn.refunded.Add(amount)
+		if err != nil {
+			return "", err
+		}
+		if cmp, _ := refunded.Cmp(txn.captured); cmp > 0 {
+			return "", fmt.Errorf("invalid refund amount %s for transaction of %s", amount, txn.captured)
+		}
+		txn.refunded = refunded
+	}
+	return "re_" + uuid.NewString(), nil
 }
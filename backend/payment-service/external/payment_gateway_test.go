@@ -0,0 +1,53 @@
+package external
+
+import (
+	"testing"
+	"zamato/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDummyGateway(t *testing.T) {
+	var g DummyGateway
+	usd := func(amount string) money.Money { return money.MustParse(amount, "USD") }
+
+	t.Run("capture, refund", func(t *testing.T) {
+		auth, err := g.Authorize(usd("100.00"), "tok_visa", "p1")
+		assert.NoError(t, err)
+
+		_, err = g.Capture(auth, usd("100.01"))
+		assert.Error(t, err)
+		txn, err := g.Capture(auth, usd("80.00"))
+		assert.NoError(t, err)
+		_, err = g.Capture(auth, usd("20.00"))
+		assert.Error(t, err, "second capture")
+		assert.Error(t, g.Void(auth), "void after capture")
+
+		_, err = g.Refund(txn, usd("50.00"), "r1")
+		assert.NoError(t, err)
+		_, err = g.Refund(txn, usd("30.01"), "r1")
+		assert.Error(t, err, "refund above captured amount")
+		_, err = g.Refund(txn, usd("30.00"), "r1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("void", func(t *testing.T) {
+		auth, err := g.Authorize(usd("10.00"), "tok_visa", "p2")
+		assert.NoError(t, err)
+		assert.NoError(t, g.Void(auth))
+		_, err = g.Capture(auth, usd("10.00"))
+		assert.Error(t, err, "capture after void")
+	})
+
+	t.Run("invalid amounts", func(t *testing.T) {
+		_, err := g.Authorize(usd("0.00"), "tok_visa", "p3")
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown IDs are accepted", func(t *testing.T) {
+		_, err := g.Capture("auth_before_restart", usd("1.00"))
+		assert.NoError(t, err)
+		_, err = g.Refund("txn_before_restart", usd("1.00"), "r1")
+		assert.NoError(t, err)
+	})
+}
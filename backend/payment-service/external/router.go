@@ -0,0 +1,193 @@
+package external
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"zamato/pkg/money"
+)
+
+var ErrUnknownProvider = errors.New("unknown payment provider")
+
+// Registry holds the available gateways by provider name.
+type Registry struct {
+	gateways map[string]PaymentGateway
+}
+
+func NewRegistry() *Registry {
+	return &Registry{gateways: make(map[string]PaymentGateway)}
+}
+
+// Register adds gateway under name. Names must be unique.
+func (r *Registry) Register(name string, gateway PaymentGateway) error {
+	if name == "" {
+		return errors.New("provider name is required")
+	}
+	if _, ok := r.gateways[name]; ok {
+		return fmt.Errorf("provider %q is already registered", name)
+	}
+	r.gateways[name] = gateway
+	return nil
+}
+
+// Get returns the gateway registered under name.
+func (r *Registry) Get(name string) (PaymentGateway, error) {
+	gateway, ok := r.gateways[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+	return gateway, nil
+}
+
+// Names returns the registered provider names, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.gateways))
+	for name := range r.gateways {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RoutingPolicy chooses the provider of a payment. The first route that
+// matches the payment picks one of its providers by weight; without a
+// matching route Default is used. When the chosen provider fails with a
+// retryable error the payment is sent to the route's Fallback, or the
+// policy's.
+type RoutingPolicy struct {
+	Routes   []Route `json:"routes,omitempty"`
+	Default  string  `json:"default"`
+	Fallback string  `json:"fallback,omitempty"`
+}
+
+// Route matches payments on every condition that is set: the currency, a
+// minimum amount (in the same currency) and a card token prefix.
+type Route struct {
+	Currency      string             `json:"currency,omitempty"`
+	MinAmount     *money.Money       `json:"min_amount,omitempty"`
+	PaymentMethod string             `json:"payment_method,omitempty"`
+	Providers     []WeightedProvider `json:"providers"`
+	Fallback      string             `json:"fallback,omitempty"`
+}
+
+// WeightedProvider is a provider of a route with its share of the traffic,
+// relative to the other providers of the route.
+type WeightedProvider struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+func (r Route) matches(amount money.Money, paymentMethod string) bool {
+	if r.Currency != "" && r.Currency != amount.Currency {
+		return false
+	}
+	if r.MinAmount != nil {
+		if cmp, err := amount.Cmp(*r.MinAmount); err != nil || cmp < 0 {
+			return false
+		}
+	}
+	return strings.HasPrefix(paymentMethod, r.PaymentMethod)
+}
+
+// Router sends each authorization to the provider chosen by its policy and
+// the later operations of a payment to the provider that authorized it.
+type Router struct {
+	registry *Registry
+	policy   RoutingPolicy
+	intn     func(n int) int
+}
+
+// NewRouter checks that every provider named by policy is registered.
+func NewRouter(registry *Registry, policy RoutingPolicy) (*Router, error) {
+	names := []string{policy.Default}
+	if policy.Fallback != "" {
+		names = append(names, policy.Fallback)
+	}
+	for i, route := range policy.Routes {
+		total := 0
+		for _, p := range route.Providers {
+			if p.Weight < 0 {
+				return nil, fmt.Errorf("route %d: negative weight for %q", i, p.Name)
+			}
+			total += p.Weight
+			names = append(names, p.Name)
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("route %d: needs a provider with a positive weight", i)
+		}
+		if route.Fallback != "" {
+			names = append(names, route.Fallback)
+		}
+	}
+	for _, name := range names {
+		if _, err := registry.Get(name); err != nil {
+			return nil, err
+		}
+	}
+	return &Router{registry: registry, policy: policy, intn: rand.Intn}, nil
+}
+
+// Authorize authorizes amount with the provider the policy chooses, failing
+// over once on a retryable error, and returns the provider that holds the
+// authorization.
+func (r *Router) Authorize(amount money.Money, paymentMethod, reference string) (provider, authorizationID string, err error) {
+	primary, fallback := r.choose(amount, paymentMethod)
+	gateway, err := r.registry.Get(primary)
+	if err != nil {
+		return "", "", err
+	}
+	authorizationID, err = gateway.Authorize(amount, paymentMethod, reference)
+	if err == nil || !Retryable(err) || fallback == "" || fallback == primary {
+		return primary, authorizationID, err
+	}
+
+	log.Printf("provider %s failed for payment %s, failing over to %s: %v", primary, reference, fallback, err)
+	gateway, err = r.registry.Get(fallback)
+	if err != nil {
+		return "", "", err
+	}
+	authorizationID, err = gateway.Authorize(amount, paymentMethod, reference)
+	return fallback, authorizationID, err
+}
+
+// Gateway returns the gateway of provider. Payments made before providers
+// were recorded have none and belong to the default provider.
+func (r *Router) Gateway(provider string) (PaymentGateway, error) {
+	if provider == "" {
+		provider = r.policy.Default
+	}
+	return r.registry.Get(provider)
+}
+
+// choose returns the primary and fallback provider of a payment.
+func (r *Router) choose(amount money.Money, paymentMethod string) (string, string) {
+	for _, route := range r.policy.Routes {
+		if !route.matches(amount, paymentMethod) {
+			continue
+		}
+		fallback := route.Fallback
+		if fallback == "" {
+			fallback = r.policy.Fallback
+		}
+		return r.pick(route.Providers), fallback
+	}
+	return r.policy.Default, r.policy.Fallback
+}
+
+func (r *Router) pick(providers []WeightedProvider) string {
+	total := 0
+	for _, p := range providers {
+		total += p.Weight
+	}
+	n := r.intn(total)
+	for _, p := range providers {
+		if n < p.Weight {
+			return p.Name
+		}
+		n -= p.Weight
+	}
+	return providers[len(providers)-1].Name
+}
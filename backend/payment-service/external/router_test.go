@@ -0,0 +1,151 @@
+package external
+
+import (
+	"testing"
+	"zamato/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubGateway authorizes with a fixed result.
+type stubGateway struct {
+	DummyGateway
+	err   error
+	calls int
+}
+
+func (g *stubGateway) Authorize(amount money.Money, paymentMethod, reference string) (string, error) {
+	g.calls++
+	if g.err != nil {
+		return "", g.err
+	}
+	return g.DummyGateway.Authorize(amount, paymentMethod, reference)
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register("b", &DummyGateway{}))
+	assert.NoError(t, r.Register("a", &DummyGateway{}))
+	assert.Error(t, r.Register("a", &DummyGateway{}), "duplicate")
+	assert.Error(t, r.Register("", &DummyGateway{}), "no name")
+
+	assert.Equal(t, []string{"a", "b"}, r.Names())
+	_, err := r.Get("c")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestNewRouter_Validates(t *testing.T) {
+	r := NewRegistry()
+	r.Register("dummy", &DummyGateway{})
+
+	_, err := NewRouter(r, RoutingPolicy{Default: "stripe"})
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+	_, err = NewRouter(r, RoutingPolicy{Default: "dummy", Routes: []Route{{Providers: []WeightedProvider{{Name: "dummy"}}}}})
+	assert.Error(t, err, "no positive weight")
+	_, err = NewRouter(r, RoutingPolicy{Default: "dummy", Routes: []Route{{Providers: []WeightedProvider{{Name: "dummy", Weight: 1}}, Fallback: "adyen"}}})
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestRouter_Authorize(t *testing.T) {
+	usd := func(amount string) money.Money { return money.MustParse(amount, "USD") }
+	threshold := usd("500.00")
+
+	tests := []struct {
+		name          string
+		amount        money.Money
+		paymentMethod string
+		roll          int
+		failing       map[string]error
+		wantProvider  string
+		wantErr       error
+	}{
+		{name: "default", amount: usd("10.00"), wantProvider: "primary"},
+		{name: "by currency", amount: money.MustParse("10.00", "EUR"), wantProvider: "europe"},
+		{name: "by amount threshold", amount: usd("500.00"), wantProvider: "large"},
+		{name: "below threshold", amount: usd("499.99"), wantProvider: "primary"},
+		{name: "by payment method", amount: usd("10.00"), paymentMethod: "tok_amex_123", wantProvider: "amex"},
+		{name: "weighted, first share", amount: money.MustParse("10.00", "GBP"), roll: 89, wantProvider: "primary"},
+		{name: "weighted, second share", amount: money.MustParse("10.00", "GBP"), roll: 90, wantProvider: "large"},
+		{
+			name:         "fails over on timeout",
+			amount:       usd("10.00"),
+			failing:      map[string]error{"primary": ErrGatewayTimeout},
+			wantProvider: "backup",
+		},
+		{
+			name:         "route fallback",
+			amount:       money.MustParse("10.00", "EUR"),
+			failing:      map[string]error{"europe": ErrGatewayTimeout},
+			wantProvider: "primary",
+		},
+		{
+			name:    "no failover on decline",
+			amount:  usd("10.00"),
+			failing: map[string]error{"primary": ErrDeclined},
+			wantErr: ErrDeclined,
+		},
+		{
+			name:    "fallback fails too",
+			amount:  usd("10.00"),
+			failing: map[string]error{"primary": ErrGatewayTimeout, "backup": ErrGatewayTimeout},
+			wantErr: ErrGatewayTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			gateways := map[string]*stubGateway{}
+			for _, name := range []string{"primary", "backup", "europe", "large", "amex"} {
+				gateways[name] = &stubGateway{err: tt.failing[name]}
+				registry.Register(name, gateways[name])
+			}
+			router, err := NewRouter(registry, RoutingPolicy{
+				Default:  "primary",
+				Fallback: "backup",
+				Routes: []Route{
+					{Currency: "EUR", Providers: []WeightedProvider{{Name: "europe", Weight: 1}}, Fallback: "primary"},
+					{MinAmount: &threshold, Providers: []WeightedProvider{{Name: "large", Weight: 1}}},
+					{PaymentMethod: "tok_amex", Providers: []WeightedProvider{{Name: "amex", Weight: 1}}},
+					{Currency: "GBP", Providers: []WeightedProvider{{Name: "primary", Weight: 90}, {Name: "large", Weight: 10}}},
+				},
+			})
+			assert.NoError(t, err)
+			router.intn = func(n int) int { return tt.roll % n }
+
+			provider, authID, err := router.Authorize(tt.amount, tt.paymentMethod, "p1")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantProvider, provider)
+			assert.NotEmpty(t, authID)
+
+			gateway, err := router.Gateway(provider)
+			assert.NoError(t, err)
+			assert.Same(t, gateways[tt.wantProvider], gateway)
+		})
+	}
+}
+
+func TestRouter_Gateway(t *testing.T) {
+	registry := NewRegistry()
+	dummy := &DummyGateway{}
+	registry.Register("dummy", dummy)
+	router, err := NewRouter(registry, RoutingPolicy{Default: "dummy"})
+	assert.NoError(t, err)
+
+	got, err := router.Gateway("")
+	assert.NoError(t, err, "payments without a provider use the default")
+	assert.Same(t, dummy, got)
+
+	_, err = router.Gateway("removed")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, Retryable(ErrGatewayTimeout))
+	assert.False(t, Retryable(ErrDeclined))
+	assert.False(t, Retryable(errSimulatedFailure))
+}
@@ -0,0 +1,289 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"payment-service/webhook"
+	"sync"
+	"time"
+	"zamato/pkg/money"
+
+	"github.com/google/uuid"
+)
+
+// SimulatorConfig configures the simulator gateway. Webhooks are posted to
+// WebhookURL, signed with WebhookSecret, WebhookDelay after the operation
+// they report (DelayedWebhookDelay for the delayed-webhook outcome). A
+// delivery that does not get a 2xx is retried up to WebhookRetries times,
+// doubling the delay each time. Timeout is how long the timeout outcome
+// hangs before failing.
+type SimulatorConfig struct {
+	WebhookURL          string
+	WebhookSecret       string
+	WebhookDelay        time.Duration
+	DelayedWebhookDelay time.Duration
+	WebhookRetries      int
+	Timeout             time.Duration
+}
+
+type simulatedOutcome int
+
+const (
+	outcomeSuccess simulatedOutcome = iota
+	outcomeDecline
+	outcomeInsufficientFunds
+	outcomeAuthenticationRequired
+	outcomeTimeout
+	outcomeDelayedWebhook
+	outcomeCaptureFailure
+	outcomeRefundFailure
+)
+
+// simulatorTokens are the card tokens that select an outcome. Other tokens
+// leave it to the amount.
+var simulatorTokens = map[string]simulatedOutcome{
+	"tok_success":            outcomeSuccess,
+	"tok_decline":            outcomeDecline,
+	"tok_insufficient_funds": outcomeInsufficientFunds,
+	"tok_3ds_required":       outcomeAuthenticationRequired,
+	"tok_timeout":            outcomeTimeout,
+	"tok_delayed_webhook":    outcomeDelayedWebhook,
+	"tok_capture_failure":    outcomeCaptureFailure,
+	"tok_refund_failure":     outcomeRefundFailure,
+}
+
+// simulatorAmounts are the amounts, in minor units of any currency, that
+// select an outcome when the card token does not, e.g. 100.01 USD declines.
+// Any other amount succeeds.
+var simulatorAmounts = map[int64]simulatedOutcome{
+	10001: outcomeDecline,
+	10002: outcomeInsufficientFunds,
+	10003: outcomeAuthenticationRequired,
+	10004: outcomeTimeout,
+	10005: outcomeDelayedWebhook,
+	10006: outcomeCaptureFailure,
+	10007: outcomeRefundFailure,
+}
+
+var errSimulatedFailure = errors.New("simulated gateway failure")
+
+// SimulatorGateway is a PaymentGateway for end-to-end testing. It follows
+// the rules of DummyGateway, produces the outcome selected by the card token
+// or amount of the authorization, and reports captures and refunds with
+// signed webhooks, asynchronously, like a real gateway would.
+type SimulatorGateway struct {
+	cfg    SimulatorConfig
+	client *http.Client
+	ledger DummyGateway
+
+	mu             sync.Mutex
+	authorizations map[string]simulatedPayment
+	transactions   map[string]simulatedPayment
+
+	// deliveries tracks the webhooks being sent; closing stopping makes
+	// those still waiting give up.
+	deliveries   sync.WaitGroup
+	stopping     chan struct{}
+	stoppingOnce sync.Once
+}
+
+// simulatedPayment is what the simulator remembers about an authorization or
+// a transaction.
+type simulatedPayment struct {
+	reference string
+	outcome   simulatedOutcome
+}
+
+func NewSimulatorGateway(cfg SimulatorConfig) *SimulatorGateway {
+	return &SimulatorGateway{
+		cfg:            cfg,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		authorizations: make(map[string]simulatedPayment),
+		transactions:   make(map[string]simulatedPayment),
+		stopping:       make(chan struct{}),
+	}
+}
+
+var errSimulatorStopped = errors.New("simulator is shutting down")
+
+// CheckHealth fails once Shutdown was called, and while the webhook endpoint
+// cannot be reached or answers with a 5xx: captures would then never be
+// reported. Any other answer, such as the 405 a POST-only endpoint gives the
+// probe, counts as reachable.
+func (g *SimulatorGateway) CheckHealth(ctx context.Context) error {
+	select {
+	case <-g.stopping:
+		return errSimulatorStopped
+	default:
+	}
+	if g.cfg.WebhookURL == "" {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, g.cfg.WebhookURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook endpoint unreachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("webhook endpoint returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Shutdown drops the webhooks that are still waiting to be sent and waits
+// for those being sent to finish, or for ctx to be done.
+func (g *SimulatorGateway) Shutdown(ctx context.Context) error {
+	g.stoppingOnce.Do(func() { close(g.stopping) })
+	done := make(chan struct{})
+	go func() {
+		g.deliveries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *SimulatorGateway) Authorize(amount money.Money, paymentMethod, reference string) (string, error) {
+	outcome, ok := simulatorTokens[paymentMethod]
+	if !ok {
+		outcome = simulatorAmounts[amount.Minor]
+	}
+	switch outcome {
+	case outcomeDecline:
+		return "", ErrDeclined
+	case outcomeInsufficientFunds:
+		return "", ErrInsufficientFunds
+	case outcomeAuthenticationRequired:
+		return "", ErrAuthenticationRequired
+	case outcomeTimeout:
+		time.Sleep(g.cfg.Timeout)
+		return "", ErrGatewayTimeout
+	}
+
+	id, err := g.ledger.Authorize(amount, paymentMethod, reference)
+	if err != nil {
+		return "", err
+	}
+	g.mu.Lock()
+	g.authorizations[id] = simulatedPayment{reference: reference, outcome: outcome}
+	g.mu.Unlock()
+	return id, nil
+}
+
+func (g *SimulatorGateway) Capture(authorizationID string, amount money.Money) (string, error) {
+	g.mu.Lock()
+	auth := g.authorizations[authorizationID]
+	g.mu.Unlock()
+	if auth.outcome == outcomeCaptureFailure {
+		return "", errSimulatedFailure
+	}
+
+	id, err := g.ledger.Capture(authorizationID, amount)
+	if err != nil {
+		return "", err
+	}
+	g.mu.Lock()
+	g.transactions[id] = auth
+	g.mu.Unlock()
+
+	data := webhook.PaymentData{PaymentID: auth.reference, TransactionID: id}
+	if auth.outcome == outcomeDelayedWebhook {
+		g.emit(webhook.PaymentSucceeded, data, g.cfg.DelayedWebhookDelay)
+		return id, ErrCapturePending
+	}
+	g.emit(webhook.PaymentSucceeded, data, g.cfg.WebhookDelay)
+	return id, nil
+}
+
+func (g *SimulatorGateway) Void(authorizationID string) error {
+	return g.ledger.Void(authorizationID)
+}
+
+func (g *SimulatorGateway) Refund(transactionID string, amount money.Money, reference string) (string, error) {
+	g.mu.Lock()
+	txn := g.transactions[transactionID]
+	g.mu.Unlock()
+	if txn.outcome == outcomeRefundFailure {
+		return "", errSimulatedFailure
+	}
+
+	id, err := g.ledger.Refund(transactionID, amount, reference)
+	if err != nil {
+		return "", err
+	}
+	g.emit(webhook.RefundSucceeded, webhook.RefundData{RefundID: reference, PaymentID: txn.reference}, g.cfg.WebhookDelay)
+	return id, nil
+}
+
+// emit sends a webhook in the background after delay.
+func (g *SimulatorGateway) emit(eventType webhook.EventType, data interface{}, delay time.Duration) {
+	if g.cfg.WebhookURL == "" {
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("simulator: encoding %s webhook: %v", eventType, err)
+		return
+	}
+	payload, err := json.Marshal(webhook.Event{
+		ID:        "evt_" + uuid.NewString(),
+		Type:      eventType,
+		CreatedAt: time.Now().Unix(),
+		Data:      raw,
+	})
+	if err != nil {
+		log.Printf("simulator: encoding %s webhook: %v", eventType, err)
+		return
+	}
+	g.deliveries.Add(1)
+	go g.deliver(payload, delay)
+}
+
+func (g *SimulatorGateway) deliver(payload []byte, delay time.Duration) {
+	defer g.deliveries.Done()
+	var err error
+	for attempt := 0; attempt <= g.cfg.WebhookRetries; attempt++ {
+		select {
+		case <-time.After(delay):
+		case <-g.stopping:
+			log.Printf("simulator: shutting down, dropping webhook %s", payload)
+			return
+		}
+		if err = g.post(payload); err == nil {
+			return
+		}
+		delay *= 2
+	}
+	log.Printf("simulator: giving up on webhook %s: %v", payload, err)
+}
+
+func (g *SimulatorGateway) post(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, g.cfg.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(g.cfg.WebhookSecret, time.Now(), payload))
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook endpoint returned %d", resp.StatusCode)
+	}
+	return nil
+}
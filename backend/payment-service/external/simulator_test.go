@@ -0,0 +1,189 @@
+package external
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"payment-service/webhook"
+	"testing"
+	"time"
+	"zamato/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatorGateway_Outcomes(t *testing.T) {
+	g := NewSimulatorGateway(SimulatorConfig{Timeout: time.Millisecond})
+	usd := func(amount string) money.Money { return money.MustParse(amount, "USD") }
+
+	tests := []struct {
+		name          string
+		amount        money.Money
+		paymentMethod string
+		wantErr       error
+	}{
+		{name: "success", amount: usd("100.00"), paymentMethod: "tok_visa"},
+		{name: "decline by token", amount: usd("100.00"), paymentMethod: "tok_decline", wantErr: ErrDeclined},
+		{name: "decline by amount", amount: usd("100.01"), wantErr: ErrDeclined},
+		{name: "insufficient funds", amount: usd("100.02"), wantErr: ErrInsufficientFunds},
+		{name: "3DS required", amount: usd("50.00"), paymentMethod: "tok_3ds_required", wantErr: ErrAuthenticationRequired},
+		{name: "timeout", amount: usd("100.04"), wantErr: ErrGatewayTimeout},
+		{name: "token wins over amount", amount: usd("100.01"), paymentMethod: "tok_success"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := g.Authorize(tt.amount, tt.paymentMethod, "p1")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, id)
+		})
+	}
+
+	t.Run("insufficient funds is a decline", func(t *testing.T) {
+		assert.ErrorIs(t, ErrInsufficientFunds, ErrDeclined)
+		assert.ErrorIs(t, ErrAuthenticationRequired, ErrDeclined)
+	})
+
+	t.Run("capture failure", func(t *testing.T) {
+		auth, err := g.Authorize(usd("10.00"), "tok_capture_failure", "p2")
+		assert.NoError(t, err)
+		_, err = g.Capture(auth, usd("10.00"))
+		assert.Error(t, err)
+		assert.NoError(t, g.Void(auth))
+	})
+
+	t.Run("refund failure", func(t *testing.T) {
+		auth, _ := g.Authorize(usd("100.07"), "", "p3")
+		txn, err := g.Capture(auth, usd("100.07"))
+		assert.NoError(t, err)
+		_, err = g.Refund(txn, usd("1.00"), "r1")
+		assert.Error(t, err)
+	})
+
+	t.Run("unique IDs", func(t *testing.T) {
+		a, _ := g.Authorize(usd("1.00"), "", "p4")
+		b, _ := g.Authorize(usd("1.00"), "", "p4")
+		assert.NotEqual(t, a, b)
+	})
+}
+
+func TestSimulatorGateway_Webhooks(t *testing.T) {
+	received := make(chan *webhook.Event, 4)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("whsec", r.Header.Get(webhook.SignatureHeader), payload, time.Minute, time.Now()); err != nil {
+			t.Errorf("bad signature: %v", err)
+		}
+		attempts++
+		if attempts == 1 {
+			// The first delivery fails and is retried.
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		event, err := webhook.Parse(payload)
+		assert.NoError(t, err)
+		received <- event
+	}))
+	defer server.Close()
+
+	g := NewSimulatorGateway(SimulatorConfig{
+		WebhookURL:          server.URL,
+		WebhookSecret:       "whsec",
+		WebhookDelay:        time.Millisecond,
+		DelayedWebhookDelay: 20 * time.Millisecond,
+		WebhookRetries:      2,
+	})
+	usd := money.MustParse("100.05", "USD")
+
+	auth, err := g.Authorize(usd, "", "p1")
+	assert.NoError(t, err)
+	txn, err := g.Capture(auth, usd)
+	assert.ErrorIs(t, err, ErrCapturePending)
+	assert.NotEmpty(t, txn)
+
+	event := waitForEvent(t, received)
+	assert.Equal(t, webhook.PaymentSucceeded, event.Type)
+	data, err := event.PaymentData()
+	assert.NoError(t, err)
+	assert.Equal(t, "p1", data.PaymentID)
+	assert.Equal(t, txn, data.TransactionID)
+
+	_, err = g.Refund(txn, money.MustParse("5.00", "USD"), "r1")
+	assert.NoError(t, err)
+	event = waitForEvent(t, received)
+	assert.Equal(t, webhook.RefundSucceeded, event.Type)
+	refund, err := event.RefundData()
+	assert.NoError(t, err)
+	assert.Equal(t, "r1", refund.RefundID)
+	assert.Equal(t, "p1", refund.PaymentID)
+}
+
+func TestSimulatorGateway_ShutdownDropsWaitingWebhooks(t *testing.T) {
+	delivered := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			delivered <- struct{}{}
+		}
+	}))
+	defer server.Close()
+
+	g := NewSimulatorGateway(SimulatorConfig{
+		WebhookURL:          server.URL,
+		WebhookSecret:       "whsec",
+		DelayedWebhookDelay: time.Hour,
+	})
+	usd := money.MustParse("100.05", "USD")
+	auth, err := g.Authorize(usd, "", "p1")
+	assert.NoError(t, err)
+	_, err = g.Capture(auth, usd)
+	assert.ErrorIs(t, err, ErrCapturePending)
+
+	check := GatewayCheck(g)
+	assert.NoError(t, check(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, g.Shutdown(ctx))
+	assert.ErrorIs(t, check(context.Background()), errSimulatorStopped)
+	assert.NoError(t, GatewayCheck(&DummyGateway{})(context.Background()))
+	select {
+	case <-delivered:
+		t.Fatal("webhook delivered after shutdown")
+	default:
+	}
+}
+
+func TestSimulatorGateway_CheckHealthProbesWebhookEndpoint(t *testing.T) {
+	status := http.StatusMethodNotAllowed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	check := GatewayCheck(NewSimulatorGateway(SimulatorConfig{WebhookURL: server.URL}))
+	assert.NoError(t, check(context.Background()))
+
+	status = http.StatusBadGateway
+	assert.Error(t, check(context.Background()))
+
+	server.Close()
+	assert.Error(t, check(context.Background()))
+
+	assert.NoError(t, GatewayCheck(NewSimulatorGateway(SimulatorConfig{}))(context.Background()))
+}
+
+func waitForEvent(t *testing.T, events <-chan *webhook.Event) *webhook.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("no webhook received")
+		return nil
+	}
+}
@@ -4,14 +4,17 @@ go 1.23.4
 
 require (
 	github.com/golang/mock v1.6.0
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
 	github.com/stretchr/testify v1.10.0
 	gorm.io/driver/sqlite v1.5.7
 	gorm.io/gorm v1.26.1
+	zamato/pkg v0.0.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/mattn/go-sqlite3 v1.14.22 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -31,3 +34,5 @@ require (
 	golang.org/x/text v0.25.0 // indirect
 	gorm.io/driver/postgres v1.5.11 // direct
 )
+
+replace zamato/pkg => ../pkg
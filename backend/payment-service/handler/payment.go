@@ -2,9 +2,19 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"payment-service/models"
 	"payment-service/service"
+	"strconv"
+	"strings"
+	"zamato/pkg/idempotency"
+	"zamato/pkg/money"
+	"zamato/pkg/pagination"
+	"zamato/pkg/problem"
 
 	"github.com/gorilla/mux"
 )
@@ -17,15 +27,23 @@ func NewPaymentHandler(s service.PaymentService) *PaymentHandler {
 	return &PaymentHandler{service: s}
 }
 
+// CreatePayment creates a payment from a models.CreatePaymentRequest. Fields
+// the service assigns, such as id and status, are rejected rather than
+// ignored.
 func (h *PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
-	var payment models.Payment
-	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	var req models.CreatePaymentRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		problem.Write(w, r, fmt.Errorf("%w: %v", problem.ErrInvalidRequest, err))
 		return
 	}
-	err := h.service.CreatePayment(&payment)
+	payment, err := h.service.CreatePayment(req)
 	if err != nil {
-		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		if errors.Is(err, service.ErrPaymentNotRecorded) {
+			idempotency.Keep(r)
+		}
+		problem.Write(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -35,48 +53,203 @@ func (h *PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
 func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 	payment, err := h.service.GetPayment(id)
-	if err != nil || payment == nil {
-		http.Error(w, "Payment not found", http.StatusNotFound)
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 	json.NewEncoder(w).Encode(payment)
 }
 
+// ListPayments returns a page of payments, newest first, filtered by the
+// query parameters order_id, status, provider, transaction_id, from, to,
+// min_amount and max_amount (with currency). Pass limit to change the page
+// size and the next_cursor of a page as cursor to get the next one.
 func (h *PaymentHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
-	orderID := r.URL.Query().Get("order_id")
-	payments, err := h.service.ListPaymentsByOrder(orderID)
+	query, err := paymentQuery(r.URL.Query())
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	page, err := h.service.SearchPayments(query)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+func paymentQuery(params url.Values) (models.PaymentQuery, error) {
+	query := models.PaymentQuery{
+		OrderID:       params.Get("order_id"),
+		Provider:      params.Get("provider"),
+		TransactionID: params.Get("transaction_id"),
+		Cursor:        params.Get("cursor"),
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("%w: invalid limit %q", problem.ErrInvalidRequest, v)
+		}
+		query.Limit = limit
+	}
+	for _, v := range params["status"] {
+		for _, status := range strings.Split(v, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				query.Statuses = append(query.Statuses, strings.ToLower(status))
+			}
+		}
+	}
+	var err error
+	if query.From, err = pagination.TimeParam(params, "from", false); err != nil {
+		return query, err
+	}
+	if query.To, err = pagination.TimeParam(params, "to", true); err != nil {
+		return query, err
+	}
+	if query.MinAmount, err = amountParam(params, "min_amount"); err != nil {
+		return query, err
+	}
+	if query.MaxAmount, err = amountParam(params, "max_amount"); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// amountParam parses a decimal amount in the currency given by the currency
+// parameter.
+func amountParam(params url.Values, name string) (*money.Money, error) {
+	v := params.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	currency := strings.ToUpper(params.Get("currency"))
+	if currency == "" {
+		return nil, fmt.Errorf("%w: %s requires currency", problem.ErrInvalidRequest, name)
+	}
+	amount, err := money.Parse(v, currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s: %v", problem.ErrInvalidRequest, name, err)
+	}
+	return &amount, nil
+}
+
+// CaptureRequest is the optional body of POST /payments/{id}/capture. Without
+// an amount the full authorized amount is captured.
+type CaptureRequest struct {
+	Amount *money.Money `json:"amount,omitempty"`
+}
+
+func (h *PaymentHandler) CapturePayment(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req CaptureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(w, r, fmt.Errorf("%w: %v", problem.ErrInvalidRequest, err))
+		return
+	}
+	payment, err := h.service.CapturePayment(id, req.Amount)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (h *PaymentHandler) VoidPayment(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	payment, err := h.service.VoidPayment(id)
 	if err != nil {
-		http.Error(w, "Failed to list payments", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
-	json.NewEncoder(w).Encode(payments)
+	json.NewEncoder(w).Encode(payment)
+}
+
+// RefundRequest is the optional body of POST /payments/{id}/refund. Without
+// an amount the remaining refundable amount is refunded.
+type RefundRequest struct {
+	Amount *money.Money `json:"amount,omitempty"`
+	Reason string       `json:"reason,omitempty"`
 }
 
 func (h *PaymentHandler) InitiateRefund(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	refund, err := h.service.InitiateRefund(id)
+	var req RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(w, r, fmt.Errorf("%w: %v", problem.ErrInvalidRequest, err))
+		return
+	}
+	refund, err := h.service.InitiateRefund(id, req.Amount, req.Reason)
 	if err != nil {
-		http.Error(w, "Failed to initiate refund", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(refund)
 }
 
-func (h *PaymentHandler) GetRefundStatus(w http.ResponseWriter, r *http.Request) {
+// CancellationRefundRequest is the optional body of
+// POST /payments/{id}/cancellation-refund.
+type CancellationRefundRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// RefundCancelled refunds whatever has not been refunded of a payment whose
+// order was cancelled. Unlike InitiateRefund it takes no amount.
+func (h *PaymentHandler) RefundCancelled(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	refund, err := h.service.GetRefundStatus(id)
+	var req CancellationRefundRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(w, r, fmt.Errorf("%w: %v", problem.ErrInvalidRequest, err))
+		return
+	}
+	refund, err := h.service.InitiateRefund(id, nil, req.Reason)
 	if err != nil {
-		http.Error(w, "Failed to get refund status", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(refund)
 }
 
+func (h *PaymentHandler) ListRefunds(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	refunds, err := h.service.ListRefunds(id)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if refunds == nil {
+		refunds = []*models.Refund{}
+	}
+	json.NewEncoder(w).Encode(refunds)
+}
+
+// GetLatestRefund answers the GET /payments/{id}/refund route of clients
+// written when a payment could have a single refund: it returns the newest
+// refund of the payment, or 404 if there is none.
+func (h *PaymentHandler) GetLatestRefund(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	refunds, err := h.service.ListRefunds(id)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if len(refunds) == 0 {
+		problem.Write(w, r, service.ErrRefundNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(refunds[len(refunds)-1])
+}
+
+// PaymentWebhook applies a gateway event. The signature is checked by
+// middleware.WebhookSignature before this runs. Anything but a 2xx makes the
+// gateway redeliver the event later.
 func (h *PaymentHandler) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
-	// Parse webhook payload and update payment status accordingly
 	err := h.service.HandleWebhook(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to process webhook", http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -4,12 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"payment-service/mocks"
 	"payment-service/models"
+	"payment-service/service"
+	"payment-service/webhook"
+	"strings"
 	"testing"
+	"time"
+	"zamato/pkg/money"
+	"zamato/pkg/problem"
 
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
@@ -21,26 +27,64 @@ func TestPaymentHandler_CreatePayment(t *testing.T) {
 	mockService := mocks.NewMockPaymentService(ctrl)
 	handler := NewPaymentHandler(mockService)
 
+	request := func(orderID, amount string) string {
+		return `{"order_id": "` + orderID + `", "amount": {"amount": "` + amount + `", "currency": "USD"}}`
+	}
+
 	tests := []struct {
 		name         string
-		input        models.Payment
-		bodyInvalid  bool
+		body         string
+		wantRequest  *models.CreatePaymentRequest
 		serviceError error
 		wantStatus   int
+		wantCode     string
 	}{
 		{
-			name:       "success",
-			input:      models.Payment{ID: "1", Amount: 100, OrderID: "order1"},
-			wantStatus: http.StatusCreated,
+			name:        "success",
+			body:        `{"order_id": "order1", "amount": {"amount": "100.00", "currency": "USD"}, "payment_method": "tok_visa", "capture_method": "manual"}`,
+			wantRequest: &models.CreatePaymentRequest{OrderID: "order1", Amount: money.MustParse("100.00", "USD"), PaymentMethod: "tok_visa", CaptureMethod: "manual"},
+			wantStatus:  http.StatusCreated,
+		},
+		{
+			name:       "invalid body",
+			body:       "{invalid json",
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_request",
+		},
+		{
+			name:       "client-chosen id",
+			body:       `{"id": "pay_mine", "order_id": "order1", "amount": {"amount": "100.00", "currency": "USD"}}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_request",
+		},
+		{
+			name:       "client-chosen status",
+			body:       `{"order_id": "order1", "amount": {"amount": "100.00", "currency": "USD"}, "status": "completed"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_request",
+		},
+		{
+			name:         "invalid capture method",
+			body:         `{"order_id": "order3", "amount": {"amount": "100.00", "currency": "USD"}, "capture_method": "later"}`,
+			serviceError: service.ErrInvalidPayment,
+			wantStatus:   http.StatusBadRequest,
+			wantCode:     "invalid_payment",
+		},
+		{
+			name:         "card declined",
+			body:         request("order5", "100.01"),
+			serviceError: service.ErrPaymentDeclined,
+			wantStatus:   http.StatusPaymentRequired,
 		},
 		{
-			name:        "invalid body",
-			bodyInvalid: true,
-			wantStatus:  http.StatusBadRequest,
+			name:         "gateway unavailable",
+			body:         request("order4", "100.00"),
+			serviceError: service.ErrGatewayFailed,
+			wantStatus:   http.StatusBadGateway,
 		},
 		{
 			name:         "service error",
-			input:        models.Payment{ID: "2", Amount: 200, OrderID: "order2"},
+			body:         request("order2", "200.00"),
 			serviceError: errors.New("fail"),
 			wantStatus:   http.StatusInternalServerError,
 		},
@@ -48,27 +92,36 @@ func TestPaymentHandler_CreatePayment(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var body io.Reader
-			if tt.bodyInvalid {
-				body = bytes.NewBufferString("{invalid json")
-			} else {
-				b, _ := json.Marshal(tt.input)
-				body = bytes.NewBuffer(b)
-			}
-			req := httptest.NewRequest("POST", "/payments", body)
+			req := httptest.NewRequest("POST", "/payments", bytes.NewBufferString(tt.body))
 			w := httptest.NewRecorder()
 
-			if !tt.bodyInvalid {
-				mockService.EXPECT().
-					CreatePayment(gomock.Any()).
-					Return(tt.serviceError).
-					Times(1)
+			if tt.wantStatus != http.StatusBadRequest || tt.serviceError != nil {
+				var want interface{} = gomock.Any()
+				if tt.wantRequest != nil {
+					want = *tt.wantRequest
+				}
+				call := mockService.EXPECT().CreatePayment(want)
+				if tt.serviceError != nil {
+					call.Return(nil, tt.serviceError)
+				} else {
+					amount := money.MustParse("100.00", "USD")
+					call.Return(&models.Payment{ID: "pay_1", OrderID: "order1", Amount: amount, CapturedAmount: money.Zero("USD"), Status: models.PaymentStatusAuthorized}, nil)
+				}
 			}
 
 			handler.CreatePayment(w, req)
 			if w.Code != tt.wantStatus {
 				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
 			}
+			if tt.wantCode != "" && !strings.Contains(w.Body.String(), `"code":"`+tt.wantCode+`"`) {
+				t.Errorf("body %s lacks code %q", w.Body.String(), tt.wantCode)
+			}
+			if tt.wantStatus == http.StatusCreated {
+				var payment models.Payment
+				if err := json.NewDecoder(w.Body).Decode(&payment); err != nil || payment.ID != "pay_1" {
+					t.Errorf("got payment %+v (%v), want id pay_1", payment, err)
+				}
+			}
 		})
 	}
 }
@@ -96,9 +149,15 @@ func TestPaymentHandler_GetPayment(t *testing.T) {
 			name:       "not found",
 			id:         "2",
 			payment:    nil,
-			serviceErr: errors.New("not found"),
+			serviceErr: service.ErrPaymentNotFound,
 			wantStatus: http.StatusNotFound,
 		},
+		{
+			name:       "service error",
+			id:         "3",
+			serviceErr: errors.New("fail"),
+			wantStatus: http.StatusInternalServerError,
+		},
 	}
 
 	for _, tt := range tests {
@@ -126,22 +185,191 @@ func TestPaymentHandler_ListPayments(t *testing.T) {
 	mockService := mocks.NewMockPaymentService(ctrl)
 	handler := NewPaymentHandler(mockService)
 
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	minAmount := money.MustParse("5.00", "USD")
+	maxAmount := money.MustParse("50.00", "USD")
+
 	tests := []struct {
 		name       string
-		orderID    string
-		payments   []*models.Payment
+		url        string
+		wantQuery  *models.PaymentQuery
+		page       *models.PaymentPage
+		serviceErr error
+		wantStatus int
+	}{
+		{
+			name:       "by order",
+			url:        "/payments?order_id=order1",
+			wantQuery:  &models.PaymentQuery{OrderID: "order1"},
+			page:       &models.PaymentPage{Payments: []*models.Payment{{ID: "1"}, {ID: "2"}}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "all filters",
+			url:  "/payments?status=completed,Failed&provider=dummy&transaction_id=tx_1&from=2024-05-01&to=2024-05-01&min_amount=5&max_amount=50.00&currency=usd&limit=10&cursor=abc",
+			wantQuery: &models.PaymentQuery{
+				Statuses:      []string{"completed", "failed"},
+				Provider:      "dummy",
+				TransactionID: "tx_1",
+				From:          &from,
+				To:            &to,
+				MinAmount:     &minAmount,
+				MaxAmount:     &maxAmount,
+				Limit:         10,
+				Cursor:        "abc",
+			},
+			page:       &models.PaymentPage{Payments: []*models.Payment{}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid query",
+			url:        "/payments?cursor=bad",
+			wantQuery:  &models.PaymentQuery{Cursor: "bad"},
+			serviceErr: service.ErrInvalidQuery,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "service error",
+			url:        "/payments?order_id=order2",
+			wantQuery:  &models.PaymentQuery{OrderID: "order2"},
+			serviceErr: errors.New("fail"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{name: "invalid limit", url: "/payments?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "invalid date", url: "/payments?from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "amount without currency", url: "/payments?min_amount=5", wantStatus: http.StatusBadRequest},
+		{name: "invalid amount", url: "/payments?max_amount=5.001&currency=USD", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+
+			if tt.wantQuery != nil {
+				mockService.EXPECT().
+					SearchPayments(*tt.wantQuery).
+					Return(tt.page, tt.serviceErr).
+					Times(1)
+			}
+
+			handler.ListPayments(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPaymentHandler_CapturePayment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockService := mocks.NewMockPaymentService(ctrl)
+	handler := NewPaymentHandler(mockService)
+
+	partial := money.MustParse("80.00", "USD")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantAmount *money.Money
+		serviceErr error
+		wantStatus int
+		skipMock   bool
+	}{
+		{
+			name:       "full capture without body",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "partial capture",
+			body:       `{"amount": {"amount": "80.00", "currency": "USD"}}`,
+			wantAmount: &partial,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid body",
+			body:       `{"amount":`,
+			wantStatus: http.StatusBadRequest,
+			skipMock:   true,
+		},
+		{
+			name:       "too much",
+			serviceErr: service.ErrInvalidCaptureAmount,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not found",
+			serviceErr: service.ErrPaymentNotFound,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "already captured",
+			serviceErr: service.ErrInvalidPaymentState,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "gateway error",
+			serviceErr: service.ErrGatewayFailed,
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/payments/1/capture", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+
+			if !tt.skipMock {
+				var payment *models.Payment
+				if tt.serviceErr == nil {
+					payment = &models.Payment{ID: "1", Status: models.PaymentStatusCompleted}
+				}
+				mockService.EXPECT().
+					CapturePayment("1", tt.wantAmount).
+					Return(payment, tt.serviceErr).
+					Times(1)
+			}
+
+			handler.CapturePayment(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPaymentHandler_VoidPayment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockService := mocks.NewMockPaymentService(ctrl)
+	handler := NewPaymentHandler(mockService)
+
+	tests := []struct {
+		name       string
+		payment    *models.Payment
 		serviceErr error
 		wantStatus int
 	}{
 		{
 			name:       "success",
-			orderID:    "order1",
-			payments:   []*models.Payment{{ID: "1"}, {ID: "2"}},
+			payment:    &models.Payment{ID: "1", Status: models.PaymentStatusVoided},
 			wantStatus: http.StatusOK,
 		},
+		{
+			name:       "not found",
+			serviceErr: service.ErrPaymentNotFound,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "already captured",
+			serviceErr: service.ErrInvalidPaymentState,
+			wantStatus: http.StatusConflict,
+		},
 		{
 			name:       "service error",
-			orderID:    "order2",
 			serviceErr: errors.New("fail"),
 			wantStatus: http.StatusInternalServerError,
 		},
@@ -149,15 +377,16 @@ func TestPaymentHandler_ListPayments(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest("GET", "/payments?order_id="+tt.orderID, nil)
+			req := httptest.NewRequest("POST", "/payments/1/void", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
 			w := httptest.NewRecorder()
 
 			mockService.EXPECT().
-				ListPaymentsByOrder(tt.orderID).
-				Return(tt.payments, tt.serviceErr).
+				VoidPayment("1").
+				Return(tt.payment, tt.serviceErr).
 				Times(1)
 
-			handler.ListPayments(w, req)
+			handler.VoidPayment(w, req)
 			if w.Code != tt.wantStatus {
 				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
 			}
@@ -171,18 +400,58 @@ func TestPaymentHandler_InitiateRefund(t *testing.T) {
 	mockService := mocks.NewMockPaymentService(ctrl)
 	handler := NewPaymentHandler(mockService)
 
+	partial := money.MustParse("25.00", "USD")
+
 	tests := []struct {
 		name       string
 		id         string
+		body       string
+		wantAmount *money.Money
+		wantReason string
 		refund     *models.Refund
 		serviceErr error
 		wantStatus int
+		skipMock   bool
 	}{
 		{
-			name:       "success",
+			name:       "full refund without body",
 			id:         "1",
 			refund:     &models.Refund{ID: "r1"},
-			wantStatus: http.StatusOK,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "partial refund",
+			id:         "1",
+			body:       `{"amount": {"amount": "25.00", "currency": "USD"}, "reason": "missing item"}`,
+			wantAmount: &partial,
+			wantReason: "missing item",
+			refund:     &models.Refund{ID: "r2"},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "invalid amount",
+			id:         "1",
+			body:       `{"amount": {"amount": "25.001", "currency": "USD"}}`,
+			wantStatus: http.StatusBadRequest,
+			skipMock:   true,
+		},
+		{
+			name:       "over-refund",
+			id:         "1",
+			serviceErr: service.ErrRefundExceedsPayment,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "gateway error",
+			id:         "1",
+			serviceErr: service.ErrGatewayFailed,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "payment not found",
+			id:         "3",
+			serviceErr: service.ErrPaymentNotFound,
+			wantStatus: http.StatusNotFound,
 		},
 		{
 			name:       "service error",
@@ -194,14 +463,16 @@ func TestPaymentHandler_InitiateRefund(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest("POST", "/payments/"+tt.id+"/refund", nil)
+			req := httptest.NewRequest("POST", "/payments/"+tt.id+"/refund", strings.NewReader(tt.body))
 			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
 			w := httptest.NewRecorder()
 
-			mockService.EXPECT().
-				InitiateRefund(tt.id).
-				Return(tt.refund, tt.serviceErr).
-				Times(1)
+			if !tt.skipMock {
+				mockService.EXPECT().
+					InitiateRefund(tt.id, tt.wantAmount, tt.wantReason).
+					Return(tt.refund, tt.serviceErr).
+					Times(1)
+			}
 
 			handler.InitiateRefund(w, req)
 			if w.Code != tt.wantStatus {
@@ -211,7 +482,47 @@ func TestPaymentHandler_InitiateRefund(t *testing.T) {
 	}
 }
 
-func TestPaymentHandler_GetRefundStatus(t *testing.T) {
+func TestPaymentHandler_RefundCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockService := mocks.NewMockPaymentService(ctrl)
+	handler := NewPaymentHandler(mockService)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantReason string
+		serviceErr error
+		wantStatus int
+		skipMock   bool
+	}{
+		{name: "without body", wantStatus: http.StatusCreated},
+		{name: "with reason", body: `{"reason": "order cancelled"}`, wantReason: "order cancelled", wantStatus: http.StatusCreated},
+		{name: "amount is rejected", body: `{"amount": {"amount": "1.00", "currency": "USD"}}`, wantStatus: http.StatusBadRequest, skipMock: true},
+		{name: "already refunded", serviceErr: service.ErrRefundExceedsPayment, wantStatus: http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/payments/1/cancellation-refund", strings.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+
+			if !tt.skipMock {
+				mockService.EXPECT().
+					InitiateRefund("1", nil, tt.wantReason).
+					Return(&models.Refund{ID: "r1"}, tt.serviceErr).
+					Times(1)
+			}
+
+			handler.RefundCancelled(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPaymentHandler_ListRefunds(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockService := mocks.NewMockPaymentService(ctrl)
@@ -220,15 +531,28 @@ func TestPaymentHandler_GetRefundStatus(t *testing.T) {
 	tests := []struct {
 		name       string
 		id         string
-		refund     *models.Refund
+		refunds    []*models.Refund
 		serviceErr error
 		wantStatus int
+		wantBody   string
 	}{
 		{
 			name:       "success",
 			id:         "1",
-			refund:     &models.Refund{ID: "r1"},
+			refunds:    []*models.Refund{{ID: "r1"}, {ID: "r2"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no refunds",
+			id:         "4",
 			wantStatus: http.StatusOK,
+			wantBody:   "[]\n",
+		},
+		{
+			name:       "payment not found",
+			id:         "3",
+			serviceErr: service.ErrPaymentNotFound,
+			wantStatus: http.StatusNotFound,
 		},
 		{
 			name:       "service error",
@@ -238,6 +562,62 @@ func TestPaymentHandler_GetRefundStatus(t *testing.T) {
 		},
 	}
 
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/payments/"+tt.id+"/refunds", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			w := httptest.NewRecorder()
+
+			mockService.EXPECT().
+				ListRefunds(tt.id).
+				Return(tt.refunds, tt.serviceErr).
+				Times(1)
+
+			handler.ListRefunds(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("got body %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPaymentHandler_GetLatestRefund(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockService := mocks.NewMockPaymentService(ctrl)
+	handler := NewPaymentHandler(mockService)
+
+	tests := []struct {
+		name       string
+		id         string
+		refunds    []*models.Refund
+		serviceErr error
+		wantStatus int
+		wantID     string
+	}{
+		{
+			name:       "returns newest refund",
+			id:         "1",
+			refunds:    []*models.Refund{{ID: "r1"}, {ID: "r2"}},
+			wantStatus: http.StatusOK,
+			wantID:     "r2",
+		},
+		{
+			name:       "no refunds",
+			id:         "4",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "payment not found",
+			id:         "3",
+			serviceErr: service.ErrPaymentNotFound,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest("GET", "/payments/"+tt.id+"/refund", nil)
@@ -245,14 +625,25 @@ func TestPaymentHandler_GetRefundStatus(t *testing.T) {
 			w := httptest.NewRecorder()
 
 			mockService.EXPECT().
-				GetRefundStatus(tt.id).
-				Return(tt.refund, tt.serviceErr).
+				ListRefunds(tt.id).
+				Return(tt.refunds, tt.serviceErr).
 				Times(1)
 
-			handler.GetRefundStatus(w, req)
+			handler.GetLatestRefund(w, req)
 			if w.Code != tt.wantStatus {
 				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
 			}
+			if tt.wantID != "" {
+				var refund struct {
+					ID string `json:"id"`
+				}
+				if err := json.NewDecoder(w.Body).Decode(&refund); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				if refund.ID != tt.wantID {
+					t.Errorf("got refund %q, want %q", refund.ID, tt.wantID)
+				}
+			}
 		})
 	}
 }
@@ -274,11 +665,23 @@ func TestPaymentHandler_PaymentWebhook(t *testing.T) {
 			body:       "{}",
 			wantStatus: http.StatusOK,
 		},
+		{
+			name:       "malformed event",
+			body:       "{}",
+			serviceErr: webhook.ErrMalformedEvent,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown payment",
+			body:       "{}",
+			serviceErr: service.ErrWebhookTargetUnknown,
+			wantStatus: http.StatusNotFound,
+		},
 		{
 			name:       "fail",
 			body:       "{}",
 			serviceErr: errors.New("fail"),
-			wantStatus: http.StatusBadRequest,
+			wantStatus: http.StatusInternalServerError,
 		},
 	}
 
@@ -299,3 +702,42 @@ func TestPaymentHandler_PaymentWebhook(t *testing.T) {
 		})
 	}
 }
+
+func TestPaymentHandler_ProblemResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockService := mocks.NewMockPaymentService(ctrl)
+	handler := NewPaymentHandler(mockService)
+
+	mockService.EXPECT().
+		CreatePayment(gomock.Any()).
+		Return(nil, fmt.Errorf("%w: card declined", service.ErrPaymentDeclined))
+
+	req := httptest.NewRequest("POST", "/payments", strings.NewReader(`{"order_id": "o1"}`))
+	req = req.WithContext(problem.WithRequestID(req.Context(), "req-1"))
+	w := httptest.NewRecorder()
+	handler.CreatePayment(w, req)
+
+	if w.Code != http.StatusPaymentRequired {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusPaymentRequired)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("got Content-Type %q, want %q", ct, problem.ContentType)
+	}
+	var got problem.Details
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := problem.Details{
+		Type:      "about:blank",
+		Title:     "Payment Required",
+		Status:    http.StatusPaymentRequired,
+		Detail:    "payment declined: card declined",
+		Instance:  "/payments",
+		Code:      "payment_declined",
+		RequestID: "req-1",
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,25 @@
+package handler
+
+import "zamato/pkg/auth"
+
+// Permissions required by the payment routes.
+const (
+	PermCreatePayment  auth.Permission = "payments:create"
+	PermReadPayments   auth.Permission = "payments:read"
+	PermCapturePayment auth.Permission = "payments:capture"
+	PermVoidPayment    auth.Permission = "payments:void"
+	PermRefundPayment  auth.Permission = "payments:refund"
+	// PermRefundCancelled lets order-service give back the payment of an
+	// order it cancelled: always in full, never a chosen amount.
+	PermRefundCancelled auth.Permission = "payments:refund_cancelled"
+)
+
+// Policy grants the payment permissions to roles. Payments are created and
+// settled by order-service, which holds the service role; people only look
+// them up, release them and refund them. order-service refunds only the
+// payments of the orders it cancels.
+var Policy = auth.Policy{
+	auth.RoleService: {PermCreatePayment, PermReadPayments, PermCapturePayment, PermVoidPayment, PermRefundCancelled},
+	auth.RoleSupport: {PermReadPayments, PermVoidPayment, PermRefundPayment},
+	auth.RoleAdmin:   {PermReadPayments, PermCapturePayment, PermVoidPayment, PermRefundPayment},
+}
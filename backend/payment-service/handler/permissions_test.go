@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"testing"
+	"zamato/pkg/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	people := []auth.Role{auth.RoleCustomer, auth.RoleRestaurant, auth.RoleCourier, auth.RoleSupport, auth.RoleAdmin}
+	for _, role := range people {
+		assert.False(t, Policy.Allows(role, PermCreatePayment), "%s may not create payments", role)
+	}
+	assert.True(t, Policy.Allows(auth.RoleService, PermCreatePayment))
+
+	for _, role := range []auth.Role{auth.RoleCustomer, auth.RoleRestaurant, auth.RoleCourier} {
+		assert.False(t, Policy.Allows(role, PermRefundPayment), "%s may not refund", role)
+		assert.False(t, Policy.Allows(role, PermReadPayments), "%s may not read payments", role)
+	}
+	assert.True(t, Policy.Allows(auth.RoleSupport, PermRefundPayment))
+	assert.True(t, Policy.Allows(auth.RoleAdmin, PermRefundPayment))
+
+	// Services give back payments of cancelled orders, but choose no
+	// refund amounts.
+	assert.False(t, Policy.Allows(auth.RoleService, PermRefundPayment))
+	assert.True(t, Policy.Allows(auth.RoleService, PermRefundCancelled))
+	for _, role := range people {
+		assert.False(t, Policy.Allows(role, PermRefundCancelled), "%s may not refund cancelled orders", role)
+	}
+}
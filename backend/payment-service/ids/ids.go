@@ -0,0 +1,108 @@
+// Package ids mints the public IDs of payments and refunds.
+package ids
+
+import (
+	"crypto/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefixes tell the kind of resource an ID names.
+const (
+	PaymentPrefix = "pay"
+	RefundPrefix  = "re"
+)
+
+// crockford is Crockford's base32 alphabet, whose order matches byte order,
+// so encoded IDs sort like the bytes they encode.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// idLen is the length of an ID without its prefix: 128 bits in base32.
+const idLen = 26
+
+var defaultSource = &source{now: time.Now}
+
+// New returns a new ID with prefix, e.g. "pay_01J9ZK3Q5D8W4M7V2N6R0T1B3C". It
+// holds a 48-bit millisecond timestamp followed by 80 random bits, so IDs
+// sort by creation time. Within one millisecond the random part is
+// incremented, so the IDs of one process never repeat and stay in order.
+func New(prefix string) string {
+	return prefix + "_" + defaultSource.next()
+}
+
+// Payment returns a new payment ID.
+func Payment() string { return New(PaymentPrefix) }
+
+// Refund returns a new refund ID.
+func Refund() string { return New(RefundPrefix) }
+
+// HasPrefix reports whether id was minted with prefix.
+func HasPrefix(id, prefix string) bool {
+	rest, ok := strings.CutPrefix(id, prefix+"_")
+	return ok && len(rest) == idLen
+}
+
+type source struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	lastMs uint64
+	random [10]byte
+}
+
+func (s *source) next() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := uint64(s.now().UnixMilli())
+	if ms > s.lastMs || !increment(&s.random) {
+		if _, err := rand.Read(s.random[:]); err != nil {
+			panic("ids: reading random bytes: " + err.Error())
+		}
+		if ms > s.lastMs {
+			s.lastMs = ms
+		} else {
+			// The random part ran out within one millisecond, or the clock
+			// moved back: borrow the next millisecond to stay ordered.
+			s.lastMs++
+		}
+	}
+
+	var b [16]byte
+	for i := 0; i < 6; i++ {
+		b[i] = byte(s.lastMs >> (40 - 8*i))
+	}
+	copy(b[6:], s.random[:])
+	return encode(b)
+}
+
+// increment adds one to the big-endian number in b and reports whether it
+// did not overflow.
+func increment(b *[10]byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode writes the 128 bits of b as 26 base32 characters, the first of which
+// only carries 3 bits.
+func encode(b [16]byte) string {
+	var out [idLen]byte
+	var acc uint64
+	bits := 2 // pad 128 bits to 130
+	pos := 0
+	for _, v := range b {
+		acc = acc<<8 | uint64(v)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[pos] = crockford[acc>>bits&31]
+			pos++
+		}
+	}
+	return string(out[:])
+}
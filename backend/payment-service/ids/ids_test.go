@@ -0,0 +1,73 @@
+package ids
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_Format(t *testing.T) {
+	id := Payment()
+	assert.True(t, strings.HasPrefix(id, "pay_"), id)
+	assert.Len(t, id, len("pay_")+idLen)
+	assert.True(t, HasPrefix(id, PaymentPrefix))
+	assert.False(t, HasPrefix(id, RefundPrefix))
+	assert.True(t, HasPrefix(Refund(), RefundPrefix))
+	assert.False(t, HasPrefix("pay_123", PaymentPrefix))
+
+	for _, c := range strings.TrimPrefix(id, "pay_") {
+		assert.Contains(t, crockford, string(c))
+	}
+}
+
+func TestNew_SortsByCreation(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &source{now: func() time.Time { return now }}
+
+	var got []string
+	for i := 0; i < 1000; i++ {
+		if i%100 == 0 {
+			now = now.Add(time.Millisecond)
+		}
+		got = append(got, s.next())
+	}
+	assert.True(t, sort.StringsAreSorted(got), "ids are not in creation order")
+
+	seen := make(map[string]bool)
+	for _, id := range got {
+		assert.False(t, seen[id], "duplicate id %s", id)
+		seen[id] = true
+	}
+}
+
+func TestNew_ClockMovedBack(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &source{now: func() time.Time { return now }}
+
+	before := s.next()
+	now = now.Add(-time.Second)
+	after := s.next()
+	assert.Greater(t, after, before)
+}
+
+func TestIncrement_Overflow(t *testing.T) {
+	b := [10]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff}
+	assert.True(t, increment(&b))
+	assert.Equal(t, [10]byte{0, 0, 0, 0, 0, 0, 0, 0, 1, 0}, b)
+
+	full := [10]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	assert.False(t, increment(&full))
+}
+
+func TestEncode(t *testing.T) {
+	assert.Equal(t, strings.Repeat("0", idLen), encode([16]byte{}))
+
+	var max [16]byte
+	for i := range max {
+		max[i] = 0xff
+	}
+	assert.Equal(t, "7"+strings.Repeat("Z", idLen-1), encode(max))
+}
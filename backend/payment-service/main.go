@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
-	"os"
+	"os/signal"
+	"syscall"
 
+	"payment-service/config"
 	"payment-service/external"
 	"payment-service/handler"
+	"payment-service/middleware"
 	"payment-service/models"
+	"payment-service/outbox"
 	"payment-service/repository"
 	"payment-service/service"
+	"zamato/pkg/auth"
+	"zamato/pkg/idempotency"
+	"zamato/pkg/problem"
+	"zamato/pkg/schema"
+	"zamato/pkg/server"
 
 	"github.com/gorilla/mux"
 	"gorm.io/driver/postgres"
@@ -17,36 +27,134 @@ import (
 )
 
 func main() {
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		dsn = "host=localhost user=glassbreak password=glassbreak dbname=glassbreak port=5432 sslmode=disable"
-		log.Println("DATABASE_URL not set, using glassbreak fallback config")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+
+	db, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	if err := db.AutoMigrate(&models.Payment{}, &models.Refund{}); err != nil {
+	if err := db.AutoMigrate(&models.Payment{}, &models.Refund{}, &idempotency.Record{}, &models.WebhookEvent{}, &models.OrderCallback{}, &schema.Migration{}); err != nil {
 		log.Fatalf("Failed to automigrate database: %v", err)
 	}
+	if err := repository.MigrateLegacyAmounts(db, cfg.DefaultCurrency); err != nil {
+		log.Fatalf("Failed to migrate amounts: %v", err)
+	}
+	if err := schema.Record(db, repository.SchemaVersion); err != nil {
+		log.Fatalf("Failed to record schema version: %v", err)
+	}
+
+	verifier, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		log.Fatalf("Failed to configure JWT verification: %v", err)
+	}
+
+	// /livez answers while the process does, /readyz while it serves and its
+	// database and gateways work. /health is the old name of /readyz.
+	var readiness server.Readiness
+	health := server.NewHealth(&readiness, cfg.Server.CheckTimeout)
+	health.Add("database", schema.Ping(db))
+	health.Add("schema", schema.Check(db, repository.SchemaVersion))
 
 	repo := repository.NewPaymentRepository(db)
-	gateway := &external.DummyGateway{}
-	svc := service.NewPaymentService(repo, gateway)
+	simulator := external.NewSimulatorGateway(cfg.Simulator)
+	svc := service.NewPaymentService(repo, newRouter(cfg, simulator, health))
 	h := handler.NewPaymentHandler(svc)
 
+	idempotent := idempotency.Middleware(idempotency.NewRepository(db), idempotency.Config{
+		TTL:         cfg.IdempotencyTTL,
+		LockTimeout: cfg.IdempotencyLockTimeout,
+		Scope:       middleware.IdempotencyScope,
+	})
+
 	r := mux.NewRouter()
-	r.HandleFunc("/payments", h.CreatePayment).Methods("POST")
-	r.HandleFunc("/payments/{id}", h.GetPayment).Methods("GET")
-	r.HandleFunc("/payments", h.ListPayments).Methods("GET").Queries("order_id", "{order_id}")
-	r.HandleFunc("/payments/{id}/refund", h.InitiateRefund).Methods("POST")
-	r.HandleFunc("/payments/{id}/refund", h.GetRefundStatus).Methods("GET")
-	r.HandleFunc("/payments/webhook", h.PaymentWebhook).Methods("POST")
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	log.Printf("Starting payment-service on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	r.NotFoundHandler = problem.Handler(problem.ErrNotFound)
+	r.MethodNotAllowedHandler = problem.Handler(problem.ErrMethodNotAllowed)
+	// Webhooks come from the gateway, which proves itself with a signature
+	// rather than a bearer token.
+	signed := middleware.WebhookSignature(cfg.WebhookSecret, cfg.WebhookTolerance)
+	r.Handle("/payments/webhook", signed(http.HandlerFunc(h.PaymentWebhook))).Methods("POST")
+
+	r.Handle("/livez", health.Live()).Methods("GET")
+	r.Handle("/readyz", health.Ready()).Methods("GET")
+	r.Handle("/health", health.Ready()).Methods("GET")
+
+	// Every other route requires a token whose role holds the route's
+	// permission.
+	guard := auth.NewRouteGuard(handler.Policy)
+	api := r.NewRoute().Subrouter()
+	api.Use(auth.Middleware(verifier))
+	api.Use(guard.Middleware)
+	guard.Require(api.Handle("/payments", idempotent(http.HandlerFunc(h.CreatePayment))).Methods("POST"), handler.PermCreatePayment)
+	guard.Require(api.HandleFunc("/payments/{id}", h.GetPayment).Methods("GET"), handler.PermReadPayments)
+	guard.Require(api.HandleFunc("/payments", h.ListPayments).Methods("GET"), handler.PermReadPayments)
+	guard.Require(api.HandleFunc("/payments/{id}/capture", h.CapturePayment).Methods("POST"), handler.PermCapturePayment)
+	guard.Require(api.HandleFunc("/payments/{id}/void", h.VoidPayment).Methods("POST"), handler.PermVoidPayment)
+	guard.Require(api.HandleFunc("/payments/{id}/refund", h.InitiateRefund).Methods("POST"), handler.PermRefundPayment)
+	guard.Require(api.HandleFunc("/payments/{id}/cancellation-refund", h.RefundCancelled).Methods("POST"), handler.PermRefundCancelled)
+	guard.Require(api.HandleFunc("/payments/{id}/refunds", h.ListRefunds).Methods("GET"), handler.PermReadPayments)
+	guard.Require(api.HandleFunc("/payments/{id}/refund", h.GetLatestRefund).Methods("GET"), handler.PermReadPayments)
+
+	// Payment outcomes are reported to order-service from the callback
+	// outbox. Without a notifier they stay queued until one is configured.
+	workers := server.NewWorkers()
+	if orders := newOrderNotifier(cfg); orders != nil {
+		relay := outbox.NewRelay(repository.NewCallbackRepository(db), orders, cfg.Callbacks.PollInterval, cfg.Callbacks.BatchSize)
+		workers.Go(relay.Run)
+	}
+
+	// Serve until SIGINT or SIGTERM, then drain before stopping the workers
+	// and dropping the simulator's pending webhooks.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	srv := server.New(":"+cfg.Port, problem.RequestIDMiddleware(r), cfg.Server)
+	log.Printf("Starting payment-service on port %s", cfg.Port)
+	runErr := server.Run(ctx, srv, cfg.Server, &readiness, func(ctx context.Context) {
+		if err := workers.Stop(ctx); err != nil {
+			log.Printf("Background workers did not stop: %v", err)
+		}
+		if err := simulator.Shutdown(ctx); err != nil {
+			log.Printf("Simulator webhooks did not finish: %v", err)
+		}
+	})
+	if runErr != nil {
+		log.Fatalf("payment-service stopped with an error: %v", runErr)
+	}
+	log.Println("payment-service stopped")
+}
+
+// newRouter registers every gateway this service knows, together with its
+// health check, and routes payments among them as configured.
+func newRouter(cfg config.Config, simulator *external.SimulatorGateway, health *server.Health) *external.Router {
+	registry := external.NewRegistry()
+	if err := registry.Register("dummy", &external.DummyGateway{}); err != nil {
+		log.Fatalf("Failed to register gateway: %v", err)
+	}
+	if err := registry.Register("simulator", simulator); err != nil {
+		log.Fatalf("Failed to register gateway: %v", err)
+	}
+	for _, name := range registry.Names() {
+		gateway, _ := registry.Get(name)
+		health.Add("gateway:"+name, external.GatewayCheck(gateway))
+	}
+
+	router, err := external.NewRouter(registry, cfg.Routing)
+	if err != nil {
+		log.Fatalf("Invalid gateway routing: %v", err)
+	}
+	log.Printf("Payment gateways %v, default %s", registry.Names(), cfg.Routing.Default)
+	return router
+}
+
+// newOrderNotifier reports payment outcomes to order-service when this
+// service can sign its own tokens; otherwise callbacks are not delivered.
+func newOrderNotifier(cfg config.Config) external.OrderNotifier {
+	tokens, err := auth.NewServiceTokens(cfg.Auth)
+	if err != nil {
+		log.Printf("Order callbacks disabled: %v", err)
+		return nil
+	}
+	return external.NewOrderClient(cfg.Orders, tokens)
 }
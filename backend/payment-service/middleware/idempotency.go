@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"zamato/pkg/auth"
+)
+
+// IdempotencyScope namespaces Idempotency-Key records by route and, when
+// known, by the calling user or service, so that one caller can never replay
+// another caller's response.
+func IdempotencyScope(r *http.Request) string {
+	scope := r.Method + " " + r.URL.Path
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		if p.Role == auth.RoleService {
+			scope += " service:" + p.Service
+		} else {
+			scope += " user:" + strconv.FormatUint(uint64(p.UserID), 10)
+		}
+	}
+	return scope
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"zamato/pkg/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller *auth.Principal
+		want   string
+	}{
+		{name: "anonymous", want: "POST /payments"},
+		{name: "user", caller: &auth.Principal{UserID: 7, Role: auth.RoleAdmin}, want: "POST /payments user:7"},
+		{name: "service", caller: &auth.Principal{Role: auth.RoleService, Service: "order-service"}, want: "POST /payments service:order-service"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/payments", nil)
+			if tt.caller != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), *tt.caller))
+			}
+			assert.Equal(t, tt.want, IdempotencyScope(req))
+		})
+	}
+}
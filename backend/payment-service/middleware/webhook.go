@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"payment-service/webhook"
+	"zamato/pkg/problem"
+)
+
+var errWebhooksNotConfigured = problem.New(problem.Unauthorized, "webhooks_not_configured", "webhooks are not configured")
+
+const maxWebhookBytes = 1 << 20
+
+// WebhookSignature rejects requests whose webhook.SignatureHeader is not a
+// valid signature of the body made with secret within tolerance of now. An
+// empty secret rejects every request.
+func WebhookSignature(secret string, tolerance time.Duration) func(http.Handler) http.Handler {
+	if secret == "" {
+		log.Println("WEBHOOK_SECRET not set, all webhooks will be rejected")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if secret == "" {
+				problem.Write(w, r, errWebhooksNotConfigured)
+				return
+			}
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes))
+			if err != nil {
+				problem.Write(w, r, fmt.Errorf("%w: failed to read request body", problem.ErrInvalidRequest))
+				return
+			}
+			if err := webhook.Verify(secret, r.Header.Get(webhook.SignatureHeader), body, tolerance, time.Now()); err != nil {
+				problem.Write(w, r, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
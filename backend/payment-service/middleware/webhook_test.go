@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"payment-service/webhook"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	payload := `{"id":"evt_1","type":"payment.succeeded"}`
+
+	tests := []struct {
+		name       string
+		secret     string
+		signature  string
+		wantStatus int
+	}{
+		{name: "valid", secret: "secret", signature: webhook.Sign("secret", time.Now(), []byte(payload)), wantStatus: http.StatusOK},
+		{name: "missing signature", secret: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong secret", secret: "secret", signature: webhook.Sign("other", time.Now(), []byte(payload)), wantStatus: http.StatusUnauthorized},
+		{name: "stale", secret: "secret", signature: webhook.Sign("secret", time.Now().Add(-time.Hour), []byte(payload)), wantStatus: http.StatusUnauthorized},
+		{name: "not configured", signature: webhook.Sign("", time.Now(), []byte(payload)), wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/payments/webhook", strings.NewReader(payload))
+			if tt.signature != "" {
+				req.Header.Set(webhook.SignatureHeader, tt.signature)
+			}
+			w := httptest.NewRecorder()
+
+			WebhookSignature(tt.secret, 5*time.Minute)(next).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, payload, gotBody)
+			}
+		})
+	}
+}
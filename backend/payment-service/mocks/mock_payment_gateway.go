@@ -6,6 +6,7 @@ package mocks
 import (
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	money "zamato/pkg/money"
 )
 
 // MockPaymentGateway is a mock of PaymentGateway interface.
@@ -31,17 +32,61 @@ func (m *MockPaymentGateway) EXPECT() *MockPaymentGatewayMockRecorder {
 	return m.recorder
 }
 
-// Process mocks base method.
-func (m *MockPaymentGateway) Process(amount float64) (string, error) {
+// Authorize mocks base method.
+func (m *MockPaymentGateway) Authorize(amount money.Money, paymentMethod, reference string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Process", amount)
+	ret := m.ctrl.Call(m, "Authorize", amount, paymentMethod, reference)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// Process indicates an expected call of Process.
-func (mr *MockPaymentGatewayMockRecorder) Process(amount interface{}) *gomock.Call {
+// Authorize indicates an expected call of Authorize.
+func (mr *MockPaymentGatewayMockRecorder) Authorize(amount, paymentMethod, reference interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Process", reflect.TypeOf((*MockPaymentGateway)(nil).Process), amount)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authorize", reflect.TypeOf((*MockPaymentGateway)(nil).Authorize), amount, paymentMethod, reference)
+}
+
+// Capture mocks base method.
+func (m *MockPaymentGateway) Capture(authorizationID string, amount money.Money) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Capture", authorizationID, amount)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Capture indicates an expected call of Capture.
+func (mr *MockPaymentGatewayMockRecorder) Capture(authorizationID, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capture", reflect.TypeOf((*MockPaymentGateway)(nil).Capture), authorizationID, amount)
+}
+
+// Void mocks base method.
+func (m *MockPaymentGateway) Void(authorizationID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Void", authorizationID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Void indicates an expected call of Void.
+func (mr *MockPaymentGatewayMockRecorder) Void(authorizationID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Void", reflect.TypeOf((*MockPaymentGateway)(nil).Void), authorizationID)
+}
+
+// Refund mocks base method.
+func (m *MockPaymentGateway) Refund(transactionID string, amount money.Money, reference string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refund", transactionID, amount, reference)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Refund indicates an expected call of Refund.
+func (mr *MockPaymentGatewayMockRecorder) Refund(transactionID, amount, reference interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refund", reflect.TypeOf((*MockPaymentGateway)(nil).Refund), transactionID, amount, reference)
 }
@@ -4,9 +4,11 @@
 package mocks
 
 import (
-	models "payment-service/models"
 	gomock "github.com/golang/mock/gomock"
+	models "payment-service/models"
+	repository "payment-service/repository"
 	reflect "reflect"
+	money "zamato/pkg/money"
 )
 
 // MockPaymentRepository is a mock of PaymentRepository interface.
@@ -57,52 +59,89 @@ func (mr *MockPaymentRepositoryMockRecorder) FindByID(id interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByID", reflect.TypeOf((*MockPaymentRepository)(nil).FindByID), id)
 }
 
-func (m *MockPaymentRepository) FindByOrderID(orderID string) ([]*models.Payment, error) {
+func (m *MockPaymentRepository) SearchPayments(filter repository.PaymentFilter, after *repository.PaymentCursor, limit int) ([]*models.Payment, *repository.PaymentCursor, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindByOrderID", orderID)
+	ret := m.ctrl.Call(m, "SearchPayments", filter, after, limit)
 	ret0, _ := ret[0].([]*models.Payment)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(*repository.PaymentCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
-func (mr *MockPaymentRepositoryMockRecorder) FindByOrderID(orderID interface{}) *gomock.Call {
+func (mr *MockPaymentRepositoryMockRecorder) SearchPayments(filter, after, limit interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByOrderID", reflect.TypeOf((*MockPaymentRepository)(nil).FindByOrderID), orderID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchPayments", reflect.TypeOf((*MockPaymentRepository)(nil).SearchPayments), filter, after, limit)
 }
 
-func (m *MockPaymentRepository) SaveRefund(refund *models.Refund) error {
+func (m *MockPaymentRepository) SaveRefund(refund *models.Refund, limit money.Money) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveRefund", refund)
+	ret := m.ctrl.Call(m, "SaveRefund", refund, limit)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (mr *MockPaymentRepositoryMockRecorder) SaveRefund(refund interface{}) *gomock.Call {
+func (mr *MockPaymentRepositoryMockRecorder) SaveRefund(refund, limit interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRefund", reflect.TypeOf((*MockPaymentRepository)(nil).SaveRefund), refund)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRefund", reflect.TypeOf((*MockPaymentRepository)(nil).SaveRefund), refund, limit)
 }
 
-func (m *MockPaymentRepository) FindRefundByPaymentID(paymentID string) (*models.Refund, error) {
+func (m *MockPaymentRepository) FindRefundsByPaymentID(paymentID string) ([]*models.Refund, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindRefundByPaymentID", paymentID)
-	ret0, _ := ret[0].(*models.Refund)
+	ret := m.ctrl.Call(m, "FindRefundsByPaymentID", paymentID)
+	ret0, _ := ret[0].([]*models.Refund)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (mr *MockPaymentRepositoryMockRecorder) FindRefundByPaymentID(paymentID interface{}) *gomock.Call {
+func (mr *MockPaymentRepositoryMockRecorder) FindRefundsByPaymentID(paymentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindRefundsByPaymentID", reflect.TypeOf((*MockPaymentRepository)(nil).FindRefundsByPaymentID), paymentID)
+}
+
+func (m *MockPaymentRepository) UpdatePayment(payment *models.Payment, fromStatus string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePayment", payment, fromStatus)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (mr *MockPaymentRepositoryMockRecorder) UpdatePayment(payment, fromStatus interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePayment", reflect.TypeOf((*MockPaymentRepository)(nil).UpdatePayment), payment, fromStatus)
+}
+
+func (m *MockPaymentRepository) UpdateRefundResult(id, status, transactionID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRefundResult", id, status, transactionID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (mr *MockPaymentRepositoryMockRecorder) UpdateRefundResult(id, status, transactionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRefundResult", reflect.TypeOf((*MockPaymentRepository)(nil).UpdateRefundResult), id, status, transactionID)
+}
+
+func (m *MockPaymentRepository) UpdateRefundStatus(id, status string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRefundStatus", id, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (mr *MockPaymentRepositoryMockRecorder) UpdateRefundStatus(id, status interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindRefundByPaymentID", reflect.TypeOf((*MockPaymentRepository)(nil).FindRefundByPaymentID), paymentID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRefundStatus", reflect.TypeOf((*MockPaymentRepository)(nil).UpdateRefundStatus), id, status)
 }
 
-func (m *MockPaymentRepository) UpdatePaymentStatus(id, status string) error {
+func (m *MockPaymentRepository) ProcessWebhookEvent(event *models.WebhookEvent, apply func(repository.PaymentRepository) error) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdatePaymentStatus", id, status)
+	ret := m.ctrl.Call(m, "ProcessWebhookEvent", event, apply)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (mr *MockPaymentRepositoryMockRecorder) UpdatePaymentStatus(id, status interface{}) *gomock.Call {
+func (mr *MockPaymentRepositoryMockRecorder) ProcessWebhookEvent(event, apply interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePaymentStatus", reflect.TypeOf((*MockPaymentRepository)(nil).UpdatePaymentStatus), id, status)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessWebhookEvent", reflect.TypeOf((*MockPaymentRepository)(nil).ProcessWebhookEvent), event, apply)
 }
@@ -4,10 +4,11 @@
 package mocks
 
 import (
+	gomock "github.com/golang/mock/gomock"
 	io "io"
 	models "payment-service/models"
-	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	money "zamato/pkg/money"
 )
 
 // MockPaymentService is a mock of PaymentService interface.
@@ -33,16 +34,17 @@ func (m *MockPaymentService) EXPECT() *MockPaymentServiceMockRecorder {
 	return m.recorder
 }
 
-func (m *MockPaymentService) CreatePayment(payment *models.Payment) error {
+func (m *MockPaymentService) CreatePayment(req models.CreatePaymentRequest) (*models.Payment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreatePayment", payment)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "CreatePayment", req)
+	ret0, _ := ret[0].(*models.Payment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-func (mr *MockPaymentServiceMockRecorder) CreatePayment(payment interface{}) *gomock.Call {
+func (mr *MockPaymentServiceMockRecorder) CreatePayment(req interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePayment", reflect.TypeOf((*MockPaymentService)(nil).CreatePayment), payment)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePayment", reflect.TypeOf((*MockPaymentService)(nil).CreatePayment), req)
 }
 
 func (m *MockPaymentService) GetPayment(id string) (*models.Payment, error) {
@@ -58,43 +60,69 @@ func (mr *MockPaymentServiceMockRecorder) GetPayment(id interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPayment", reflect.TypeOf((*MockPaymentService)(nil).GetPayment), id)
 }
 
-func (m *MockPaymentService) ListPaymentsByOrder(orderID string) ([]*models.Payment, error) {
+func (m *MockPaymentService) SearchPayments(query models.PaymentQuery) (*models.PaymentPage, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListPaymentsByOrder", orderID)
-	ret0, _ := ret[0].([]*models.Payment)
+	ret := m.ctrl.Call(m, "SearchPayments", query)
+	ret0, _ := ret[0].(*models.PaymentPage)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (mr *MockPaymentServiceMockRecorder) ListPaymentsByOrder(orderID interface{}) *gomock.Call {
+func (mr *MockPaymentServiceMockRecorder) SearchPayments(query interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPaymentsByOrder", reflect.TypeOf((*MockPaymentService)(nil).ListPaymentsByOrder), orderID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchPayments", reflect.TypeOf((*MockPaymentService)(nil).SearchPayments), query)
 }
 
-func (m *MockPaymentService) InitiateRefund(paymentID string) (*models.Refund, error) {
+func (m *MockPaymentService) CapturePayment(id string, amount *money.Money) (*models.Payment, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "InitiateRefund", paymentID)
-	ret0, _ := ret[0].(*models.Refund)
+	ret := m.ctrl.Call(m, "CapturePayment", id, amount)
+	ret0, _ := ret[0].(*models.Payment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockPaymentServiceMockRecorder) CapturePayment(id, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CapturePayment", reflect.TypeOf((*MockPaymentService)(nil).CapturePayment), id, amount)
+}
+
+func (m *MockPaymentService) VoidPayment(id string) (*models.Payment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VoidPayment", id)
+	ret0, _ := ret[0].(*models.Payment)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (mr *MockPaymentServiceMockRecorder) InitiateRefund(paymentID interface{}) *gomock.Call {
+func (mr *MockPaymentServiceMockRecorder) VoidPayment(id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitiateRefund", reflect.TypeOf((*MockPaymentService)(nil).InitiateRefund), paymentID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VoidPayment", reflect.TypeOf((*MockPaymentService)(nil).VoidPayment), id)
 }
 
-func (m *MockPaymentService) GetRefundStatus(paymentID string) (*models.Refund, error) {
+func (m *MockPaymentService) InitiateRefund(paymentID string, amount *money.Money, reason string) (*models.Refund, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetRefundStatus", paymentID)
+	ret := m.ctrl.Call(m, "InitiateRefund", paymentID, amount, reason)
 	ret0, _ := ret[0].(*models.Refund)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (mr *MockPaymentServiceMockRecorder) GetRefundStatus(paymentID interface{}) *gomock.Call {
+func (mr *MockPaymentServiceMockRecorder) InitiateRefund(paymentID, amount, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitiateRefund", reflect.TypeOf((*MockPaymentService)(nil).InitiateRefund), paymentID, amount, reason)
+}
+
+func (m *MockPaymentService) ListRefunds(paymentID string) ([]*models.Refund, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListRefunds", paymentID)
+	ret0, _ := ret[0].([]*models.Refund)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (mr *MockPaymentServiceMockRecorder) ListRefunds(paymentID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRefundStatus", reflect.TypeOf((*MockPaymentService)(nil).GetRefundStatus), paymentID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRefunds", reflect.TypeOf((*MockPaymentService)(nil).ListRefunds), paymentID)
 }
 
 func (m *MockPaymentService) HandleWebhook(body io.Reader) error {
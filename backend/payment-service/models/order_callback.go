@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// OrderCallback is a payment outcome waiting to be reported to order-service.
+// Callbacks are written in the same transaction as the payment change they
+// report and delivered afterwards by outbox.Relay.
+type OrderCallback struct {
+	ID          uint64 `gorm:"primaryKey;autoIncrement"`
+	OrderID     string `gorm:"type:varchar(255)"`
+	PaymentID   string `gorm:"type:varchar(255)"`
+	Status      string `gorm:"type:varchar(20)"`
+	CreatedAt   time.Time
+	DeliveredAt *time.Time `gorm:"index"`
+	// AbandonedAt is set when order-service refused the callback in a way
+	// that sending it again cannot change.
+	AbandonedAt *time.Time
+	Attempts    int
+	LastError   string
+}
@@ -1,20 +1,106 @@
 package models
 
+import (
+	"time"
+	"zamato/pkg/money"
+)
+
+// Payment statuses. A payment is saved as initiated before the gateway is
+// asked, then authorized and either captured, which completes it, or voided,
+// which releases the hold. Payments created with automatic capture go from
+// initiated straight to completed. When the gateway confirms a capture only
+// later, the payment stays pending until a payment.succeeded or
+// payment.failed webhook arrives.
+//
+//	initiated -> authorized -> completed
+//	                        -> voided
+//	initiated -> pending -> completed
+//	                     -> failed
+//	initiated -> failed
+const (
+	PaymentStatusInitiated  = "initiated"
+	PaymentStatusPending    = "pending"
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCompleted  = "completed"
+	PaymentStatusVoided     = "voided"
+	PaymentStatusFailed     = "failed"
+)
+
+// Capture methods. With CaptureAutomatic the payment is captured in full as
+// soon as it is authorized; with CaptureManual it stays authorized until
+// POST /payments/{id}/capture or /void.
+const (
+	CaptureAutomatic = "automatic"
+	CaptureManual    = "manual"
+)
+
 type Payment struct {
-	ID            string  `json:"id"`
-	OrderID       string  `json:"order_id"`
-	Amount        float64 `json:"amount"`
-	Status        string  `json:"status"`
-	TransactionID string  `json:"transaction_id"` // <-- Add this field
-	CreatedAt     int64   `json:"created_at"`
+	ID      string      `json:"id" gorm:"primaryKey;index:idx_payments_created,priority:2"`
+	OrderID string      `json:"order_id" gorm:"index"`
+	Amount  money.Money `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`
+	// CapturedAmount is what was actually charged. It may be less than
+	// Amount after a partial capture and is the most that can be refunded.
+	CapturedAmount  money.Money `json:"captured_amount" gorm:"embedded;embeddedPrefix:captured_"`
+	Status          string      `json:"status"`
+	CaptureMethod   string      `json:"capture_method,omitempty"`
+	PaymentMethod   string      `json:"payment_method,omitempty"`
+	Provider        string      `json:"provider,omitempty"`
+	AuthorizationID string      `json:"authorization_id,omitempty"`
+	TransactionID   string      `json:"transaction_id"` // <-- Add this field
+	CreatedAt       int64       `json:"created_at" gorm:"index:idx_payments_created,priority:1"`
 	// ...other fields...
 }
 
+// CreatePaymentRequest is the body of POST /payments: the only fields a
+// caller may set. The ID, status and gateway references of the payment are
+// assigned by payment-service.
+type CreatePaymentRequest struct {
+	OrderID       string      `json:"order_id"`
+	Amount        money.Money `json:"amount"`
+	PaymentMethod string      `json:"payment_method,omitempty"`
+	CaptureMethod string      `json:"capture_method,omitempty"`
+}
+
+// PaymentQuery selects the payments listed by GET /payments. Every filter
+// that is set must match. From is inclusive and To exclusive; MinAmount and
+// MaxAmount are inclusive and only match payments in their currency. Limit
+// defaults to 20 and Cursor continues from an earlier page.
+type PaymentQuery struct {
+	OrderID       string
+	Statuses      []string
+	Provider      string
+	TransactionID string
+	From          *time.Time
+	To            *time.Time
+	MinAmount     *money.Money
+	MaxAmount     *money.Money
+	Limit         int
+	Cursor        string
+}
+
+// PaymentPage is a page of GET /payments, with the token of the next page
+// in NextCursor unless it is the last.
+type PaymentPage struct {
+	Payments   []*Payment `json:"payments"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// Refund statuses. Failed refunds do not count towards the refunded total of
+// a payment.
+const (
+	RefundStatusInitiated = "initiated"
+	RefundStatusCompleted = "completed"
+	RefundStatusFailed    = "failed"
+)
+
 type Refund struct {
-	ID        string  `json:"id"`
-	PaymentID string  `json:"payment_id"`
-	Status    string  `json:"status"`
-	Amount    float64 `json:"amount"`
-	CreatedAt int64   `json:"created_at"`
+	ID        string      `json:"id"`
+	PaymentID string      `json:"payment_id" gorm:"index"`
+	Status    string      `json:"status"`
+	Amount    money.Money `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`
+	Reason    string      `json:"reason,omitempty"`
+	// TransactionID is the gateway's reference for the refund.
+	TransactionID string `json:"transaction_id,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
 	// ...other fields...
 }
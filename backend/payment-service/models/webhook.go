@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// WebhookEvent records a gateway webhook that has been processed, so that
+// redeliveries of the same event ID are ignored.
+type WebhookEvent struct {
+	ID         string `gorm:"primaryKey;type:varchar(255)"`
+	Type       string `gorm:"type:varchar(50)"`
+	ReceivedAt time.Time
+}
@@ -0,0 +1,81 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"payment-service/external"
+	"payment-service/repository"
+	"time"
+)
+
+// Relay polls the order callback outbox and delivers pending callbacks to
+// order-service.
+//
+// A callback is marked as delivered only after order-service accepted it, so
+// a crash between the two steps sends it again: delivery is at-least-once,
+// which order-service tolerates because reporting the same payment outcome
+// twice leaves the order unchanged.
+type Relay struct {
+	repo      repository.CallbackRepository
+	orders    external.OrderNotifier
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRelay(repo repository.CallbackRepository, orders external.OrderNotifier, interval time.Duration, batchSize int) *Relay {
+	return &Relay{repo: repo, orders: orders, interval: interval, batchSize: batchSize}
+}
+
+// Run delivers pending callbacks every interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.DeliverPending(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("order callback relay: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverPending delivers one batch of pending callbacks in order and
+// returns how many were delivered. A callback order-service refuses for good
+// is abandoned and logged, and the batch goes on. Any other failure stops
+// the batch so that callbacks are not reordered while order-service is
+// unavailable; the failed callback is retried on the next call.
+func (r *Relay) DeliverPending(ctx context.Context) (int, error) {
+	callbacks, err := r.repo.FetchPending(r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, callback := range callbacks {
+		err := r.orders.NotifyPayment(ctx, callback.OrderID, callback.PaymentID, callback.Status)
+		var statusErr *external.StatusError
+		switch {
+		case err == nil:
+			if err := r.repo.MarkDelivered(callback.ID); err != nil {
+				return delivered, err
+			}
+			delivered++
+		case errors.As(err, &statusErr) && !statusErr.Retryable():
+			log.Printf("order callback relay: abandoning %s callback %d for order %s: %v", callback.Status, callback.ID, callback.OrderID, err)
+			if err := r.repo.MarkAbandoned(callback.ID, err.Error()); err != nil {
+				return delivered, err
+			}
+		default:
+			if markErr := r.repo.MarkFailed(callback.ID, err.Error()); markErr != nil {
+				log.Printf("order callback relay: failed to record error for callback %d: %v", callback.ID, markErr)
+			}
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
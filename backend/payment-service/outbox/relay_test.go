@@ -0,0 +1,114 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"payment-service/external"
+	"payment-service/models"
+	"payment-service/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type sentCallback struct {
+	OrderID, PaymentID, Status string
+}
+
+// fakeOrders records delivered callbacks and fails with the queued errors
+// first.
+type fakeOrders struct {
+	errs []error
+	sent []sentCallback
+}
+
+func (f *fakeOrders) NotifyPayment(ctx context.Context, orderID, paymentID, status string) error {
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	f.sent = append(f.sent, sentCallback{orderID, paymentID, status})
+	return nil
+}
+
+func setupRelay(t *testing.T, orders external.OrderNotifier) (*Relay, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.OrderCallback{}))
+	return NewRelay(repository.NewCallbackRepository(db), orders, 0, 10), db
+}
+
+func enqueue(t *testing.T, db *gorm.DB, orderID, paymentID, status string) {
+	assert.NoError(t, db.Create(&models.OrderCallback{OrderID: orderID, PaymentID: paymentID, Status: status}).Error)
+}
+
+func TestRelay_DeliverPending(t *testing.T) {
+	orders := &fakeOrders{}
+	relay, db := setupRelay(t, orders)
+	enqueue(t, db, "1", "pay_1", models.PaymentStatusCompleted)
+	enqueue(t, db, "2", "pay_2", models.PaymentStatusFailed)
+
+	n, err := relay.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []sentCallback{
+		{"1", "pay_1", models.PaymentStatusCompleted},
+		{"2", "pay_2", models.PaymentStatusFailed},
+	}, orders.sent)
+
+	// Nothing left to deliver.
+	n, err = relay.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestRelay_RetriesTransientFailures(t *testing.T) {
+	orders := &fakeOrders{errs: []error{errors.New("connection refused")}}
+	relay, db := setupRelay(t, orders)
+	enqueue(t, db, "1", "pay_1", models.PaymentStatusCompleted)
+	enqueue(t, db, "2", "pay_2", models.PaymentStatusCompleted)
+
+	n, err := relay.DeliverPending(context.Background())
+	assert.Error(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, orders.sent)
+
+	var failed models.OrderCallback
+	assert.NoError(t, db.Order("id asc").First(&failed).Error)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "connection refused", failed.LastError)
+	assert.Nil(t, failed.DeliveredAt)
+
+	n, err = relay.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "pay_1", orders.sent[0].PaymentID)
+}
+
+func TestRelay_AbandonsRefusedCallbacks(t *testing.T) {
+	orders := &fakeOrders{errs: []error{&external.StatusError{StatusCode: http.StatusNotFound, Body: "order not found"}}}
+	relay, db := setupRelay(t, orders)
+	enqueue(t, db, "1", "pay_1", models.PaymentStatusCompleted)
+	enqueue(t, db, "2", "pay_2", models.PaymentStatusCompleted)
+
+	n, err := relay.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []sentCallback{{"2", "pay_2", models.PaymentStatusCompleted}}, orders.sent)
+
+	var abandoned models.OrderCallback
+	assert.NoError(t, db.Order("id asc").First(&abandoned).Error)
+	assert.NotNil(t, abandoned.AbandonedAt)
+	assert.Contains(t, abandoned.LastError, "404")
+
+	// Abandoned callbacks are not sent again.
+	n, err = relay.DeliverPending(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
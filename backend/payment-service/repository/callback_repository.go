@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"payment-service/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CallbackRepository gives the outbox relay access to order callbacks that
+// still have to be delivered.
+type CallbackRepository interface {
+	FetchPending(limit int) ([]models.OrderCallback, error)
+	MarkDelivered(id uint64) error
+	MarkFailed(id uint64, reason string) error
+	MarkAbandoned(id uint64, reason string) error
+}
+
+type callbackRepository struct {
+	db *gorm.DB
+}
+
+func NewCallbackRepository(db *gorm.DB) CallbackRepository {
+	return &callbackRepository{db: db}
+}
+
+// FetchPending returns up to limit callbacks that were neither delivered nor
+// abandoned, oldest first.
+func (r *callbackRepository) FetchPending(limit int) ([]models.OrderCallback, error) {
+	var callbacks []models.OrderCallback
+	err := r.db.Where("delivered_at IS NULL AND abandoned_at IS NULL").Order("id asc").Limit(limit).Find(&callbacks).Error
+	return callbacks, err
+}
+
+func (r *callbackRepository) MarkDelivered(id uint64) error {
+	return r.db.Model(&models.OrderCallback{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"delivered_at": time.Now(),
+		"attempts":     gorm.Expr("attempts + 1"),
+		"last_error":   "",
+	}).Error
+}
+
+func (r *callbackRepository) MarkFailed(id uint64, reason string) error {
+	return r.db.Model(&models.OrderCallback{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+	}).Error
+}
+
+func (r *callbackRepository) MarkAbandoned(id uint64, reason string) error {
+	return r.db.Model(&models.OrderCallback{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"abandoned_at": time.Now(),
+		"attempts":     gorm.Expr("attempts + 1"),
+		"last_error":   reason,
+	}).Error
+}
+
+// enqueueCallback writes the outcome of payment to the callback outbox using
+// tx, so that it is committed or rolled back together with the payment
+// change. Only completed and failed payments are reported; other statuses
+// are left alone.
+func enqueueCallback(tx *gorm.DB, payment *models.Payment) error {
+	if payment.Status != models.PaymentStatusCompleted && payment.Status != models.PaymentStatusFailed {
+		return nil
+	}
+	return tx.Create(&models.OrderCallback{
+		OrderID:   payment.OrderID,
+		PaymentID: payment.ID,
+		Status:    payment.Status,
+	}).Error
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"payment-service/models"
+	"zamato/pkg/money"
+
+	"gorm.io/gorm"
+)
+
+// legacyAmountColumns lists the float columns that amounts were stored in
+// before they became money.Money, and the prefix of their replacement.
+var legacyAmountColumns = []struct {
+	model  interface{}
+	column string
+	prefix string
+}{
+	{&models.Payment{}, "amount", "amount_"},
+	{&models.Refund{}, "amount", "amount_"},
+}
+
+// MigrateLegacyAmounts copies amounts from the old float columns into the
+// minor-unit columns, assuming they were in currency, and drops the old
+// columns. It also fills in the captured amount of payments completed before
+// it was recorded. It must run after AutoMigrate and is a no-op once
+// everything has been migrated.
+func MigrateLegacyAmounts(db *gorm.DB, currency string) error {
+	if !money.ValidCurrency(currency) {
+		return fmt.Errorf("%w: %q", money.ErrInvalidCurrency, currency)
+	}
+	scale := math.Pow10(money.Exponent(currency))
+
+	for _, c := range legacyAmountColumns {
+		if !db.Migrator().HasColumn(c.model, c.column) {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Unscoped().Model(c.model).
+				Where(c.prefix + "currency = '' OR " + c.prefix + "currency IS NULL").
+				UpdateColumns(map[string]interface{}{
+					c.prefix + "minor":    gorm.Expr("ROUND("+c.column+" * ?)", scale),
+					c.prefix + "currency": currency,
+				}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(c.model, c.column)
+		})
+		if err != nil {
+			return fmt.Errorf("migrate %s: %w", c.column, err)
+		}
+	}
+
+	// Payments completed before captures were tracked were charged in full.
+	return db.Model(&models.Payment{}).
+		Where("status = ? AND (captured_currency = '' OR captured_currency IS NULL)", models.PaymentStatusCompleted).
+		UpdateColumns(map[string]interface{}{
+			"captured_minor":    gorm.Expr("amount_minor"),
+			"captured_currency": gorm.Expr("amount_currency"),
+		}).Error
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"payment-service/models"
+	"testing"
+	"zamato/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type legacyPayment struct {
+	ID      string `gorm:"primaryKey"`
+	OrderID string
+	Amount  float64
+	Status  string
+}
+
+func (legacyPayment) TableName() string { return "payments" }
+
+type legacyRefund struct {
+	ID        string `gorm:"primaryKey"`
+	PaymentID string
+	Amount    float64
+}
+
+func (legacyRefund) TableName() string { return "refunds" }
+
+func TestMigrateLegacyAmounts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&legacyPayment{}, &legacyRefund{}))
+	assert.NoError(t, db.Create(&legacyPayment{ID: "p1", OrderID: "o1", Amount: 26.97, Status: "completed"}).Error)
+	assert.NoError(t, db.Create(&legacyPayment{ID: "p2", OrderID: "o2", Amount: 5, Status: "failed"}).Error)
+	assert.NoError(t, db.Create(&legacyRefund{ID: "r1", PaymentID: "p1", Amount: 0.1}).Error)
+
+	assert.NoError(t, db.AutoMigrate(&models.Payment{}, &models.Refund{}))
+	assert.NoError(t, MigrateLegacyAmounts(db, "USD"))
+
+	var payment models.Payment
+	assert.NoError(t, db.First(&payment, "id = ?", "p1").Error)
+	assert.Equal(t, money.MustParse("26.97", "USD"), payment.Amount)
+	assert.Equal(t, money.MustParse("26.97", "USD"), payment.CapturedAmount)
+
+	var failed models.Payment
+	assert.NoError(t, db.First(&failed, "id = ?", "p2").Error)
+	assert.True(t, failed.CapturedAmount.IsZero())
+
+	var refund models.Refund
+	assert.NoError(t, db.First(&refund, "id = ?", "r1").Error)
+	assert.Equal(t, money.MustParse("0.10", "USD"), refund.Amount)
+
+	assert.False(t, db.Migrator().HasColumn(&models.Payment{}, "amount"))
+	assert.False(t, db.Migrator().HasColumn(&models.Refund{}, "amount"))
+
+	// Running again is a no-op.
+	assert.NoError(t, MigrateLegacyAmounts(db, "USD"))
+}
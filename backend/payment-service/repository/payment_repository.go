@@ -1,19 +1,62 @@
 package repository
 
 import (
+	"errors"
 	"payment-service/models"
+	"time"
+	"zamato/pkg/money"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrRefundLimitExceeded is returned by SaveRefund when the refund would
+	// take the refunded total of a payment above the allowed limit.
+	ErrRefundLimitExceeded = errors.New("refund exceeds refundable amount")
+	// ErrDuplicateWebhookEvent is returned by ProcessWebhookEvent for an event
+	// that has already been processed.
+	ErrDuplicateWebhookEvent = errors.New("webhook event already processed")
+	// ErrPaymentStatusConflict is returned by UpdatePayment when the payment
+	// is no longer in the expected status.
+	ErrPaymentStatusConflict = errors.New("payment status changed concurrently")
+	// ErrRefundStatusConflict is returned by UpdateRefundStatus when the
+	// refund is no longer initiated.
+	ErrRefundStatusConflict = errors.New("refund already settled")
 )
 
 // PaymentRepository defines the repository interface for payment persistence.
 type PaymentRepository interface {
 	Save(payment *models.Payment) error
 	FindByID(id string) (*models.Payment, error)
-	FindByOrderID(orderID string) ([]*models.Payment, error)
-	SaveRefund(refund *models.Refund) error
-	FindRefundByPaymentID(paymentID string) (*models.Refund, error)
-	UpdatePaymentStatus(id, status string) error
+	SearchPayments(filter PaymentFilter, after *PaymentCursor, limit int) ([]*models.Payment, *PaymentCursor, error)
+	SaveRefund(refund *models.Refund, limit money.Money) error
+	FindRefundsByPaymentID(paymentID string) ([]*models.Refund, error)
+	UpdatePayment(payment *models.Payment, fromStatus string) error
+	UpdateRefundStatus(id, status string) error
+	UpdateRefundResult(id, status, transactionID string) error
+	ProcessWebhookEvent(event *models.WebhookEvent, apply func(repo PaymentRepository) error) error
+}
+
+// PaymentFilter selects payments on every field that is set. CreatedFrom is
+// inclusive and CreatedTo exclusive. MinAmount and MaxAmount are inclusive
+// and also restrict the payments to their currency.
+type PaymentFilter struct {
+	OrderID       string
+	Statuses      []string
+	Provider      string
+	TransactionID string
+	CreatedFrom   *time.Time
+	CreatedTo     *time.Time
+	MinAmount     *money.Money
+	MaxAmount     *money.Money
+}
+
+// PaymentCursor is a position in a list of payments sorted newest first by
+// creation time, then ID.
+type PaymentCursor struct {
+	CreatedAt int64
+	ID        string
 }
 
 type paymentRepository struct {
@@ -24,8 +67,16 @@ func NewPaymentRepository(db *gorm.DB) PaymentRepository {
 	return &paymentRepository{db: db}
 }
 
+// Save stores a new payment. A payment that is already completed or failed
+// gets its order callback queued in the same transaction, like in
+// UpdatePayment.
 func (r *paymentRepository) Save(payment *models.Payment) error {
-	return r.db.Create(payment).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		return enqueueCallback(tx, payment)
+	})
 }
 
 func (r *paymentRepository) FindByID(id string) (*models.Payment, error) {
@@ -36,26 +87,164 @@ func (r *paymentRepository) FindByID(id string) (*models.Payment, error) {
 	return &p, nil
 }
 
-func (r *paymentRepository) FindByOrderID(orderID string) ([]*models.Payment, error) {
-	var result []*models.Payment
-	if err := r.db.Where("order_id = ?", orderID).Find(&result).Error; err != nil {
-		return nil, err
+// SearchPayments returns up to limit payments matching filter, newest first,
+// starting after the given position, and the position of the last one if
+// more payments follow.
+func (r *paymentRepository) SearchPayments(filter PaymentFilter, after *PaymentCursor, limit int) ([]*models.Payment, *PaymentCursor, error) {
+	db := r.db
+	if filter.OrderID != "" {
+		db = db.Where("order_id = ?", filter.OrderID)
+	}
+	if len(filter.Statuses) > 0 {
+		db = db.Where("status IN ?", filter.Statuses)
+	}
+	if filter.Provider != "" {
+		db = db.Where("provider = ?", filter.Provider)
+	}
+	if filter.TransactionID != "" {
+		db = db.Where("transaction_id = ?", filter.TransactionID)
+	}
+	if filter.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", filter.CreatedFrom.Unix())
+	}
+	if filter.CreatedTo != nil {
+		db = db.Where("created_at < ?", filter.CreatedTo.Unix())
+	}
+	if filter.MinAmount != nil {
+		db = db.Where("amount_currency = ? AND amount_minor >= ?", filter.MinAmount.Currency, filter.MinAmount.Minor)
+	}
+	if filter.MaxAmount != nil {
+		db = db.Where("amount_currency = ? AND amount_minor <= ?", filter.MaxAmount.Currency, filter.MaxAmount.Minor)
+	}
+	if after != nil {
+		db = db.Where("(created_at < ? OR (created_at = ? AND id < ?))", after.CreatedAt, after.CreatedAt, after.ID)
 	}
-	return result, nil
+
+	var payments []*models.Payment
+	if err := db.Order("created_at desc, id desc").Limit(limit + 1).Find(&payments).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(payments) <= limit {
+		return payments, nil, nil
+	}
+	payments = payments[:limit]
+	last := payments[len(payments)-1]
+	return payments, &PaymentCursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
 }
 
-func (r *paymentRepository) SaveRefund(refund *models.Refund) error {
-	return r.db.Create(refund).Error
+// SaveRefund stores refund unless the payment's refunds that have not failed
+// would then add up to more than limit. The payment row is locked while the
+// total is checked so that concurrent refunds cannot both pass.
+func (r *paymentRepository) SaveRefund(refund *models.Refund, limit money.Money) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, "id = ?", refund.PaymentID).Error; err != nil {
+			return err
+		}
+
+		var refunded int64
+		err := tx.Model(&models.Refund{}).
+			Where("payment_id = ? AND status <> ?", refund.PaymentID, models.RefundStatusFailed).
+			Select("COALESCE(SUM(amount_minor), 0)").
+			Scan(&refunded).Error
+		if err != nil {
+			return err
+		}
+		total, err := money.New(refunded, limit.Currency).Add(refund.Amount)
+		if err != nil {
+			return err
+		}
+		cmp, err := total.Cmp(limit)
+		if err != nil {
+			return err
+		}
+		if cmp > 0 {
+			return ErrRefundLimitExceeded
+		}
+		return tx.Create(refund).Error
+	})
 }
 
-func (r *paymentRepository) FindRefundByPaymentID(paymentID string) (*models.Refund, error) {
-	var ref models.Refund
-	if err := r.db.First(&ref, "payment_id = ?", paymentID).Error; err != nil {
+// FindRefundsByPaymentID returns all refunds of a payment, oldest first.
+func (r *paymentRepository) FindRefundsByPaymentID(paymentID string) ([]*models.Refund, error) {
+	var refunds []*models.Refund
+	if err := r.db.Where("payment_id = ?", paymentID).Order("created_at asc, id asc").Find(&refunds).Error; err != nil {
 		return nil, err
 	}
-	return &ref, nil
+	return refunds, nil
+}
+
+// UpdatePayment stores the status, captured amount and gateway references of
+// payment, provided it is still in fromStatus. Otherwise it returns
+// ErrPaymentStatusConflict. A payment that becomes completed or failed gets
+// an order callback in the same transaction, so order-service learns of
+// every outcome it did not see in the answer to POST /payments.
+func (r *paymentRepository) UpdatePayment(payment *models.Payment, fromStatus string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Payment{}).
+			Where("id = ? AND status = ?", payment.ID, fromStatus).
+			Updates(map[string]interface{}{
+				"status":            payment.Status,
+				"provider":          payment.Provider,
+				"captured_minor":    payment.CapturedAmount.Minor,
+				"captured_currency": payment.CapturedAmount.Currency,
+				"authorization_id":  payment.AuthorizationID,
+				"transaction_id":    payment.TransactionID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPaymentStatusConflict
+		}
+		return enqueueCallback(tx, payment)
+	})
+}
+
+// UpdateRefundStatus settles an initiated refund with status. It returns
+// ErrRefundStatusConflict if the refund already settled, and
+// gorm.ErrRecordNotFound if there is no such refund.
+func (r *paymentRepository) UpdateRefundStatus(id, status string) error {
+	result := r.db.Model(&models.Refund{}).
+		Where("id = ? AND status = ?", id, models.RefundStatusInitiated).
+		Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	var count int64
+	if err := r.db.Model(&models.Refund{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrRefundStatusConflict
+}
+
+// UpdateRefundResult records the gateway's answer to a refund.
+func (r *paymentRepository) UpdateRefundResult(id, status, transactionID string) error {
+	return r.db.Model(&models.Refund{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":         status,
+		"transaction_id": transactionID,
+	}).Error
 }
 
-func (r *paymentRepository) UpdatePaymentStatus(id, status string) error {
-	return r.db.Model(&models.Payment{}).Where("id = ?", id).Update("status", status).Error
+// ProcessWebhookEvent records event and runs apply with a repository bound to
+// the same transaction, so an event is either fully applied and recorded or
+// not at all. Events that were recorded before are not applied again and
+// yield ErrDuplicateWebhookEvent.
+func (r *paymentRepository) ProcessWebhookEvent(event *models.WebhookEvent, apply func(repo PaymentRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDuplicateWebhookEvent
+		}
+		return apply(&paymentRepository{db: tx})
+	})
 }
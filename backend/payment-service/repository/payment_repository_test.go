@@ -3,6 +3,8 @@ package repository
 import (
 	"payment-service/models"
 	"testing"
+	"time"
+	"zamato/pkg/money"
 
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
@@ -12,7 +14,7 @@ import (
 func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
-	err = db.AutoMigrate(&models.Payment{}, &models.Refund{})
+	err = db.AutoMigrate(&models.Payment{}, &models.Refund{}, &models.WebhookEvent{}, &models.OrderCallback{})
 	assert.NoError(t, err)
 	return db
 }
@@ -22,7 +24,7 @@ func TestPaymentRepository_CRUD(t *testing.T) {
 	repo := NewPaymentRepository(db)
 
 	t.Run("Save and FindByID", func(t *testing.T) {
-		payment := &models.Payment{ID: "p1", Amount: 100, OrderID: "o1"}
+		payment := &models.Payment{ID: "p1", Amount: money.MustParse("100.00", "USD"), OrderID: "o1"}
 		err := repo.Save(payment)
 		assert.NoError(t, err)
 
@@ -31,32 +33,114 @@ func TestPaymentRepository_CRUD(t *testing.T) {
 		assert.Equal(t, payment.ID, got.ID)
 	})
 
-	t.Run("FindByOrderID", func(t *testing.T) {
-		payment := &models.Payment{ID: "p2", Amount: 200, OrderID: "o2"}
+	t.Run("SearchPayments by order", func(t *testing.T) {
+		payment := &models.Payment{ID: "p2", Amount: money.MustParse("200.00", "USD"), OrderID: "o2"}
 		_ = repo.Save(payment)
-		payments, err := repo.FindByOrderID("o2")
+		payments, next, err := repo.SearchPayments(PaymentFilter{OrderID: "o2"}, nil, 10)
 		assert.NoError(t, err)
+		assert.Nil(t, next)
 		assert.Len(t, payments, 1)
 		assert.Equal(t, "p2", payments[0].ID)
 	})
 
-	t.Run("SaveRefund and FindRefundByPaymentID", func(t *testing.T) {
-		refund := &models.Refund{ID: "r1", PaymentID: "p1", Amount: 100}
-		err := repo.SaveRefund(refund)
+	t.Run("SaveRefund and FindRefundsByPaymentID", func(t *testing.T) {
+		limit := money.MustParse("100.00", "USD")
+		assert.NoError(t, repo.SaveRefund(&models.Refund{ID: "r1", PaymentID: "p1", Amount: money.MustParse("40.00", "USD"), Status: models.RefundStatusInitiated, CreatedAt: 1}, limit))
+		assert.NoError(t, repo.SaveRefund(&models.Refund{ID: "r0", PaymentID: "p1", Amount: money.MustParse("50.00", "USD"), Status: models.RefundStatusFailed, CreatedAt: 2}, limit))
+		assert.NoError(t, repo.SaveRefund(&models.Refund{ID: "r2", PaymentID: "p1", Amount: money.MustParse("60.00", "USD"), CreatedAt: 3}, limit))
+
+		err := repo.SaveRefund(&models.Refund{ID: "r3", PaymentID: "p1", Amount: money.MustParse("0.01", "USD"), CreatedAt: 4}, limit)
+		assert.ErrorIs(t, err, ErrRefundLimitExceeded)
+
+		got, err := repo.FindRefundsByPaymentID("p1")
 		assert.NoError(t, err)
+		assert.Len(t, got, 3)
+		assert.Equal(t, []string{"r1", "r0", "r2"}, []string{got[0].ID, got[1].ID, got[2].ID})
+	})
+
+	t.Run("SaveRefund unknown payment", func(t *testing.T) {
+		err := repo.SaveRefund(&models.Refund{ID: "r4", PaymentID: "not-exist", Amount: money.MustParse("1.00", "USD")}, money.MustParse("1.00", "USD"))
+		assert.Error(t, err)
+	})
 
-		got, err := repo.FindRefundByPaymentID("p1")
+	t.Run("UpdatePayment", func(t *testing.T) {
+		payment := &models.Payment{ID: "p5", Amount: money.MustParse("50.00", "USD"), OrderID: "o5",
+			Status: models.PaymentStatusAuthorized, AuthorizationID: "auth_5"}
+		assert.NoError(t, repo.Save(payment))
+
+		captured := *payment
+		captured.Status = models.PaymentStatusCompleted
+		captured.CapturedAmount = money.MustParse("45.00", "USD")
+		captured.TransactionID = "txn_5"
+		assert.NoError(t, repo.UpdatePayment(&captured, models.PaymentStatusAuthorized))
+
+		got, _ := repo.FindByID("p5")
+		assert.Equal(t, models.PaymentStatusCompleted, got.Status)
+		assert.Equal(t, money.MustParse("45.00", "USD"), got.CapturedAmount)
+		assert.Equal(t, "txn_5", got.TransactionID)
+
+		// The capture is reported to order-service through the outbox.
+		callbacks, err := NewCallbackRepository(db).FetchPending(10)
 		assert.NoError(t, err)
-		assert.Equal(t, refund.ID, got.ID)
+		if assert.Len(t, callbacks, 1) {
+			assert.Equal(t, "o5", callbacks[0].OrderID)
+			assert.Equal(t, "p5", callbacks[0].PaymentID)
+			assert.Equal(t, models.PaymentStatusCompleted, callbacks[0].Status)
+		}
+
+		// The payment is no longer authorized, so a second change conflicts
+		// and enqueues nothing.
+		voided := *payment
+		voided.Status = models.PaymentStatusVoided
+		assert.ErrorIs(t, repo.UpdatePayment(&voided, models.PaymentStatusAuthorized), ErrPaymentStatusConflict)
+		callbacks, _ = NewCallbackRepository(db).FetchPending(10)
+		assert.Len(t, callbacks, 1)
 	})
 
-	t.Run("UpdatePaymentStatus", func(t *testing.T) {
-		payment := &models.Payment{ID: "p3", Amount: 300, OrderID: "o3", Status: "pending"}
-		_ = repo.Save(payment)
-		err := repo.UpdatePaymentStatus("p3", "completed")
+	t.Run("UpdateRefundResult", func(t *testing.T) {
+		assert.NoError(t, repo.UpdateRefundResult("r2", models.RefundStatusCompleted, "re_2"))
+		refunds, err := repo.FindRefundsByPaymentID("p1")
+		assert.NoError(t, err)
+		assert.Equal(t, models.RefundStatusCompleted, refunds[2].Status)
+		assert.Equal(t, "re_2", refunds[2].TransactionID)
+	})
+
+	t.Run("UpdateRefundStatus", func(t *testing.T) {
+		assert.NoError(t, repo.UpdateRefundStatus("r1", models.RefundStatusCompleted))
+		refunds, err := repo.FindRefundsByPaymentID("p1")
+		assert.NoError(t, err)
+		assert.Equal(t, models.RefundStatusCompleted, refunds[0].Status)
+
+		// A late failure cannot reopen the completed refund.
+		assert.ErrorIs(t, repo.UpdateRefundStatus("r1", models.RefundStatusFailed), ErrRefundStatusConflict)
+		refunds, _ = repo.FindRefundsByPaymentID("p1")
+		assert.Equal(t, models.RefundStatusCompleted, refunds[0].Status)
+
+		assert.ErrorIs(t, repo.UpdateRefundStatus("not-exist", models.RefundStatusFailed), gorm.ErrRecordNotFound)
+	})
+
+	t.Run("ProcessWebhookEvent", func(t *testing.T) {
+		assert.NoError(t, repo.SaveRefund(&models.Refund{ID: "r5", PaymentID: "p5", Amount: money.MustParse("10.00", "USD"), Status: models.RefundStatusInitiated}, money.MustParse("45.00", "USD")))
+		apply := func(tx PaymentRepository) error {
+			return tx.UpdateRefundStatus("r5", models.RefundStatusFailed)
+		}
+		assert.NoError(t, repo.ProcessWebhookEvent(&models.WebhookEvent{ID: "evt_1", Type: "refund.failed"}, apply))
+		refunds, _ := repo.FindRefundsByPaymentID("p5")
+		assert.Equal(t, models.RefundStatusFailed, refunds[0].Status)
+
+		err := repo.ProcessWebhookEvent(&models.WebhookEvent{ID: "evt_1", Type: "refund.failed"}, apply)
+		assert.ErrorIs(t, err, ErrDuplicateWebhookEvent)
+	})
+
+	t.Run("ProcessWebhookEvent rolls back on error", func(t *testing.T) {
+		err := repo.ProcessWebhookEvent(&models.WebhookEvent{ID: "evt_2", Type: "payment.succeeded"}, func(tx PaymentRepository) error {
+			return tx.UpdateRefundStatus("not-exist", models.RefundStatusCompleted)
+		})
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		// The event was not recorded, so a redelivery is processed again.
+		err = repo.ProcessWebhookEvent(&models.WebhookEvent{ID: "evt_2", Type: "payment.succeeded"}, func(PaymentRepository) error { return nil })
 		assert.NoError(t, err)
-		got, _ := repo.FindByID("p3")
-		assert.Equal(t, "completed", got.Status)
 	})
 
 	t.Run("FindByID not found", func(t *testing.T) {
@@ -65,29 +149,115 @@ func TestPaymentRepository_CRUD(t *testing.T) {
 		assert.Nil(t, got)
 	})
 
-	t.Run("FindRefundByPaymentID not found", func(t *testing.T) {
-		got, err := repo.FindRefundByPaymentID("not-exist")
-		assert.Error(t, err)
-		assert.Nil(t, got)
+	t.Run("FindRefundsByPaymentID not found", func(t *testing.T) {
+		got, err := repo.FindRefundsByPaymentID("not-exist")
+		assert.NoError(t, err)
+		assert.Len(t, got, 0)
 	})
 
-	t.Run("FindByOrderID not found", func(t *testing.T) {
-		payments, err := repo.FindByOrderID("not-exist")
+	t.Run("SearchPayments not found", func(t *testing.T) {
+		payments, _, err := repo.SearchPayments(PaymentFilter{OrderID: "not-exist"}, nil, 10)
 		assert.NoError(t, err)
 		assert.Len(t, payments, 0)
 	})
 
 	t.Run("Save duplicate payment returns error", func(t *testing.T) {
-		payment := &models.Payment{ID: "dup", Amount: 10, OrderID: "o4"}
+		payment := &models.Payment{ID: "dup", Amount: money.MustParse("10.00", "USD"), OrderID: "o4"}
 		_ = repo.Save(payment)
 		err := repo.Save(payment)
 		assert.Error(t, err)
 	})
 
 	t.Run("SaveRefund duplicate returns error", func(t *testing.T) {
-		refund := &models.Refund{ID: "dup-refund", PaymentID: "p1", Amount: 10}
-		_ = repo.SaveRefund(refund)
-		err := repo.SaveRefund(refund)
+		refund := &models.Refund{ID: "dup-refund", PaymentID: "p2", Amount: money.MustParse("10.00", "USD")}
+		limit := money.MustParse("200.00", "USD")
+		_ = repo.SaveRefund(refund, limit)
+		err := repo.SaveRefund(refund, limit)
 		assert.Error(t, err)
 	})
 }
+
+func TestPaymentRepository_SearchPayments(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	nextDay := day.AddDate(0, 0, 1)
+	seed := []*models.Payment{
+		{ID: "a", OrderID: "o1", Amount: money.MustParse("10.00", "USD"), Status: models.PaymentStatusCompleted, Provider: "dummy", TransactionID: "tx_a", CreatedAt: day.Unix()},
+		{ID: "b", OrderID: "o1", Amount: money.MustParse("25.00", "USD"), Status: models.PaymentStatusFailed, Provider: "simulator", CreatedAt: day.Unix()},
+		{ID: "c", OrderID: "o2", Amount: money.MustParse("40.00", "EUR"), Status: models.PaymentStatusCompleted, Provider: "dummy", CreatedAt: day.Add(time.Hour).Unix()},
+		{ID: "d", OrderID: "o3", Amount: money.MustParse("55.00", "USD"), Status: models.PaymentStatusAuthorized, Provider: "simulator", CreatedAt: nextDay.Unix()},
+	}
+	for _, p := range seed {
+		assert.NoError(t, repo.Save(p))
+	}
+	ids := func(payments []*models.Payment) []string {
+		out := []string{}
+		for _, p := range payments {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+	usd := func(amount string) *money.Money {
+		m := money.MustParse(amount, "USD")
+		return &m
+	}
+
+	tests := []struct {
+		name   string
+		filter PaymentFilter
+		want   []string
+	}{
+		{name: "all, newest first", want: []string{"d", "c", "b", "a"}},
+		{name: "order", filter: PaymentFilter{OrderID: "o1"}, want: []string{"b", "a"}},
+		{name: "statuses", filter: PaymentFilter{Statuses: []string{models.PaymentStatusCompleted, models.PaymentStatusAuthorized}}, want: []string{"d", "c", "a"}},
+		{name: "provider", filter: PaymentFilter{Provider: "simulator"}, want: []string{"d", "b"}},
+		{name: "transaction ID", filter: PaymentFilter{TransactionID: "tx_a"}, want: []string{"a"}},
+		{name: "created range", filter: PaymentFilter{CreatedFrom: &day, CreatedTo: &nextDay}, want: []string{"c", "b", "a"}},
+		{name: "amount range", filter: PaymentFilter{MinAmount: usd("20.00"), MaxAmount: usd("55.00")}, want: []string{"d", "b"}},
+		{name: "amount excludes other currencies", filter: PaymentFilter{MinAmount: usd("0.00")}, want: []string{"d", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := repo.SearchPayments(tt.filter, nil, 10)
+			assert.NoError(t, err)
+			assert.Nil(t, next)
+			assert.Equal(t, tt.want, ids(got))
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		first, next, err := repo.SearchPayments(PaymentFilter{}, nil, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"d", "c", "b"}, ids(first))
+		assert.Equal(t, &PaymentCursor{CreatedAt: day.Unix(), ID: "b"}, next)
+
+		second, next, err := repo.SearchPayments(PaymentFilter{}, next, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a"}, ids(second))
+		assert.Nil(t, next)
+	})
+}
+
+func TestPaymentRepository_SaveQueuesCallback(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	for _, p := range []*models.Payment{
+		{ID: "p1", OrderID: "o1", Amount: money.MustParse("10.00", "USD"), Status: models.PaymentStatusInitiated},
+		{ID: "p2", OrderID: "o2", Amount: money.MustParse("10.00", "USD"), Status: models.PaymentStatusAuthorized},
+		{ID: "p3", OrderID: "o3", Amount: money.MustParse("10.00", "USD"), Status: models.PaymentStatusCompleted},
+		{ID: "p4", OrderID: "o4", Amount: money.MustParse("10.00", "USD"), Status: models.PaymentStatusFailed},
+	} {
+		assert.NoError(t, repo.Save(p))
+	}
+
+	callbacks, err := NewCallbackRepository(db).FetchPending(10)
+	assert.NoError(t, err)
+	var got []string
+	for _, c := range callbacks {
+		got = append(got, c.PaymentID+":"+c.Status)
+	}
+	assert.ElementsMatch(t, []string{"p3:" + models.PaymentStatusCompleted, "p4:" + models.PaymentStatusFailed}, got)
+}
@@ -0,0 +1,6 @@
+package repository
+
+// SchemaVersion is the version of the schema this build migrates the
+// database to. Bump it with every change to the models or to the migrations
+// run at startup.
+const SchemaVersion = 2
@@ -1,73 +1,529 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"payment-service/external"
+	"payment-service/ids"
 	"payment-service/models"
 	"payment-service/repository"
+	"payment-service/webhook"
 	"time"
+	"zamato/pkg/money"
+	"zamato/pkg/pagination"
+	"zamato/pkg/problem"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPaymentNotFound      = problem.New(problem.NotFound, "payment_not_found", "payment not found")
+	ErrInvalidPayment       = problem.New(problem.Invalid, "invalid_payment", "invalid payment")
+	ErrInvalidPaymentState  = problem.New(problem.Conflict, "invalid_payment_state", "payment is not in a state that allows this")
+	ErrInvalidCaptureAmount = problem.New(problem.Invalid, "invalid_capture_amount", "invalid capture amount")
+	ErrGatewayFailed        = problem.New(problem.Upstream, "gateway_failed", "payment gateway failed")
+	ErrPaymentDeclined      = problem.New(problem.Declined, "payment_declined", "payment declined")
+	ErrPaymentNotRefundable = problem.New(problem.Unprocessable, "payment_not_refundable", "payment cannot be refunded")
+	ErrInvalidRefundAmount  = problem.New(problem.Invalid, "invalid_refund_amount", "invalid refund amount")
+	ErrRefundExceedsPayment = problem.New(problem.Unprocessable, "refund_exceeds_payment", "refund exceeds refundable amount")
+	ErrRefundNotFound       = problem.New(problem.NotFound, "refund_not_found", "payment has no refunds")
+	ErrWebhookTargetUnknown = problem.New(problem.NotFound, "webhook_target_unknown", "webhook refers to an unknown payment or refund")
+	ErrInvalidQuery         = problem.New(problem.Invalid, "invalid_query", "invalid payment query")
+	ErrPaymentNotRecorded   = problem.New(problem.Internal, "payment_not_recorded", "payment was sent to the gateway but its outcome could not be recorded")
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
 )
 
+// pageCursor is the position a next_cursor token holds.
+type pageCursor struct {
+	CreatedAt int64  `json:"t"`
+	ID        string `json:"id"`
+}
+
 // PaymentService defines the service interface for payment operations.
 type PaymentService interface {
-	CreatePayment(payment *models.Payment) error
+	CreatePayment(req models.CreatePaymentRequest) (*models.Payment, error)
 	GetPayment(id string) (*models.Payment, error)
-	ListPaymentsByOrder(orderID string) ([]*models.Payment, error)
-	InitiateRefund(paymentID string) (*models.Refund, error)
-	GetRefundStatus(paymentID string) (*models.Refund, error)
+	SearchPayments(query models.PaymentQuery) (*models.PaymentPage, error)
+	CapturePayment(id string, amount *money.Money) (*models.Payment, error)
+	VoidPayment(id string) (*models.Payment, error)
+	InitiateRefund(paymentID string, amount *money.Money, reason string) (*models.Refund, error)
+	ListRefunds(paymentID string) ([]*models.Refund, error)
 	HandleWebhook(body io.Reader) error
 }
 
 type paymentService struct {
-	repo    repository.PaymentRepository
-	gateway external.PaymentGateway
+	repo   repository.PaymentRepository
+	router *external.Router
 }
 
-func NewPaymentService(r repository.PaymentRepository, g external.PaymentGateway) PaymentService {
-	return &paymentService{repo: r, gateway: g}
+// NewPaymentService returns the payment service. Payments that complete or
+// fail after they were created are reported to order-service through the
+// callback outbox the repository writes to.
+func NewPaymentService(r repository.PaymentRepository, router *external.Router) PaymentService {
+	return &paymentService{repo: r, router: router}
 }
 
-func (s *paymentService) CreatePayment(payment *models.Payment) error {
-	// Process payment using gateway
-	txID, err := s.gateway.Process(float64(payment.Amount))
-	if err != nil {
-		return err
+// CreatePayment creates a payment under a new ID, authorizes its amount with
+// the provider the router chooses and, unless the request asks for manual
+// capture, captures it right away. The payment is saved as initiated before
+// the gateway is asked and updated with its answer, so that money is never
+// taken without a record. If that update fails, ErrPaymentNotRecorded is
+// returned: the request must not be retried, or the customer would be charged
+// twice.
+func (s *paymentService) CreatePayment(req models.CreatePaymentRequest) (*models.Payment, error) {
+	payment := &models.Payment{
+		ID:            ids.Payment(),
+		OrderID:       req.OrderID,
+		Amount:        req.Amount,
+		PaymentMethod: req.PaymentMethod,
+		CaptureMethod: req.CaptureMethod,
 	}
-	payment.TransactionID = txID
-	payment.Status = "completed"
+	switch payment.CaptureMethod {
+	case "":
+		payment.CaptureMethod = models.CaptureAutomatic
+	case models.CaptureAutomatic, models.CaptureManual:
+	default:
+		return nil, fmt.Errorf("%w: unknown capture_method %q", ErrInvalidPayment, payment.CaptureMethod)
+	}
+	if payment.OrderID == "" {
+		return nil, fmt.Errorf("%w: order_id is required", ErrInvalidPayment)
+	}
+	if !payment.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidPayment)
+	}
+
+	payment.Status = models.PaymentStatusInitiated
+	payment.CapturedAmount = money.Zero(payment.Amount.Currency)
 	payment.CreatedAt = time.Now().Unix()
-	return s.repo.Save(payment)
+	if err := s.repo.Save(payment); err != nil {
+		return nil, err
+	}
+
+	provider, authID, err := s.router.Authorize(payment.Amount, payment.PaymentMethod, payment.ID)
+	var gateway external.PaymentGateway
+	if err == nil {
+		gateway, err = s.router.Gateway(provider)
+	}
+	if err != nil {
+		s.failPayment(payment)
+		return nil, gatewayError("authorize", err)
+	}
+	processed := *payment
+	processed.Provider = provider
+	processed.AuthorizationID = authID
+	processed.Status = models.PaymentStatusAuthorized
+
+	if processed.CaptureMethod == models.CaptureAutomatic {
+		txID, err := gateway.Capture(authID, processed.Amount)
+		status, err := captureStatus(err)
+		if err != nil {
+			if voidErr := gateway.Void(authID); voidErr != nil {
+				log.Printf("failed to void authorization %s after failed capture: %v", authID, voidErr)
+			}
+			s.failPayment(&processed)
+			return nil, gatewayError("capture", err)
+		}
+		processed.TransactionID = txID
+		processed.CapturedAmount = processed.Amount
+		processed.Status = status
+	}
+	if err := s.updatePayment(&processed, models.PaymentStatusInitiated); err != nil {
+		log.Printf("payment %s is %s at %s but could not be recorded: %v", processed.ID, processed.Status, provider, err)
+		return nil, fmt.Errorf("%w: payment %s", ErrPaymentNotRecorded, processed.ID)
+	}
+	return &processed, nil
+}
+
+// failPayment records that the gateway turned down an initiated payment. The
+// caller is told either way, so an error is only logged.
+func (s *paymentService) failPayment(payment *models.Payment) {
+	failed := *payment
+	failed.Status = models.PaymentStatusFailed
+	if err := s.updatePayment(&failed, models.PaymentStatusInitiated); err != nil {
+		log.Printf("failed to mark payment %s as failed: %v", payment.ID, err)
+	}
+}
+
+// CapturePayment charges amount of an authorized payment, or all of it when
+// amount is nil. The part of the authorization that is not captured is
+// released, so a payment is captured at most once.
+func (s *paymentService) CapturePayment(id string, amount *money.Money) (*models.Payment, error) {
+	payment, err := s.findPayment(id)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != models.PaymentStatusAuthorized {
+		return nil, fmt.Errorf("%w: cannot capture a %s payment", ErrInvalidPaymentState, payment.Status)
+	}
+
+	captureAmount := payment.Amount
+	if amount != nil {
+		captureAmount = *amount
+		cmp, err := captureAmount.Cmp(payment.Amount)
+		if err != nil || cmp > 0 || !captureAmount.IsPositive() {
+			return nil, fmt.Errorf("%w: must be a positive amount of at most %s", ErrInvalidCaptureAmount, payment.Amount)
+		}
+	}
+
+	gateway, err := s.gateway(payment)
+	if err != nil {
+		return nil, err
+	}
+	txID, err := gateway.Capture(payment.AuthorizationID, captureAmount)
+	status, err := captureStatus(err)
+	if err != nil {
+		return nil, gatewayError("capture", err)
+	}
+	captured := *payment
+	captured.Status = status
+	captured.CapturedAmount = captureAmount
+	captured.TransactionID = txID
+	if err := s.updatePayment(&captured, models.PaymentStatusAuthorized); err != nil {
+		return nil, err
+	}
+	return &captured, nil
+}
+
+// VoidPayment releases the authorization of a payment that has not been
+// captured.
+func (s *paymentService) VoidPayment(id string) (*models.Payment, error) {
+	payment, err := s.findPayment(id)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != models.PaymentStatusAuthorized {
+		return nil, fmt.Errorf("%w: cannot void a %s payment", ErrInvalidPaymentState, payment.Status)
+	}
+
+	gateway, err := s.gateway(payment)
+	if err != nil {
+		return nil, err
+	}
+	if err := gateway.Void(payment.AuthorizationID); err != nil {
+		return nil, fmt.Errorf("%w: void: %v", ErrGatewayFailed, err)
+	}
+	voided := *payment
+	voided.Status = models.PaymentStatusVoided
+	if err := s.updatePayment(&voided, models.PaymentStatusAuthorized); err != nil {
+		return nil, err
+	}
+	return &voided, nil
+}
+
+// gateway returns the gateway of the provider that authorized payment.
+func (s *paymentService) gateway(payment *models.Payment) (external.PaymentGateway, error) {
+	gateway, err := s.router.Gateway(payment.Provider)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payment %s: %v", ErrGatewayFailed, payment.ID, err)
+	}
+	return gateway, nil
+}
+
+// captureStatus is the status of a payment after a capture that returned err.
+// A capture the gateway confirms later leaves the payment pending.
+func captureStatus(err error) (string, error) {
+	switch {
+	case err == nil:
+		return models.PaymentStatusCompleted, nil
+	case errors.Is(err, external.ErrCapturePending):
+		return models.PaymentStatusPending, nil
+	}
+	return "", err
+}
+
+// gatewayError wraps an error of the gateway operation op: declines become
+// ErrPaymentDeclined, anything else ErrGatewayFailed.
+func gatewayError(op string, err error) error {
+	if errors.Is(err, external.ErrDeclined) {
+		return fmt.Errorf("%w: %v", ErrPaymentDeclined, err)
+	}
+	return fmt.Errorf("%w: %s: %v", ErrGatewayFailed, op, err)
+}
+
+func (s *paymentService) updatePayment(payment *models.Payment, fromStatus string) error {
+	err := s.repo.UpdatePayment(payment, fromStatus)
+	if errors.Is(err, repository.ErrPaymentStatusConflict) {
+		return fmt.Errorf("%w: payment %s changed concurrently", ErrInvalidPaymentState, payment.ID)
+	}
+	return err
 }
 
 func (s *paymentService) GetPayment(id string) (*models.Payment, error) {
-	return s.repo.FindByID(id)
+	return s.findPayment(id)
 }
 
-func (s *paymentService) ListPaymentsByOrder(orderID string) ([]*models.Payment, error) {
-	return s.repo.FindByOrderID(orderID)
+// SearchPayments returns a page of the payments matching query, newest
+// first.
+func (s *paymentService) SearchPayments(query models.PaymentQuery) (*models.PaymentPage, error) {
+	filter, after, limit, err := paymentFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	payments, next, err := s.repo.SearchPayments(filter, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.PaymentPage{Payments: payments}
+	if page.Payments == nil {
+		page.Payments = []*models.Payment{}
+	}
+	if next != nil {
+		page.NextCursor = pagination.EncodeCursor(pageCursor{CreatedAt: next.CreatedAt, ID: next.ID})
+	}
+	return page, nil
 }
 
-func (s *paymentService) InitiateRefund(paymentID string) (*models.Refund, error) {
-	payment, err := s.repo.FindByID(paymentID)
-	if err != nil || payment == nil {
+func paymentFilter(query models.PaymentQuery) (repository.PaymentFilter, *repository.PaymentCursor, int, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit < 0 || limit > maxPageSize {
+		return repository.PaymentFilter{}, nil, 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxPageSize)
+	}
+	for _, status := range query.Statuses {
+		switch status {
+		case models.PaymentStatusInitiated, models.PaymentStatusPending, models.PaymentStatusAuthorized,
+			models.PaymentStatusCompleted, models.PaymentStatusVoided, models.PaymentStatusFailed:
+		default:
+			return repository.PaymentFilter{}, nil, 0, fmt.Errorf("%w: unknown status %q", ErrInvalidQuery, status)
+		}
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return repository.PaymentFilter{}, nil, 0, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+	if query.MinAmount != nil && query.MaxAmount != nil {
+		cmp, err := query.MinAmount.Cmp(*query.MaxAmount)
+		if err != nil {
+			return repository.PaymentFilter{}, nil, 0, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+		if cmp > 0 {
+			return repository.PaymentFilter{}, nil, 0, fmt.Errorf("%w: min_amount must not exceed max_amount", ErrInvalidQuery)
+		}
+	}
+
+	filter := repository.PaymentFilter{
+		OrderID:       query.OrderID,
+		Statuses:      query.Statuses,
+		Provider:      query.Provider,
+		TransactionID: query.TransactionID,
+		CreatedFrom:   query.From,
+		CreatedTo:     query.To,
+		MinAmount:     query.MinAmount,
+		MaxAmount:     query.MaxAmount,
+	}
+	var after *repository.PaymentCursor
+	if query.Cursor != "" {
+		var cursor pageCursor
+		if err := pagination.DecodeCursor(query.Cursor, &cursor); err != nil || cursor.ID == "" {
+			return repository.PaymentFilter{}, nil, 0, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+		after = &repository.PaymentCursor{CreatedAt: cursor.CreatedAt, ID: cursor.ID}
+	}
+	return filter, after, limit, nil
+}
+
+// InitiateRefund refunds amount of a completed payment, or whatever has not
+// been refunded yet when amount is nil. A payment may be refunded in several
+// parts as long as the refunds that have not failed do not add up to more
+// than the captured amount. The refund is recorded before the gateway is
+// asked, so that concurrent refunds cannot exceed the limit, and then marked
+// completed or failed with the gateway's answer.
+func (s *paymentService) InitiateRefund(paymentID string, amount *money.Money, reason string) (*models.Refund, error) {
+	payment, err := s.findPayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != models.PaymentStatusCompleted {
+		return nil, fmt.Errorf("%w: payment is %s", ErrPaymentNotRefundable, payment.Status)
+	}
+
+	var refundAmount money.Money
+	if amount != nil {
+		refundAmount = *amount
+		if refundAmount.Currency != payment.CapturedAmount.Currency || !refundAmount.IsPositive() {
+			return nil, fmt.Errorf("%w: must be a positive amount in %s", ErrInvalidRefundAmount, payment.CapturedAmount.Currency)
+		}
+	} else {
+		refundAmount, err = s.remainingAmount(payment)
+		if err != nil {
+			return nil, err
+		}
+		if !refundAmount.IsPositive() {
+			return nil, fmt.Errorf("%w: payment is already fully refunded", ErrRefundExceedsPayment)
+		}
+	}
+
+	gateway, err := s.gateway(payment)
+	if err != nil {
 		return nil, err
 	}
 	refund := &models.Refund{
-		ID:        "refund-id", // generate unique ID in real impl
+		ID:        ids.Refund(),
 		PaymentID: paymentID,
-		Status:    "initiated",
-		Amount:    payment.Amount,
+		Status:    models.RefundStatusInitiated,
+		Amount:    refundAmount,
+		Reason:    reason,
 		CreatedAt: time.Now().Unix(),
 	}
-	err = s.repo.SaveRefund(refund)
-	return refund, err
+	if err := s.repo.SaveRefund(refund, payment.CapturedAmount); err != nil {
+		if errors.Is(err, repository.ErrRefundLimitExceeded) {
+			return nil, ErrRefundExceedsPayment
+		}
+		return nil, err
+	}
+
+	txID, gatewayErr := gateway.Refund(payment.TransactionID, refundAmount, refund.ID)
+	refund.Status = models.RefundStatusCompleted
+	refund.TransactionID = txID
+	if gatewayErr != nil {
+		refund.Status = models.RefundStatusFailed
+	}
+	if err := s.repo.UpdateRefundResult(refund.ID, refund.Status, refund.TransactionID); err != nil {
+		return nil, err
+	}
+	if gatewayErr != nil {
+		return nil, fmt.Errorf("%w: refund: %v", ErrGatewayFailed, gatewayErr)
+	}
+	return refund, nil
 }
 
-func (s *paymentService) GetRefundStatus(paymentID string) (*models.Refund, error) {
-	return s.repo.FindRefundByPaymentID(paymentID)
+// ListRefunds returns every refund of a payment, oldest first.
+func (s *paymentService) ListRefunds(paymentID string) ([]*models.Refund, error) {
+	if _, err := s.findPayment(paymentID); err != nil {
+		return nil, err
+	}
+	return s.repo.FindRefundsByPaymentID(paymentID)
 }
 
+func (s *paymentService) findPayment(id string) (*models.Payment, error) {
+	payment, err := s.repo.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && payment == nil) {
+		return nil, ErrPaymentNotFound
+	}
+	return payment, err
+}
+
+// remainingAmount is the part of payment that has not been refunded yet.
+func (s *paymentService) remainingAmount(payment *models.Payment) (money.Money, error) {
+	refunds, err := s.repo.FindRefundsByPaymentID(payment.ID)
+	if err != nil {
+		return money.Money{}, err
+	}
+	remaining := payment.CapturedAmount
+	for _, refund := range refunds {
+		if refund.Status == models.RefundStatusFailed {
+			continue
+		}
+		if remaining, err = remaining.Sub(refund.Amount); err != nil {
+			return money.Money{}, err
+		}
+	}
+	return remaining, nil
+}
+
+// HandleWebhook applies a gateway event whose signature has already been
+// verified. Each event ID is applied at most once; redeliveries are
+// acknowledged without doing anything, and so are payment events that arrive
+// after the payment settled. Event types this service does not know are
+// acknowledged and ignored.
 func (s *paymentService) HandleWebhook(body io.Reader) error {
-	// ...parse webhook and update payment status...
-	return nil
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	event, err := webhook.Parse(payload)
+	if err != nil {
+		return err
+	}
+
+	var apply func(repo repository.PaymentRepository) error
+	switch event.Type {
+	case webhook.PaymentSucceeded, webhook.PaymentFailed:
+		data, err := event.PaymentData()
+		if err != nil {
+			return err
+		}
+		apply = func(repo repository.PaymentRepository) error {
+			return applyPaymentEvent(repo, event, data)
+		}
+	case webhook.RefundSucceeded, webhook.RefundFailed:
+		data, err := event.RefundData()
+		if err != nil {
+			return err
+		}
+		status := models.RefundStatusCompleted
+		if event.Type == webhook.RefundFailed {
+			status = models.RefundStatusFailed
+		}
+		apply = func(repo repository.PaymentRepository) error {
+			return applyRefundEvent(repo, event, data.RefundID, status)
+		}
+	default:
+		log.Printf("ignoring webhook event %s of unknown type %q", event.ID, event.Type)
+		apply = func(repository.PaymentRepository) error { return nil }
+	}
+
+	err = s.repo.ProcessWebhookEvent(&models.WebhookEvent{
+		ID:         event.ID,
+		Type:       string(event.Type),
+		ReceivedAt: time.Now(),
+	}, apply)
+	switch {
+	case errors.Is(err, repository.ErrDuplicateWebhookEvent):
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w: event %s", ErrWebhookTargetUnknown, event.ID)
+	}
+	return err
+}
+
+// applyRefundEvent settles an initiated refund with the outcome of a
+// refund.* event. Events for refunds that settled already are logged and
+// ignored, so that a late refund.failed cannot reopen a completed refund and
+// free its amount for another one.
+func applyRefundEvent(repo repository.PaymentRepository, event *webhook.Event, refundID, status string) error {
+	err := repo.UpdateRefundStatus(refundID, status)
+	if errors.Is(err, repository.ErrRefundStatusConflict) {
+		log.Printf("ignoring webhook event %s (%s) for settled refund %s", event.ID, event.Type, refundID)
+		return nil
+	}
+	return err
+}
+
+// applyPaymentEvent settles a pending or authorized payment with the outcome
+// of a payment.* event. A payment that completes this way is captured in
+// full, unless a capture already set the amount. Events for payments that
+// settled already arrived late or out of order; they are logged and ignored.
+func applyPaymentEvent(repo repository.PaymentRepository, event *webhook.Event, data *webhook.PaymentData) error {
+	payment, err := repo.FindByID(data.PaymentID)
+	if err != nil {
+		return err
+	}
+	if payment.Status != models.PaymentStatusPending && payment.Status != models.PaymentStatusAuthorized {
+		log.Printf("ignoring webhook event %s (%s) for %s payment %s", event.ID, event.Type, payment.Status, payment.ID)
+		return nil
+	}
+
+	settled := *payment
+	if event.Type == webhook.PaymentSucceeded {
+		settled.Status = models.PaymentStatusCompleted
+		if !settled.CapturedAmount.IsPositive() {
+			settled.CapturedAmount = settled.Amount
+		}
+		if data.TransactionID != "" {
+			settled.TransactionID = data.TransactionID
+		}
+	} else {
+		settled.Status = models.PaymentStatusFailed
+		settled.CapturedAmount = money.Zero(settled.Amount.Currency)
+	}
+	return repo.UpdatePayment(&settled, payment.Status)
 }
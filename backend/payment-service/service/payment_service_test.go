@@ -4,62 +4,326 @@ import (
 	"errors"
 	"strings"
 	"testing"
+	"time"
 
+	"payment-service/external"
+	"payment-service/ids"
 	"payment-service/mocks"
 	"payment-service/models"
+	"payment-service/repository"
+	"payment-service/webhook"
+	"zamato/pkg/money"
 
 	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
+var errSave = errors.New("save fail")
+
+// singleGateway routes every payment to g, registered as "test".
+func singleGateway(t *testing.T, g external.PaymentGateway) *external.Router {
+	registry := external.NewRegistry()
+	assert.NoError(t, registry.Register("test", g))
+	router, err := external.NewRouter(registry, external.RoutingPolicy{Default: "test"})
+	assert.NoError(t, err)
+	return router
+}
+
+// withStatus matches a payment with the given status.
+type withStatus string
+
+func (s withStatus) Matches(x interface{}) bool {
+	p, ok := x.(*models.Payment)
+	return ok && p.Status == string(s)
+}
+
+func (s withStatus) String() string { return "is a " + string(s) + " payment" }
+
+// initiated matches a payment saved before the gateway is asked.
+func initiated() gomock.Matcher {
+	return withStatus(models.PaymentStatusInitiated)
+}
+
 func TestPaymentService_CreatePayment(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockRepo := mocks.NewMockPaymentRepository(ctrl)
 	mockGateway := mocks.NewMockPaymentGateway(ctrl)
-	svc := NewPaymentService(mockRepo, mockGateway)
+	svc := NewPaymentService(mockRepo, singleGateway(t, mockGateway))
 
+	amount := money.MustParse("100.00", "USD")
 	tests := []struct {
-		name       string
-		amount     float64
-		gatewayErr error
-		repoErr    error
-		wantErr    bool
+		name          string
+		captureMethod string
+		modify        func(req *models.CreatePaymentRequest)
+		mockSetup     func()
+		wantErr       error
+		wantStatus    string
+		wantCaptured  money.Money
 	}{
 		{
-			name:   "success",
-			amount: 100,
+			name: "automatic capture",
+			mockSetup: func() {
+				mockRepo.EXPECT().Save(initiated()).Return(nil)
+				mockGateway.EXPECT().Authorize(amount, "", gomock.Any()).Return("auth_1", nil)
+				mockGateway.EXPECT().Capture("auth_1", amount).Return("txn_1", nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusInitiated).Return(nil)
+			},
+			wantStatus:   models.PaymentStatusCompleted,
+			wantCaptured: amount,
 		},
 		{
-			name:       "gateway error",
-			amount:     200,
-			gatewayErr: errors.New("gateway fail"),
-			wantErr:    true,
+			name:          "manual capture",
+			captureMethod: models.CaptureManual,
+			mockSetup: func() {
+				mockRepo.EXPECT().Save(initiated()).Return(nil)
+				mockGateway.EXPECT().Authorize(amount, "", gomock.Any()).Return("auth_1", nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusInitiated).Return(nil)
+			},
+			wantStatus:   models.PaymentStatusAuthorized,
+			wantCaptured: money.Zero("USD"),
 		},
 		{
-			name:    "repo error",
-			amount:  300,
-			repoErr: errors.New("repo fail"),
-			wantErr: true,
+			name: "authorization declined",
+			mockSetup: func() {
+				mockRepo.EXPECT().Save(initiated()).Return(nil)
+				mockGateway.EXPECT().Authorize(amount, "", gomock.Any()).Return("", errors.New("declined"))
+				mockRepo.EXPECT().UpdatePayment(withStatus(models.PaymentStatusFailed), models.PaymentStatusInitiated).Return(nil)
+			},
+			wantErr: ErrGatewayFailed,
+		},
+		{
+			name: "declined",
+			mockSetup: func() {
+				mockRepo.EXPECT().Save(initiated()).Return(nil)
+				mockGateway.EXPECT().Authorize(amount, "", gomock.Any()).Return("", external.ErrInsufficientFunds)
+				mockRepo.EXPECT().UpdatePayment(withStatus(models.PaymentStatusFailed), models.PaymentStatusInitiated).Return(nil)
+			},
+			wantErr: ErrPaymentDeclined,
+		},
+		{
+			name: "capture confirmed later",
+			mockSetup: func() {
+				mockRepo.EXPECT().Save(initiated()).Return(nil)
+				mockGateway.EXPECT().Authorize(amount, "", gomock.Any()).Return("auth_1", nil)
+				mockGateway.EXPECT().Capture("auth_1", amount).Return("txn_1", external.ErrCapturePending)
+				mockRepo.EXPECT().UpdatePayment(withStatus(models.PaymentStatusPending), models.PaymentStatusInitiated).Return(nil)
+			},
+			wantStatus:   models.PaymentStatusPending,
+			wantCaptured: amount,
+		},
+		{
+			name: "capture fails and authorization is voided",
+			mockSetup: func() {
+				mockRepo.EXPECT().Save(initiated()).Return(nil)
+				mockGateway.EXPECT().Authorize(amount, "", gomock.Any()).Return("auth_1", nil)
+				mockGateway.EXPECT().Capture("auth_1", amount).Return("", errors.New("timeout"))
+				mockGateway.EXPECT().Void("auth_1").Return(nil)
+				mockRepo.EXPECT().UpdatePayment(withStatus(models.PaymentStatusFailed), models.PaymentStatusInitiated).Return(nil)
+			},
+			wantErr: ErrGatewayFailed,
+		},
+		{
+			name:          "unknown capture method",
+			captureMethod: "later",
+			wantErr:       ErrInvalidPayment,
+		},
+		{
+			name:    "missing order",
+			modify:  func(req *models.CreatePaymentRequest) { req.OrderID = "" },
+			wantErr: ErrInvalidPayment,
+		},
+		{
+			name:    "zero amount",
+			modify:  func(req *models.CreatePaymentRequest) { req.Amount = money.Zero("USD") },
+			wantErr: ErrInvalidPayment,
+		},
+		{
+			name: "not saved before the gateway is asked",
+			mockSetup: func() {
+				mockRepo.EXPECT().Save(initiated()).Return(errSave)
+			},
+			wantErr: errSave,
+		},
+		{
+			name: "outcome not recorded",
+			mockSetup: func() {
+				mockRepo.EXPECT().Save(initiated()).Return(nil)
+				mockGateway.EXPECT().Authorize(amount, "", gomock.Any()).Return("auth_1", nil)
+				mockGateway.EXPECT().Capture("auth_1", amount).Return("txn_1", nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusInitiated).Return(errSave)
+			},
+			wantErr: ErrPaymentNotRecorded,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := &models.Payment{Amount: tt.amount}
-			if tt.gatewayErr != nil {
-				mockGateway.EXPECT().Process(float64(tt.amount)).Return("", tt.gatewayErr)
-			} else {
-				mockGateway.EXPECT().Process(float64(tt.amount)).Return("txid", nil)
-				mockRepo.EXPECT().Save(gomock.Any()).Return(tt.repoErr)
+			if tt.mockSetup != nil {
+				tt.mockSetup()
 			}
-			err := svc.CreatePayment(p)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
+			req := models.CreatePaymentRequest{OrderID: "o1", Amount: amount, CaptureMethod: tt.captureMethod}
+			if tt.modify != nil {
+				tt.modify(&req)
 			}
+			p, err := svc.CreatePayment(req)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, p)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, ids.HasPrefix(p.ID, ids.PaymentPrefix), p.ID)
+			assert.Equal(t, "o1", p.OrderID)
+			assert.Equal(t, tt.wantStatus, p.Status)
+			assert.Equal(t, tt.wantCaptured, p.CapturedAmount)
+			assert.Equal(t, "auth_1", p.AuthorizationID)
+			assert.Equal(t, "test", p.Provider)
 		})
 	}
 }
 
+func TestPaymentService_CapturePayment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPaymentRepository(ctrl)
+	mockGateway := mocks.NewMockPaymentGateway(ctrl)
+	svc := NewPaymentService(mockRepo, singleGateway(t, mockGateway))
+
+	authorized := func() *models.Payment {
+		return &models.Payment{ID: "p1", OrderID: "o1", Amount: money.MustParse("100.00", "USD"), Status: models.PaymentStatusAuthorized, AuthorizationID: "auth_1"}
+	}
+	partial := money.MustParse("80.00", "USD")
+	tooMuch := money.MustParse("100.01", "USD")
+
+	tests := []struct {
+		name         string
+		payment      *models.Payment
+		amount       *money.Money
+		mockSetup    func()
+		wantErr      error
+		wantStatus   string
+		wantCaptured string
+	}{
+		{
+			name:    "full capture",
+			payment: authorized(),
+			mockSetup: func() {
+				mockGateway.EXPECT().Capture("auth_1", money.MustParse("100.00", "USD")).Return("txn_1", nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusAuthorized).Return(nil)
+			},
+			wantCaptured: "100.00",
+		},
+		{
+			name:    "partial capture",
+			payment: authorized(),
+			amount:  &partial,
+			mockSetup: func() {
+				mockGateway.EXPECT().Capture("auth_1", partial).Return("txn_1", nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusAuthorized).Return(nil)
+			},
+			wantCaptured: "80.00",
+		},
+		{
+			name:    "more than authorized",
+			payment: authorized(),
+			amount:  &tooMuch,
+			wantErr: ErrInvalidCaptureAmount,
+		},
+		{
+			name:    "already captured",
+			payment: &models.Payment{ID: "p1", Status: models.PaymentStatusCompleted},
+			wantErr: ErrInvalidPaymentState,
+		},
+		{
+			name:    "gateway error",
+			payment: authorized(),
+			mockSetup: func() {
+				mockGateway.EXPECT().Capture("auth_1", gomock.Any()).Return("", errors.New("expired"))
+			},
+			wantErr: ErrGatewayFailed,
+		},
+		{
+			name:    "capture confirmed later",
+			payment: authorized(),
+			mockSetup: func() {
+				mockGateway.EXPECT().Capture("auth_1", gomock.Any()).Return("txn_1", external.ErrCapturePending)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusAuthorized).Return(nil)
+			},
+			wantStatus:   models.PaymentStatusPending,
+			wantCaptured: "100.00",
+		},
+		{
+			name:    "concurrent change",
+			payment: authorized(),
+			mockSetup: func() {
+				mockGateway.EXPECT().Capture("auth_1", gomock.Any()).Return("txn_1", nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusAuthorized).Return(repository.ErrPaymentStatusConflict)
+			},
+			wantErr: ErrInvalidPaymentState,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.EXPECT().FindByID("p1").Return(tt.payment, nil)
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+			payment, err := svc.CapturePayment("p1", tt.amount)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			wantStatus := tt.wantStatus
+			if wantStatus == "" {
+				wantStatus = models.PaymentStatusCompleted
+			}
+			assert.Equal(t, wantStatus, payment.Status)
+			assert.Equal(t, money.MustParse(tt.wantCaptured, "USD"), payment.CapturedAmount)
+			assert.Equal(t, "txn_1", payment.TransactionID)
+		})
+	}
+}
+
+func TestPaymentService_VoidPayment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPaymentRepository(ctrl)
+	mockGateway := mocks.NewMockPaymentGateway(ctrl)
+	svc := NewPaymentService(mockRepo, singleGateway(t, mockGateway))
+
+	t.Run("success", func(t *testing.T) {
+		mockRepo.EXPECT().FindByID("p1").Return(&models.Payment{ID: "p1", Status: models.PaymentStatusAuthorized, AuthorizationID: "auth_1"}, nil)
+		mockGateway.EXPECT().Void("auth_1").Return(nil)
+		mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusAuthorized).Return(nil)
+
+		payment, err := svc.VoidPayment("p1")
+		assert.NoError(t, err)
+		assert.Equal(t, models.PaymentStatusVoided, payment.Status)
+	})
+
+	t.Run("provider no longer configured", func(t *testing.T) {
+		mockRepo.EXPECT().FindByID("p1").Return(&models.Payment{ID: "p1", Status: models.PaymentStatusAuthorized, Provider: "gone"}, nil)
+		_, err := svc.VoidPayment("p1")
+		assert.ErrorIs(t, err, ErrGatewayFailed)
+	})
+
+	t.Run("already captured", func(t *testing.T) {
+		mockRepo.EXPECT().FindByID("p1").Return(&models.Payment{ID: "p1", Status: models.PaymentStatusCompleted}, nil)
+		_, err := svc.VoidPayment("p1")
+		assert.ErrorIs(t, err, ErrInvalidPaymentState)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mockRepo.EXPECT().FindByID("p2").Return(nil, gorm.ErrRecordNotFound)
+		_, err := svc.VoidPayment("p2")
+		assert.ErrorIs(t, err, ErrPaymentNotFound)
+	})
+}
+
 func TestPaymentService_GetPayment(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -97,39 +361,55 @@ func TestPaymentService_GetPayment(t *testing.T) {
 	}
 }
 
-func TestPaymentService_ListPaymentsByOrder(t *testing.T) {
+func TestPaymentService_SearchPayments(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockRepo := mocks.NewMockPaymentRepository(ctrl)
 	svc := NewPaymentService(mockRepo, nil)
 
-	tests := []struct {
-		name     string
-		orderID  string
-		payments []*models.Payment
-		repoErr  error
-		wantErr  bool
+	t.Run("first page", func(t *testing.T) {
+		mockRepo.EXPECT().
+			SearchPayments(repository.PaymentFilter{OrderID: "order1", Statuses: []string{"completed"}}, nil, defaultPageSize).
+			Return([]*models.Payment{{ID: "1"}}, &repository.PaymentCursor{CreatedAt: 100, ID: "1"}, nil)
+		page, err := svc.SearchPayments(models.PaymentQuery{OrderID: "order1", Statuses: []string{"completed"}})
+		assert.NoError(t, err)
+		assert.Len(t, page.Payments, 1)
+		assert.NotEmpty(t, page.NextCursor)
+
+		mockRepo.EXPECT().
+			SearchPayments(repository.PaymentFilter{}, &repository.PaymentCursor{CreatedAt: 100, ID: "1"}, 5).
+			Return(nil, nil, nil)
+		next, err := svc.SearchPayments(models.PaymentQuery{Limit: 5, Cursor: page.NextCursor})
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.Payment{}, next.Payments)
+		assert.Empty(t, next.NextCursor)
+	})
+
+	t.Run("repo error", func(t *testing.T) {
+		mockRepo.EXPECT().SearchPayments(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, errors.New("fail"))
+		_, err := svc.SearchPayments(models.PaymentQuery{})
+		assert.Error(t, err)
+	})
+
+	from := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, -1)
+	usd := money.MustParse("10.00", "USD")
+	eur := money.MustParse("5.00", "EUR")
+	invalid := []struct {
+		name  string
+		query models.PaymentQuery
 	}{
-		{
-			name:     "success",
-			orderID:  "order1",
-			payments: []*models.Payment{{ID: "1"}},
-		},
-		{
-			name:    "repo error",
-			orderID: "order2",
-			repoErr: errors.New("fail"),
-			wantErr: true,
-		},
+		{name: "limit too large", query: models.PaymentQuery{Limit: maxPageSize + 1}},
+		{name: "unknown status", query: models.PaymentQuery{Statuses: []string{"settled"}}},
+		{name: "from after to", query: models.PaymentQuery{From: &from, To: &to}},
+		{name: "min above max", query: models.PaymentQuery{MinAmount: &usd, MaxAmount: &money.Money{Minor: 100, Currency: "USD"}}},
+		{name: "amounts in different currencies", query: models.PaymentQuery{MinAmount: &eur, MaxAmount: &usd}},
+		{name: "malformed cursor", query: models.PaymentQuery{Cursor: "not-a-cursor"}},
 	}
-
-	for _, tt := range tests {
+	for _, tt := range invalid {
 		t.Run(tt.name, func(t *testing.T) {
-			mockRepo.EXPECT().FindByOrderID(tt.orderID).Return(tt.payments, tt.repoErr)
-			_, err := svc.ListPaymentsByOrder(tt.orderID)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
-			}
+			_, err := svc.SearchPayments(tt.query)
+			assert.ErrorIs(t, err, ErrInvalidQuery)
 		})
 	}
 }
@@ -138,51 +418,153 @@ func TestPaymentService_InitiateRefund(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockRepo := mocks.NewMockPaymentRepository(ctrl)
-	svc := NewPaymentService(mockRepo, nil)
+	mockGateway := mocks.NewMockPaymentGateway(ctrl)
+	svc := NewPaymentService(mockRepo, singleGateway(t, mockGateway))
+
+	usd := func(amount string) *money.Money {
+		m := money.MustParse(amount, "USD")
+		return &m
+	}
+	completed := func(id, amount string) *models.Payment {
+		m := money.MustParse(amount, "USD")
+		return &models.Payment{ID: id, Amount: m, CapturedAmount: m, Status: models.PaymentStatusCompleted, TransactionID: "txn_" + id}
+	}
 
 	tests := []struct {
-		name      string
-		paymentID string
-		payment   *models.Payment
-		findErr   error
-		saveErr   error
-		wantErr   bool
+		name       string
+		paymentID  string
+		amount     *money.Money
+		payment    *models.Payment
+		findErr    error
+		refunds    []*models.Refund
+		saveErr    error
+		wantAmount string
+		wantErr    error
 	}{
 		{
-			name:      "success",
+			name:       "partial refund",
+			paymentID:  "1",
+			amount:     usd("30.00"),
+			payment:    completed("1", "100.00"),
+			wantAmount: "30.00",
+		},
+		{
+			name:      "remaining amount by default",
+			paymentID: "1",
+			payment:   completed("1", "100.00"),
+			refunds: []*models.Refund{
+				{Amount: money.MustParse("30.00", "USD"), Status: models.RefundStatusInitiated},
+				{Amount: money.MustParse("50.00", "USD"), Status: models.RefundStatusFailed},
+			},
+			wantAmount: "70.00",
+		},
+		{
+			name:      "nothing left to refund",
+			paymentID: "1",
+			payment:   completed("1", "100.00"),
+			refunds:   []*models.Refund{{Amount: money.MustParse("100.00", "USD"), Status: models.RefundStatusCompleted}},
+			wantErr:   ErrRefundExceedsPayment,
+		},
+		{
+			name:      "over-refund",
+			paymentID: "1",
+			amount:    usd("100.01"),
+			payment:   completed("1", "100.00"),
+			saveErr:   repository.ErrRefundLimitExceeded,
+			wantErr:   ErrRefundExceedsPayment,
+		},
+		{
+			name:      "wrong currency",
+			paymentID: "1",
+			amount:    &money.Money{Minor: 100, Currency: "EUR"},
+			payment:   completed("1", "100.00"),
+			wantErr:   ErrInvalidRefundAmount,
+		},
+		{
+			name:      "non-positive amount",
 			paymentID: "1",
-			payment:   &models.Payment{ID: "1", Amount: 100},
+			amount:    usd("0"),
+			payment:   completed("1", "100.00"),
+			wantErr:   ErrInvalidRefundAmount,
 		},
 		{
-			name:      "find error",
+			name:      "payment not completed",
+			paymentID: "1",
+			amount:    usd("1.00"),
+			payment:   &models.Payment{ID: "1", Amount: money.MustParse("100.00", "USD"), Status: "pending"},
+			wantErr:   ErrPaymentNotRefundable,
+		},
+		{
+			name:      "remaining of a partial capture",
+			paymentID: "1",
+			payment: &models.Payment{ID: "1", Amount: money.MustParse("100.00", "USD"), CapturedAmount: money.MustParse("80.00", "USD"),
+				Status: models.PaymentStatusCompleted, TransactionID: "txn_1"},
+			wantAmount: "80.00",
+		},
+		{
+			name:      "payment not found",
 			paymentID: "2",
-			findErr:   errors.New("not found"),
-			wantErr:   true,
+			findErr:   gorm.ErrRecordNotFound,
+			wantErr:   ErrPaymentNotFound,
 		},
 		{
 			name:      "save error",
 			paymentID: "3",
-			payment:   &models.Payment{ID: "3", Amount: 200},
-			saveErr:   errors.New("save fail"),
-			wantErr:   true,
+			amount:    usd("1.00"),
+			payment:   completed("3", "200.00"),
+			saveErr:   errSave,
+			wantErr:   errSave,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo.EXPECT().FindByID(tt.paymentID).Return(tt.payment, tt.findErr)
-			if tt.findErr == nil && tt.payment != nil {
-				mockRepo.EXPECT().SaveRefund(gomock.Any()).Return(tt.saveErr)
+			if tt.payment != nil && tt.amount == nil {
+				mockRepo.EXPECT().FindRefundsByPaymentID(tt.paymentID).Return(tt.refunds, nil)
 			}
-			_, err := svc.InitiateRefund(tt.paymentID)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
+			if tt.wantAmount != "" || tt.saveErr != nil {
+				mockRepo.EXPECT().SaveRefund(gomock.Any(), tt.payment.CapturedAmount).Return(tt.saveErr)
+			}
+			if tt.wantAmount != "" {
+				mockGateway.EXPECT().Refund("txn_"+tt.paymentID, money.MustParse(tt.wantAmount, "USD"), gomock.Any()).Return("re_1", nil)
+				mockRepo.EXPECT().UpdateRefundResult(gomock.Any(), models.RefundStatusCompleted, "re_1").Return(nil)
 			}
+
+			refund, err := svc.InitiateRefund(tt.paymentID, tt.amount, "customer request")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, money.MustParse(tt.wantAmount, "USD"), refund.Amount)
+			assert.Equal(t, models.RefundStatusCompleted, refund.Status)
+			assert.Equal(t, "re_1", refund.TransactionID)
+			assert.Equal(t, "customer request", refund.Reason)
+			assert.True(t, ids.HasPrefix(refund.ID, ids.RefundPrefix), refund.ID)
 		})
 	}
 }
 
-func TestPaymentService_GetRefundStatus(t *testing.T) {
+func TestPaymentService_InitiateRefund_GatewayFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRepo := mocks.NewMockPaymentRepository(ctrl)
+	mockGateway := mocks.NewMockPaymentGateway(ctrl)
+	svc := NewPaymentService(mockRepo, singleGateway(t, mockGateway))
+
+	amount := money.MustParse("10.00", "USD")
+	mockRepo.EXPECT().FindByID("1").Return(&models.Payment{ID: "1", Amount: amount, CapturedAmount: amount,
+		Status: models.PaymentStatusCompleted, TransactionID: "txn_1"}, nil)
+	mockRepo.EXPECT().SaveRefund(gomock.Any(), amount).Return(nil)
+	mockGateway.EXPECT().Refund("txn_1", amount, gomock.Any()).Return("", errors.New("refused"))
+	mockRepo.EXPECT().UpdateRefundResult(gomock.Any(), models.RefundStatusFailed, "").Return(nil)
+
+	_, err := svc.InitiateRefund("1", &amount, "")
+	assert.ErrorIs(t, err, ErrGatewayFailed)
+}
+
+func TestPaymentService_ListRefunds(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockRepo := mocks.NewMockPaymentRepository(ctrl)
@@ -191,18 +573,25 @@ func TestPaymentService_GetRefundStatus(t *testing.T) {
 	tests := []struct {
 		name      string
 		paymentID string
-		refund    *models.Refund
+		findErr   error
+		refunds   []*models.Refund
 		repoErr   error
 		wantErr   bool
 	}{
 		{
 			name:      "success",
 			paymentID: "1",
-			refund:    &models.Refund{ID: "r1"},
+			refunds:   []*models.Refund{{ID: "r1"}, {ID: "r2"}},
 		},
 		{
-			name:      "repo error",
+			name:      "payment not found",
 			paymentID: "2",
+			findErr:   gorm.ErrRecordNotFound,
+			wantErr:   true,
+		},
+		{
+			name:      "repo error",
+			paymentID: "3",
 			repoErr:   errors.New("fail"),
 			wantErr:   true,
 		},
@@ -210,11 +599,19 @@ func TestPaymentService_GetRefundStatus(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockRepo.EXPECT().FindRefundByPaymentID(tt.paymentID).Return(tt.refund, tt.repoErr)
-			_, err := svc.GetRefundStatus(tt.paymentID)
+			if tt.findErr != nil {
+				mockRepo.EXPECT().FindByID(tt.paymentID).Return(nil, tt.findErr)
+			} else {
+				mockRepo.EXPECT().FindByID(tt.paymentID).Return(&models.Payment{ID: tt.paymentID}, nil)
+				mockRepo.EXPECT().FindRefundsByPaymentID(tt.paymentID).Return(tt.refunds, tt.repoErr)
+			}
+			refunds, err := svc.ListRefunds(tt.paymentID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
 			}
+			if !tt.wantErr {
+				assert.Len(t, refunds, len(tt.refunds))
+			}
 		})
 	}
 }
@@ -222,25 +619,169 @@ func TestPaymentService_GetRefundStatus(t *testing.T) {
 func TestPaymentService_HandleWebhook(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
-	svc := NewPaymentService(nil, nil)
+	mockRepo := mocks.NewMockPaymentRepository(ctrl)
+	svc := NewPaymentService(mockRepo, nil)
+
+	pending := func() *models.Payment {
+		return &models.Payment{ID: "p1", OrderID: "o1", Amount: money.MustParse("100.00", "USD"), CapturedAmount: money.MustParse("100.00", "USD"), Status: models.PaymentStatusPending}
+	}
+	authorized := func() *models.Payment {
+		return &models.Payment{ID: "p1", OrderID: "o1", Amount: money.MustParse("100.00", "USD"), CapturedAmount: money.Zero("USD"), Status: models.PaymentStatusAuthorized, AuthorizationID: "auth_1"}
+	}
+
+	// applyWith runs the callback passed to ProcessWebhookEvent against the
+	// same mock, as the real repository does inside its transaction.
+	applyWith := func(event *models.WebhookEvent, apply func(repository.PaymentRepository) error) error {
+		return apply(mockRepo)
+	}
 
 	tests := []struct {
-		name    string
-		body    string
-		wantErr bool
+		name      string
+		body      string
+		mockSetup func()
+		wantErr   error
 	}{
 		{
-			name:    "noop",
+			name: "payment succeeded",
+			body: `{"id":"evt_1","type":"payment.succeeded","data":{"payment_id":"p1","transaction_id":"txn_1"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				mockRepo.EXPECT().FindByID("p1").Return(pending(), nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusPending).DoAndReturn(func(p *models.Payment, _ string) error {
+					assert.Equal(t, models.PaymentStatusCompleted, p.Status)
+					assert.Equal(t, money.MustParse("100.00", "USD"), p.CapturedAmount)
+					assert.Equal(t, "txn_1", p.TransactionID)
+					return nil
+				})
+			},
+		},
+		{
+			name: "manual capture succeeded",
+			body: `{"id":"evt_8","type":"payment.succeeded","data":{"payment_id":"p1","transaction_id":"txn_8"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				mockRepo.EXPECT().FindByID("p1").Return(authorized(), nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusAuthorized).DoAndReturn(func(p *models.Payment, _ string) error {
+					assert.Equal(t, models.PaymentStatusCompleted, p.Status)
+					assert.Equal(t, money.MustParse("100.00", "USD"), p.CapturedAmount, "captured in full")
+					assert.Equal(t, "txn_8", p.TransactionID)
+					return nil
+				})
+			},
+		},
+		{
+			name: "payment failed",
+			body: `{"id":"evt_2","type":"payment.failed","data":{"payment_id":"p1","failure_reason":"card_declined"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				mockRepo.EXPECT().FindByID("p1").Return(pending(), nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusPending).DoAndReturn(func(p *models.Payment, _ string) error {
+					assert.Equal(t, models.PaymentStatusFailed, p.Status)
+					assert.True(t, p.CapturedAmount.IsZero())
+					return nil
+				})
+			},
+		},
+		{
+			name: "late failure of a completed payment is ignored",
+			body: `{"id":"evt_9","type":"payment.failed","data":{"payment_id":"p1"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				completed := pending()
+				completed.Status = models.PaymentStatusCompleted
+				completed.TransactionID = "txn_1"
+				mockRepo.EXPECT().FindByID("p1").Return(completed, nil)
+			},
+		},
+		{
+			name: "late success of a voided payment is ignored",
+			body: `{"id":"evt_10","type":"payment.succeeded","data":{"payment_id":"p1"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				voided := authorized()
+				voided.Status = models.PaymentStatusVoided
+				mockRepo.EXPECT().FindByID("p1").Return(voided, nil)
+			},
+		},
+		{
+			name: "payment changed while the event was applied",
+			body: `{"id":"evt_11","type":"payment.succeeded","data":{"payment_id":"p1"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				mockRepo.EXPECT().FindByID("p1").Return(authorized(), nil)
+				mockRepo.EXPECT().UpdatePayment(gomock.Any(), models.PaymentStatusAuthorized).Return(repository.ErrPaymentStatusConflict)
+			},
+			wantErr: repository.ErrPaymentStatusConflict,
+		},
+		{
+			name: "refund succeeded",
+			body: `{"id":"evt_3","type":"refund.succeeded","data":{"refund_id":"r1","payment_id":"p1"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				mockRepo.EXPECT().UpdateRefundStatus("r1", models.RefundStatusCompleted).Return(nil)
+			},
+		},
+		{
+			name: "refund failed",
+			body: `{"id":"evt_4","type":"refund.failed","data":{"refund_id":"r1","payment_id":"p1"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				mockRepo.EXPECT().UpdateRefundStatus("r1", models.RefundStatusFailed).Return(nil)
+			},
+		},
+		{
+			name: "late failure of a settled refund is ignored",
+			body: `{"id":"evt_12","type":"refund.failed","data":{"refund_id":"r1","payment_id":"p1"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				mockRepo.EXPECT().UpdateRefundStatus("r1", models.RefundStatusFailed).Return(repository.ErrRefundStatusConflict)
+			},
+		},
+		{
+			name: "duplicate event is acknowledged",
+			body: `{"id":"evt_1","type":"payment.succeeded","data":{"payment_id":"p1"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).Return(repository.ErrDuplicateWebhookEvent)
+			},
+		},
+		{
+			name: "unknown type is recorded and ignored",
+			body: `{"id":"evt_5","type":"dispute.created","data":{}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+			},
+		},
+		{
+			name: "unknown payment",
+			body: `{"id":"evt_6","type":"payment.succeeded","data":{"payment_id":"nope"}}`,
+			mockSetup: func() {
+				mockRepo.EXPECT().ProcessWebhookEvent(gomock.Any(), gomock.Any()).DoAndReturn(applyWith)
+				mockRepo.EXPECT().FindByID("nope").Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantErr: ErrWebhookTargetUnknown,
+		},
+		{
+			name:    "malformed envelope",
 			body:    "{}",
-			wantErr: false,
+			wantErr: webhook.ErrMalformedEvent,
+		},
+		{
+			name:    "missing payment id",
+			body:    `{"id":"evt_7","type":"payment.succeeded","data":{}}`,
+			wantErr: webhook.ErrMalformedEvent,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
 			err := svc.HandleWebhook(strings.NewReader(tt.body))
-			if (err != nil) != tt.wantErr {
-				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
 			}
 		})
 	}
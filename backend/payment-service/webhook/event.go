@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"zamato/pkg/problem"
+)
+
+type EventType string
+
+const (
+	PaymentSucceeded EventType = "payment.succeeded"
+	PaymentFailed    EventType = "payment.failed"
+	RefundSucceeded  EventType = "refund.succeeded"
+	RefundFailed     EventType = "refund.failed"
+)
+
+var ErrMalformedEvent = problem.New(problem.Invalid, "malformed_event", "malformed webhook event")
+
+// Event is the envelope of every webhook. ID is unique per event and stays
+// the same when the gateway redelivers it.
+type Event struct {
+	ID        string          `json:"id"`
+	Type      EventType       `json:"type"`
+	CreatedAt int64           `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// PaymentData is the Data of payment.* events.
+type PaymentData struct {
+	PaymentID     string `json:"payment_id"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// RefundData is the Data of refund.* events.
+type RefundData struct {
+	RefundID      string `json:"refund_id"`
+	PaymentID     string `json:"payment_id"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// Parse decodes the envelope of a webhook body.
+func Parse(payload []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+	if event.ID == "" || event.Type == "" {
+		return nil, fmt.Errorf("%w: id and type are required", ErrMalformedEvent)
+	}
+	return &event, nil
+}
+
+// PaymentData decodes the data of a payment.* event.
+func (e *Event) PaymentData() (*PaymentData, error) {
+	var data PaymentData
+	if err := json.Unmarshal(e.Data, &data); err != nil || data.PaymentID == "" {
+		return nil, fmt.Errorf("%w: %s needs data.payment_id", ErrMalformedEvent, e.Type)
+	}
+	return &data, nil
+}
+
+// RefundData decodes the data of a refund.* event.
+func (e *Event) RefundData() (*RefundData, error) {
+	var data RefundData
+	if err := json.Unmarshal(e.Data, &data); err != nil || data.RefundID == "" {
+		return nil, fmt.Errorf("%w: %s needs data.refund_id", ErrMalformedEvent, e.Type)
+	}
+	return &data, nil
+}
@@ -0,0 +1,76 @@
+// Package webhook verifies and decodes the events a payment gateway sends to
+// POST /payments/webhook.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"zamato/pkg/problem"
+)
+
+// SignatureHeader carries the signature of a webhook request in the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Several v1 entries
+// may be present while the gateway rotates secrets.
+const SignatureHeader = "Webhook-Signature"
+
+var (
+	ErrMissingSignature = problem.New(problem.Unauthorized, "missing_signature", "missing webhook signature")
+	ErrInvalidSignature = problem.New(problem.Unauthorized, "invalid_signature", "invalid webhook signature")
+	ErrStaleSignature   = problem.New(problem.Unauthorized, "stale_signature", "webhook timestamp outside tolerance")
+)
+
+// Sign returns the SignatureHeader value for payload sent at timestamp.
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, payload))
+}
+
+// Verify checks that header is a valid signature of payload made with secret
+// no more than tolerance away from now.
+func Verify(secret, header string, payload []byte, tolerance time.Duration, now time.Time) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	ts, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrStaleSignature
+	}
+
+	expected := mac(secret, t, payload)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret, timestamp string, payload []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(payload)
+	return h.Sum(nil)
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	payload := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1760000000, 0)
+	header := Sign("secret", now, payload)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		payload []byte
+		now     time.Time
+		wantErr error
+	}{
+		{name: "valid", secret: "secret", header: header, payload: payload, now: now},
+		{name: "within tolerance", secret: "secret", header: header, payload: payload, now: now.Add(4 * time.Minute)},
+		{name: "rotated secret", secret: "secret", header: Sign("old", now, payload) + "," + strings.SplitN(header, ",", 2)[1], payload: payload, now: now},
+		{name: "missing", secret: "secret", payload: payload, now: now, wantErr: ErrMissingSignature},
+		{name: "wrong secret", secret: "other", header: header, payload: payload, now: now, wantErr: ErrInvalidSignature},
+		{name: "tampered body", secret: "secret", header: header, payload: []byte(`{"id":"evt_2"}`), now: now, wantErr: ErrInvalidSignature},
+		{name: "garbage", secret: "secret", header: "v1=zz", payload: payload, now: now, wantErr: ErrInvalidSignature},
+		{name: "too old", secret: "secret", header: header, payload: payload, now: now.Add(6 * time.Minute), wantErr: ErrStaleSignature},
+		{name: "from the future", secret: "secret", header: header, payload: payload, now: now.Add(-6 * time.Minute), wantErr: ErrStaleSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.payload, 5*time.Minute, tt.now)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFixtures(t *testing.T) {
+	fixtures, err := filepath.Glob("testdata/*.json")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, fixtures)
+
+	for _, path := range fixtures {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			payload, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			event, err := Parse(payload)
+			assert.NoError(t, err)
+
+			switch event.Type {
+			case PaymentSucceeded, PaymentFailed:
+				data, err := event.PaymentData()
+				assert.NoError(t, err)
+				assert.NotEmpty(t, data.PaymentID)
+			case RefundSucceeded, RefundFailed:
+				data, err := event.RefundData()
+				assert.NoError(t, err)
+				assert.NotEmpty(t, data.RefundID)
+			default:
+				t.Fatalf("unexpected event type %q", event.Type)
+			}
+		})
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, payload := range []string{`not json`, `{}`, `{"id":"evt_1"}`} {
+		_, err := Parse([]byte(payload))
+		assert.ErrorIs(t, err, ErrMalformedEvent)
+	}
+
+	event, err := Parse([]byte(`{"id":"evt_1","type":"refund.failed","data":{}}`))
+	assert.NoError(t, err)
+	_, err = event.RefundData()
+	assert.ErrorIs(t, err, ErrMalformedEvent)
+}
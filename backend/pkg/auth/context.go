@@ -0,0 +1,62 @@
+// Package auth verifies the bearer tokens callers present and decides, by
+// role, what they may do.
+package auth
+
+import "context"
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+// Role is the kind of user a token was issued to.
+type Role string
+
+const (
+	RoleCustomer   Role = "customer"
+	RoleRestaurant Role = "restaurant"
+	RoleCourier    Role = "courier"
+	RoleSupport    Role = "support"
+	RoleAdmin      Role = "admin"
+	// RoleService is held by other backend services rather than people.
+	RoleService Role = "service"
+)
+
+// IsValid reports whether r is one of the known roles.
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleCustomer, RoleRestaurant, RoleCourier, RoleSupport, RoleAdmin, RoleService:
+		return true
+	}
+	return false
+}
+
+// Principal is the authenticated user a request is made by. Requests made
+// by another backend service carry RoleService and the service's name
+// instead of a user ID.
+type Principal struct {
+	UserID  uint
+	Role    Role
+	Service string
+}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated user.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext returns the user stored by the auth middleware.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey).(Principal)
+	return p, ok
+}
+
+// WithUserID returns a copy of ctx carrying a customer with the given ID.
+func WithUserID(ctx context.Context, userID uint) context.Context {
+	return WithPrincipal(ctx, Principal{UserID: userID, Role: RoleCustomer})
+}
+
+// UserIDFromContext returns the user ID stored by the auth middleware.
+func UserIDFromContext(ctx context.Context) (uint, bool) {
+	p, ok := PrincipalFromContext(ctx)
+	return p.UserID, ok
+}
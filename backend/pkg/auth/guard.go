@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"net/http"
+	"sync"
+
+	"zamato/pkg/problem"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteGuard enforces the permission declared for each route of a router.
+// Declare a route's permission with Require and install the guard's
+// Middleware on the router after the package's Middleware. Routes without a
+// declaration are refused, so a new endpoint cannot be left open by mistake.
+type RouteGuard struct {
+	policy Policy
+
+	mu    sync.RWMutex
+	perms map[*mux.Route]Permission
+}
+
+func NewRouteGuard(policy Policy) *RouteGuard {
+	return &RouteGuard{policy: policy, perms: make(map[*mux.Route]Permission)}
+}
+
+// Require declares that route may only be used by principals holding perm,
+// and returns route.
+func (g *RouteGuard) Require(route *mux.Route, perm Permission) *mux.Route {
+	g.mu.Lock()
+	g.perms[route] = perm
+	g.mu.Unlock()
+	return route
+}
+
+// Middleware answers 401 for requests without an authenticated principal
+// and 403 for principals whose role lacks the permission of the route.
+func (g *RouteGuard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			problem.Write(w, r, problem.ErrUnauthorized)
+			return
+		}
+		g.mu.RLock()
+		perm, declared := g.perms[mux.CurrentRoute(r)]
+		g.mu.RUnlock()
+		if !declared || !g.policy.Allows(principal.Role, perm) {
+			problem.Write(w, r, problem.ErrForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteGuard(t *testing.T) {
+	const read, write Permission = "things:read", "things:write"
+	guard := NewRouteGuard(Policy{
+		RoleCustomer: {read},
+		RoleAdmin:    {read, write},
+	})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	r := mux.NewRouter()
+	r.Use(guard.Middleware)
+	guard.Require(r.HandleFunc("/things", ok).Methods("GET"), read)
+	guard.Require(r.HandleFunc("/things", ok).Methods("POST"), write)
+	r.HandleFunc("/undeclared", ok).Methods("GET")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		principal  *Principal
+		wantStatus int
+	}{
+		{name: "granted", method: "GET", path: "/things", principal: &Principal{UserID: 1, Role: RoleCustomer}, wantStatus: http.StatusOK},
+		{name: "not granted", method: "POST", path: "/things", principal: &Principal{UserID: 1, Role: RoleCustomer}, wantStatus: http.StatusForbidden},
+		{name: "granted to another role", method: "POST", path: "/things", principal: &Principal{UserID: 2, Role: RoleAdmin}, wantStatus: http.StatusOK},
+		{name: "role without permissions", method: "GET", path: "/things", principal: &Principal{UserID: 3, Role: RoleCourier}, wantStatus: http.StatusForbidden},
+		{name: "route without a permission", method: "GET", path: "/undeclared", principal: &Principal{UserID: 2, Role: RoleAdmin}, wantStatus: http.StatusForbidden},
+		{name: "unauthenticated", method: "GET", path: "/things", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.principal != nil {
+				req = req.WithContext(WithPrincipal(req.Context(), *tt.principal))
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
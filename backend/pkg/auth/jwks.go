@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	jwksRefreshInterval = 10 * time.Minute
+	// jwksMinFetchInterval bounds how often tokens with unknown key ids can
+	// make the cache fetch the JWKS again.
+	jwksMinFetchInterval = time.Minute
+)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// jwksCache fetches RSA keys from a JWKS endpoint and refreshes them lazily
+// when an unknown key id shows up or the cached set gets stale. It fetches at
+// most once per minFetchInterval, whether or not the fetch succeeds, so that
+// tokens with made-up key ids cannot make it fetch on every request.
+type jwksCache struct {
+	url              string
+	client           *http.Client
+	minFetchInterval time.Duration
+	mu               sync.Mutex
+	keys             map[string]*rsa.PublicKey
+	fetchedAt        time.Time
+	attemptedAt      time.Time
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{
+		url:              url,
+		client:           &http.Client{Timeout: 5 * time.Second},
+		minFetchInterval: jwksMinFetchInterval,
+		keys:             map[string]*rsa.PublicKey{},
+	}
+}
+
+func (c *jwksCache) key(kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	if ok && time.Since(c.fetchedAt) < jwksRefreshInterval {
+		return key, nil
+	}
+	// Between fetches a stale key is still better than none, and an unknown
+	// key id stays unknown.
+	if time.Since(c.attemptedAt) < c.minFetchInterval {
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return key, nil
+	}
+	c.attemptedAt = time.Now()
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	key, ok = c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+func (c *jwksCache) refresh() error {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		pub, err := k.rsaPublicKey()
+		if err != nil {
+			return err
+		}
+		keys[k.Kid] = pub
+	}
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("decode modulus of key %q: %w", k.Kid, err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("decode exponent of key %q: %w", k.Kid, err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWKSCache_LimitsFetches(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jwk{{
+				Kid: "k1",
+				Kty: "RSA",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	c := newJWKSCache(srv.URL)
+
+	_, err = c.key("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fetches)
+
+	// Unknown key ids are answered from the cache until the interval passes.
+	for i := 0; i < 5; i++ {
+		_, err = c.key("forged")
+		assert.ErrorContains(t, err, "unknown key id")
+	}
+	assert.Equal(t, 1, fetches)
+
+	_, err = c.key("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fetches)
+
+	c.attemptedAt = time.Now().Add(-c.minFetchInterval)
+	_, err = c.key("forged")
+	assert.ErrorContains(t, err, "unknown key id")
+	assert.Equal(t, 2, fetches)
+}
+
+func TestJWKSCache_LimitsFailedFetches(t *testing.T) {
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := newJWKSCache(srv.URL)
+
+	_, err := c.key("k1")
+	assert.ErrorContains(t, err, "unexpected status 503")
+	_, err = c.key("k1")
+	assert.ErrorContains(t, err, "unknown key id")
+	assert.Equal(t, 1, fetches)
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"zamato/pkg/problem"
+)
+
+var (
+	errInvalidToken = problem.New(problem.Unauthorized, "invalid_token", "invalid token")
+	errExpiredToken = problem.New(problem.Unauthorized, "token_expired", "token expired")
+)
+
+// Middleware verifies the bearer JWT on every request and stores the
+// authenticated user and their role in the request context.
+func Middleware(verifier *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				problem.Write(w, r, problem.ErrUnauthorized)
+				return
+			}
+
+			claims, err := verifier.Verify(strings.TrimPrefix(authHeader, "Bearer "))
+			if err != nil {
+				if errors.Is(err, ErrExpiredToken) {
+					problem.Write(w, r, errExpiredToken)
+					return
+				}
+				problem.Write(w, r, errInvalidToken)
+				return
+			}
+
+			ctx := WithPrincipal(r.Context(), claims.Principal())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	const secret = "test-secret"
+	verifier, err := NewVerifier(Config{HMACSecret: secret})
+	assert.NoError(t, err)
+
+	valid, _ := SignHS256(secret, 5, time.Hour)
+	expired, _ := SignHS256(secret, 5, -time.Hour)
+	staff, _ := SignHS256WithRole(secret, 8, RoleRestaurant, time.Hour)
+
+	tests := []struct {
+		name           string
+		header         string
+		wantStatus     int
+		wantErrContain string
+		wantPrincipal  string
+	}{
+		{name: "valid token", header: "Bearer " + valid, wantStatus: http.StatusOK, wantPrincipal: "5 customer"},
+		{name: "staff token", header: "Bearer " + staff, wantStatus: http.StatusOK, wantPrincipal: "8 restaurant"},
+		{name: "missing header", header: "", wantStatus: http.StatusUnauthorized, wantErrContain: "Unauthorized"},
+		{name: "not bearer", header: valid, wantStatus: http.StatusUnauthorized, wantErrContain: "Unauthorized"},
+		{name: "expired", header: "Bearer " + expired, wantStatus: http.StatusUnauthorized, wantErrContain: "token expired"},
+		{name: "malformed", header: "Bearer abc.def", wantStatus: http.StatusUnauthorized, wantErrContain: "invalid token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				p, ok := PrincipalFromContext(r.Context())
+				assert.True(t, ok)
+				fmt.Fprintf(w, "%d %s", p.UserID, p.Role)
+			})
+			req := httptest.NewRequest("GET", "/orders", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			Middleware(verifier)(next).ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			if tt.wantErrContain != "" {
+				assert.Contains(t, rr.Body.String(), tt.wantErrContain)
+			} else {
+				assert.Equal(t, tt.wantPrincipal, rr.Body.String())
+			}
+		})
+	}
+}
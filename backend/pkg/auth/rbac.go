@@ -0,0 +1,18 @@
+package auth
+
+// Permission names something a caller may do, such as "orders:read".
+type Permission string
+
+// Policy grants permissions to roles. Each service declares its own policy
+// for the permissions its routes require.
+type Policy map[Role][]Permission
+
+// Allows reports whether role holds perm.
+func (p Policy) Allows(role Role, perm Permission) bool {
+	for _, granted := range p[role] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
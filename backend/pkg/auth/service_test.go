@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const testServiceSecret = "service-secret"
+
+func TestServiceTokens(t *testing.T) {
+	issuer, err := NewServiceTokens(Config{ServiceName: "order-service", ServiceSecret: testServiceSecret})
+	assert.NoError(t, err)
+	verifier, err := NewVerifier(Config{
+		HMACSecret:      testSecret,
+		ServiceName:     "payment-service",
+		ServiceSecret:   testServiceSecret,
+		TrustedServices: []string{"order-service"},
+	})
+	assert.NoError(t, err)
+
+	t.Run("accepted from a trusted service", func(t *testing.T) {
+		token, err := issuer.Token("payment-service")
+		assert.NoError(t, err)
+		claims, err := verifier.Verify(token)
+		assert.NoError(t, err)
+		assert.Equal(t, Principal{Role: RoleService, Service: "order-service"}, claims.Principal())
+	})
+
+	t.Run("addressed to another service", func(t *testing.T) {
+		token, _ := issuer.Token("menu-service")
+		_, err := verifier.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("untrusted service", func(t *testing.T) {
+		other, _ := NewServiceTokens(Config{ServiceName: "menu-service", ServiceSecret: testServiceSecret})
+		token, _ := other.Token("payment-service")
+		_, err := verifier.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("service role in a user token", func(t *testing.T) {
+		token, _ := SignHS256WithRole(testSecret, 42, RoleService, time.Hour)
+		_, err := verifier.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("user token signed with the service secret", func(t *testing.T) {
+		token, _ := SignHS256(testServiceSecret, 42, time.Hour)
+		_, err := verifier.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			Role: RoleService,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "order-service",
+				Audience:  jwt.ClaimStrings{"payment-service"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			},
+		}).SignedString([]byte(testServiceSecret))
+		_, err := verifier.Verify(token)
+		assert.ErrorIs(t, err, ErrExpiredToken)
+	})
+}
+
+func TestServiceTokens_Reuse(t *testing.T) {
+	issuer, err := NewServiceTokens(Config{ServiceName: "order-service", ServiceSecret: testServiceSecret, ServiceTokenTTL: time.Minute})
+	assert.NoError(t, err)
+	now := time.Now()
+	issuer.now = func() time.Time { return now }
+
+	first, _ := issuer.Token("payment-service")
+	now = now.Add(29 * time.Second)
+	second, _ := issuer.Token("payment-service")
+	assert.Equal(t, first, second, "reused within half the lifetime")
+
+	now = now.Add(2 * time.Second)
+	third, _ := issuer.Token("payment-service")
+	assert.NotEqual(t, first, third, "renewed after half the lifetime")
+}
+
+func TestNewServiceTokens_NoCredentials(t *testing.T) {
+	_, err := NewServiceTokens(Config{ServiceName: "order-service"})
+	assert.ErrorIs(t, err, ErrNoServiceCredentials)
+}
+
+func TestVerifier_ServiceSecretOnly(t *testing.T) {
+	v, err := NewVerifier(Config{ServiceName: "payment-service", ServiceSecret: testServiceSecret})
+	assert.NoError(t, err)
+
+	// Without a user secret, HS256 user tokens must not verify with an
+	// empty key.
+	token, _ := SignHS256("", 42, time.Hour)
+	_, err = v.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+	ErrNoKeys       = errors.New("no JWT verification keys configured")
+)
+
+// Claims mirrors the payload customer-service signs on login ({ id } with a
+// 1h expiry) plus the registered JWT claims. Staff tokens also carry a role;
+// tokens without one belong to customers.
+type Claims struct {
+	UserID uint `json:"id"`
+	Role   Role `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Principal returns the user or service the claims were issued to.
+func (c *Claims) Principal() Principal {
+	p := Principal{UserID: c.UserID, Role: c.Role}
+	if c.Role == RoleService {
+		p.Service = c.Subject
+	}
+	return p
+}
+
+// Config selects how tokens are verified. HMACSecret enables HS256, while
+// RSAPublicKeyFile and JWKSURL enable RS256. Any combination may be set.
+// Issuer, if set, is the expected issuer of user tokens.
+//
+// The Service fields configure service tokens, which backend services use to
+// call each other: HS256 tokens signed with ServiceSecret, issued by and to
+// the services' names. A service accepts them only from TrustedServices, and
+// only if they are addressed to its ServiceName.
+type Config struct {
+	HMACSecret       string
+	RSAPublicKeyFile string
+	JWKSURL          string
+	Issuer           string
+	Leeway           time.Duration
+
+	ServiceName     string
+	ServiceSecret   string
+	TrustedServices []string
+	ServiceTokenTTL time.Duration
+}
+
+// Verifier validates bearer tokens issued by customer-service, and service
+// tokens issued by trusted services.
+type Verifier struct {
+	hmacSecret    []byte
+	rsaKey        *rsa.PublicKey
+	jwks          *jwksCache
+	issuer        string
+	serviceName   string
+	serviceSecret []byte
+	trusted       map[string]bool
+	parser        *jwt.Parser
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{issuer: cfg.Issuer, serviceName: cfg.ServiceName, trusted: make(map[string]bool)}
+	var methods []string
+	if cfg.HMACSecret != "" {
+		v.hmacSecret = []byte(cfg.HMACSecret)
+	}
+	if cfg.ServiceSecret != "" {
+		v.serviceSecret = []byte(cfg.ServiceSecret)
+		for _, name := range cfg.TrustedServices {
+			v.trusted[name] = true
+		}
+	}
+	if v.hmacSecret != nil || v.serviceSecret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.RSAPublicKeyFile != "" {
+		pem, err := os.ReadFile(cfg.RSAPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read RSA public key: %w", err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("parse RSA public key: %w", err)
+		}
+		v.rsaKey = key
+	}
+	if cfg.JWKSURL != "" {
+		v.jwks = newJWKSCache(cfg.JWKSURL)
+	}
+	if v.rsaKey != nil || v.jwks != nil {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	v.parser = jwt.NewParser(
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	)
+	return v, nil
+}
+
+// Verify parses and validates a raw token string and returns its claims.
+func (v *Verifier) Verify(raw string) (*Claims, error) {
+	if raw == "" {
+		return nil, ErrMissingToken
+	}
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(raw, claims, v.keyFunc)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Role == RoleService {
+		if err := v.checkService(claims); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if claims.UserID == 0 {
+		return nil, fmt.Errorf("%w: missing user id claim", ErrInvalidToken)
+	}
+	if claims.Role == "" {
+		claims.Role = RoleCustomer
+	}
+	if !claims.Role.IsValid() {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidToken, claims.Role)
+	}
+	return claims, nil
+}
+
+// checkService accepts a service token only from a trusted service and only
+// if it is addressed to this one.
+func (v *Verifier) checkService(claims *Claims) error {
+	if !v.trusted[claims.Subject] {
+		return fmt.Errorf("%w: untrusted service %q", ErrInvalidToken, claims.Subject)
+	}
+	for _, audience := range claims.Audience {
+		if audience == v.serviceName {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: service token is not addressed to %s", ErrInvalidToken, v.serviceName)
+}
+
+// keyFunc picks the key a token must be signed with. Service tokens are only
+// valid when signed with the service secret, so a user token cannot claim
+// the service role.
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	claims, _ := token.Claims.(*Claims)
+	service := claims != nil && claims.Role == RoleService
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		secret := v.hmacSecret
+		if service {
+			secret = v.serviceSecret
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("no HS256 key for this kind of token")
+		}
+		return secret, nil
+	case jwt.SigningMethodRS256.Alg():
+		if service {
+			return nil, errors.New("service tokens must be HS256")
+		}
+		if kid, _ := token.Header["kid"].(string); kid != "" && v.jwks != nil {
+			return v.jwks.key(kid)
+		}
+		if v.rsaKey != nil {
+			return v.rsaKey, nil
+		}
+		return nil, errors.New("RS256 token without a known key id")
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+// SignHS256 mints a token in the same shape customer-service issues. It is
+// used by tests and local tooling that need a valid bearer token.
+func SignHS256(secret string, userID uint, ttl time.Duration) (string, error) {
+	return SignHS256WithRole(secret, userID, "", ttl)
+}
+
+// SignHS256WithRole is SignHS256 for a token that carries a role.
+func SignHS256WithRole(secret string, userID uint, role Role, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID: userID,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "test-secret"
+
+func TestVerifier_HS256(t *testing.T) {
+	v, err := NewVerifier(Config{HMACSecret: testSecret})
+	assert.NoError(t, err)
+
+	valid, _ := SignHS256(testSecret, 42, time.Hour)
+	expired, _ := SignHS256(testSecret, 42, -time.Hour)
+	wrongSecret, _ := SignHS256("other-secret", 42, time.Hour)
+	noUser, _ := SignHS256(testSecret, 0, time.Hour)
+	courier, _ := SignHS256WithRole(testSecret, 42, RoleCourier, time.Hour)
+	unknownRole, _ := SignHS256WithRole(testSecret, 42, "owner", time.Hour)
+	noExpiry, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": 42}).SignedString([]byte(testSecret))
+
+	tests := []struct {
+		name     string
+		token    string
+		wantErr  error
+		wantID   uint
+		wantRole Role
+	}{
+		{name: "valid", token: valid, wantID: 42, wantRole: RoleCustomer},
+		{name: "with role", token: courier, wantID: 42, wantRole: RoleCourier},
+		{name: "unknown role", token: unknownRole, wantErr: ErrInvalidToken},
+		{name: "expired", token: expired, wantErr: ErrExpiredToken},
+		{name: "wrong secret", token: wrongSecret, wantErr: ErrInvalidToken},
+		{name: "malformed", token: "not-a-jwt", wantErr: ErrInvalidToken},
+		{name: "missing user id", token: noUser, wantErr: ErrInvalidToken},
+		{name: "missing expiry", token: noExpiry, wantErr: ErrInvalidToken},
+		{name: "empty", token: "", wantErr: ErrMissingToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(tt.token)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, claims)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, Principal{UserID: tt.wantID, Role: tt.wantRole}, claims.Principal())
+		})
+	}
+}
+
+func TestVerifier_RS256ViaJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jwk{{
+				Kid: "k1",
+				Kty: "RSA",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	v, err := NewVerifier(Config{JWKSURL: srv.URL})
+	assert.NoError(t, err)
+
+	sign := func(kid string) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, Claims{
+			UserID:           7,
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		})
+		tok.Header["kid"] = kid
+		s, err := tok.SignedString(key)
+		assert.NoError(t, err)
+		return s
+	}
+
+	claims, err := v.Verify(sign("k1"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID)
+
+	_, err = v.Verify(sign("unknown"))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// HS256 tokens must be rejected when only RSA keys are configured.
+	hs, _ := SignHS256(testSecret, 7, time.Hour)
+	_, err = v.Verify(hs)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestNewVerifier_NoKeys(t *testing.T) {
+	_, err := NewVerifier(Config{})
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
@@ -0,0 +1,171 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"zamato/pkg/problem"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errKeyTooLong   = problem.New(problem.Invalid, "idempotency_key_too_long", "Idempotency-Key is too long")
+	errKeyReused    = problem.New(problem.Unprocessable, "idempotency_key_reused", "Idempotency-Key was already used with a different request")
+	errInProgress   = problem.New(problem.Conflict, "idempotency_in_progress", "a request with this Idempotency-Key is still being processed")
+	errBodyTooLarge = problem.New(problem.TooLarge, "request_too_large", "request body is too large to be made idempotent")
+)
+
+const (
+	KeyHeader       = "Idempotency-Key"
+	replayedHeader  = "Idempotent-Replayed"
+	maxKeyLength    = 255
+	maxRequestBytes = 1 << 20
+)
+
+// Config controls Middleware.
+type Config struct {
+	// TTL is how long responses are kept for replay.
+	TTL time.Duration
+	// LockTimeout is how long a request may hold its key before a retry may
+	// take it over, such as when the instance handling it died. It should
+	// exceed the longest time a request can run.
+	LockTimeout time.Duration
+	// Scope namespaces keys, typically by route and caller, so that one
+	// caller can never replay another caller's response.
+	Scope func(r *http.Request) string
+}
+
+type contextKey int
+
+const keepKey contextKey = iota
+
+// Keep makes Middleware store the response to r even if it is a server
+// error. Handlers call it when the request had effects that a retry must not
+// repeat.
+func Keep(r *http.Request) {
+	if keep, ok := r.Context().Value(keepKey).(*bool); ok {
+		*keep = true
+	}
+}
+
+// Middleware makes a handler safe to retry. Requests carrying an
+// Idempotency-Key header are executed at most once per key and scope within
+// cfg.TTL: identical retries get the stored response replayed, a reused key
+// with a different body is rejected with 422, a retry that arrives while the
+// first request is still running gets 409 until cfg.LockTimeout passes, and
+// a body over 1 MiB gets 413. Requests without the header are passed through
+// unchanged.
+func Middleware(repo Repository, cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(KeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLength {
+				problem.Write(w, r, errKeyTooLong)
+				return
+			}
+
+			// Read one byte past the limit to tell a body that fits from one
+			// that would be cut off.
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+			if err != nil {
+				problem.Write(w, r, fmt.Errorf("%w: failed to read request body", problem.ErrInvalidRequest))
+				return
+			}
+			if len(body) > maxRequestBytes {
+				problem.Write(w, r, errBodyTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := sha256.Sum256(body)
+			record := &Record{
+				Scope:       cfg.Scope(r),
+				Key:         key,
+				RequestHash: hex.EncodeToString(hash[:]),
+				LockID:      uuid.NewString(),
+				ExpiresAt:   time.Now().Add(cfg.LockTimeout),
+			}
+
+			existing, err := repo.Reserve(record)
+			if err != nil {
+				problem.Write(w, r, fmt.Errorf("reserve idempotency key: %w", err))
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.RequestHash != record.RequestHash:
+					problem.Write(w, r, errKeyReused)
+				case !existing.Completed:
+					problem.Write(w, r, errInProgress)
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			keep := false
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), keepKey, &keep)))
+
+			// Server errors are not stored so the client can retry them,
+			// unless the handler asked to keep the key.
+			if rec.status >= http.StatusInternalServerError && !keep {
+				if err := repo.Release(record); err != nil {
+					log.Printf("failed to release idempotency key %q: %v", key, err)
+				}
+				return
+			}
+			record.StatusCode = rec.status
+			record.ContentType = rec.Header().Get("Content-Type")
+			record.ResponseBody = rec.body.Bytes()
+			record.ExpiresAt = time.Now().Add(cfg.TTL)
+			if err := repo.Complete(record); err != nil {
+				log.Printf("failed to store response for idempotency key %q: %v", key, err)
+			}
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, record *Record) {
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set(replayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.ResponseBody)
+}
+
+// responseRecorder passes the response through while keeping a copy of the
+// status code and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,166 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupRepository(t *testing.T) Repository {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&Record{}))
+	return NewRepository(db)
+}
+
+// callerScope scopes keys by route and the X-Caller header.
+func callerScope(r *http.Request) string {
+	return r.Method + " " + r.URL.Path + " " + r.Header.Get("X-Caller")
+}
+
+func setupMiddleware(t *testing.T, ttl time.Duration) (http.Handler, *int) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if strings.Contains(r.URL.RawQuery, "fail") {
+			if strings.Contains(r.URL.RawQuery, "keep") {
+				Keep(r)
+			}
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"` + strconv.Itoa(calls) + `"}`))
+	})
+	cfg := Config{TTL: ttl, LockTimeout: time.Minute, Scope: callerScope}
+	return Middleware(setupRepository(t), cfg)(next), &calls
+}
+
+func send(h http.Handler, target, key, body, caller string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", target, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(KeyHeader, key)
+	}
+	req.Header.Set("X-Caller", caller)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("replays identical retry", func(t *testing.T) {
+		h, calls := setupMiddleware(t, time.Hour)
+		first := send(h, "/orders", "k1", `{"a":1}`, "u1")
+		second := send(h, "/orders", "k1", `{"a":1}`, "u1")
+		assert.Equal(t, 1, *calls)
+		assert.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+		assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("rejects key reuse with different body", func(t *testing.T) {
+		h, calls := setupMiddleware(t, time.Hour)
+		send(h, "/orders", "k1", `{"a":1}`, "u1")
+		rr := send(h, "/orders", "k1", `{"a":2}`, "u1")
+		assert.Equal(t, 1, *calls)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("keys are namespaced by scope", func(t *testing.T) {
+		h, calls := setupMiddleware(t, time.Hour)
+		send(h, "/orders", "k1", `{"a":1}`, "u1")
+		rr := send(h, "/orders", "k1", `{"a":1}`, "u2")
+		assert.Equal(t, 2, *calls)
+		assert.Equal(t, `{"id":"2"}`, rr.Body.String())
+	})
+
+	t.Run("rejects bodies over the limit", func(t *testing.T) {
+		h, calls := setupMiddleware(t, time.Hour)
+		rr := send(h, "/orders", "k1", strings.Repeat("x", maxRequestBytes+1), "u1")
+		assert.Equal(t, 0, *calls)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+		rr = send(h, "/orders", "k2", strings.Repeat("x", maxRequestBytes), "u1")
+		assert.Equal(t, 1, *calls)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("requests without key are not deduplicated", func(t *testing.T) {
+		h, calls := setupMiddleware(t, time.Hour)
+		send(h, "/orders", "", `{"a":1}`, "u1")
+		send(h, "/orders", "", `{"a":1}`, "u1")
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		h, calls := setupMiddleware(t, time.Hour)
+		rr := send(h, "/orders?fail", "k1", `{"a":1}`, "u1")
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		rr = send(h, "/orders?fail", "k1", `{"a":1}`, "u1")
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("server errors the handler keeps are stored", func(t *testing.T) {
+		h, calls := setupMiddleware(t, time.Hour)
+		send(h, "/orders?fail&keep", "k1", `{"a":1}`, "u1")
+		rr := send(h, "/orders?fail&keep", "k1", `{"a":1}`, "u1")
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("expired keys can be reused", func(t *testing.T) {
+		h, calls := setupMiddleware(t, -time.Second)
+		send(h, "/orders", "k1", `{"a":1}`, "u1")
+		rr := send(h, "/orders", "k1", `{"a":2}`, "u1")
+		assert.Equal(t, 2, *calls)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestMiddleware_InProgress(t *testing.T) {
+	tests := []struct {
+		name        string
+		lockTimeout time.Duration
+		wantRetry   int
+		wantStored  int
+	}{
+		{name: "retry while locked", lockTimeout: time.Minute, wantRetry: http.StatusConflict, wantStored: http.StatusCreated},
+		{name: "retry after the lock timed out", lockTimeout: -time.Second, wantRetry: http.StatusAccepted, wantStored: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := setupRepository(t)
+			var h http.Handler
+			calls := 0
+			h = Middleware(repo, Config{TTL: time.Hour, LockTimeout: tt.lockTimeout, Scope: callerScope})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls > 1 {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				// A retry arriving while the first request is still running.
+				rr := send(h, "/orders", "k1", `{"a":1}`, "u1")
+				assert.Equal(t, tt.wantRetry, rr.Code)
+				w.WriteHeader(http.StatusCreated)
+			}))
+			rr := send(h, "/orders", "k1", `{"a":1}`, "u1")
+			assert.Equal(t, http.StatusCreated, rr.Code)
+
+			// The stored response is that of the request that held the key
+			// when it finished.
+			rr = send(h, "/orders", "k1", `{"a":1}`, "u1")
+			assert.Equal(t, tt.wantStored, rr.Code)
+			assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+		})
+	}
+}
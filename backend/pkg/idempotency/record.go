@@ -0,0 +1,30 @@
+// Package idempotency makes HTTP handlers safe to retry with an
+// Idempotency-Key header: the first request with a key runs, and retries of
+// it are answered with its stored response.
+package idempotency
+
+import "time"
+
+// Record stores the outcome of a request sent with an Idempotency-Key header
+// so that retries of the same request can be answered without executing it
+// again. Scope namespaces keys per route and caller. LockID identifies the
+// request holding an uncompleted record; once ExpiresAt passes, a retry may
+// take the key over.
+type Record struct {
+	Scope        string `gorm:"primaryKey;type:varchar(200)"`
+	Key          string `gorm:"column:idempotency_key;primaryKey;type:varchar(255)"`
+	RequestHash  string `gorm:"type:varchar(64)"`
+	LockID       string `gorm:"type:varchar(36)"`
+	Completed    bool   `gorm:"not null;default:false"`
+	StatusCode   int
+	ContentType  string `gorm:"type:varchar(100)"`
+	ResponseBody []byte
+	CreatedAt    time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+// TableName keeps the table the services created before the record moved
+// here.
+func (Record) TableName() string {
+	return "idempotency_keys"
+}
@@ -0,0 +1,86 @@
+package idempotency
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLockLost is returned by Complete and Release when the record no longer
+// belongs to the request, because its lock expired and a retry took the key
+// over.
+var ErrLockLost = errors.New("idempotency key was taken over by another request")
+
+// Repository persists Idempotency-Key records.
+type Repository interface {
+	// Reserve stores record if no live record exists for its scope and key.
+	// Otherwise it leaves the table untouched and returns the existing record.
+	Reserve(record *Record) (*Record, error)
+	// Complete stores the response and expiry of a reserved record.
+	Complete(record *Record) error
+	// Release deletes a reserved record, so that the key can be used again.
+	Release(record *Record) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) Reserve(record *Record) (*Record, error) {
+	// An expired key may be reused, so drop it before trying to insert.
+	if err := r.db.Where("scope = ? AND idempotency_key = ? AND expires_at <= ?", record.Scope, record.Key, time.Now()).
+		Delete(&Record{}).Error; err != nil {
+		return nil, err
+	}
+
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	var existing Record
+	if err := r.db.First(&existing, "scope = ? AND idempotency_key = ?", record.Scope, record.Key).Error; err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (r *repository) Complete(record *Record) error {
+	result := r.db.Model(&Record{}).
+		Where("scope = ? AND idempotency_key = ? AND lock_id = ?", record.Scope, record.Key, record.LockID).
+		Updates(map[string]interface{}{
+			"completed":     true,
+			"status_code":   record.StatusCode,
+			"content_type":  record.ContentType,
+			"response_body": record.ResponseBody,
+			"expires_at":    record.ExpiresAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (r *repository) Release(record *Record) error {
+	result := r.db.Where("scope = ? AND idempotency_key = ? AND lock_id = ?", record.Scope, record.Key, record.LockID).
+		Delete(&Record{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
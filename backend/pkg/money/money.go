@@ -0,0 +1,222 @@
+// Package money represents monetary amounts exactly, as an integer number of
+// minor units (cents, paise, ...) of an ISO 4217 currency.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidCurrency  = errors.New("invalid currency code")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrOverflow         = errors.New("amount out of range")
+)
+
+// exponents lists currencies whose minor unit is not 1/100 of the major unit.
+var exponents = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLP": 0, "ISK": 0, "JPY": 0, "KRW": 0, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+}
+
+// Exponent returns the number of decimal places of currency's minor unit.
+func Exponent(currency string) int {
+	if e, ok := exponents[currency]; ok {
+		return e
+	}
+	return 2
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 code.
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Money is an amount of Minor units of Currency. Stored with GORM it maps to
+// two columns, <prefix>minor and <prefix>currency, when embedded with
+// `gorm:"embedded;embeddedPrefix:<prefix>"`.
+type Money struct {
+	Minor    int64  `gorm:"column:minor;not null;default:0"`
+	Currency string `gorm:"column:currency;type:varchar(3);not null;default:''"`
+}
+
+// New returns minor units of currency.
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// Zero returns a zero amount of currency.
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// Parse reads a decimal amount such as "12.50" or "-3" in currency. Amounts
+// with more decimal places than the currency allows are rejected rather than
+// rounded.
+func Parse(amount, currency string) (Money, error) {
+	if !ValidCurrency(currency) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidCurrency, currency)
+	}
+
+	s := strings.TrimSpace(amount)
+	neg := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	exp := Exponent(currency)
+	if whole == "" || (hasPoint && frac == "") || !digits(whole) || !digits(frac) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+	if len(frac) > exp {
+		if strings.TrimRight(frac[exp:], "0") != "" {
+			return Money{}, fmt.Errorf("%w: %q has more than %d decimal places for %s", ErrInvalidAmount, amount, exp, currency)
+		}
+		frac = frac[:exp]
+	}
+
+	n, ok := new(big.Int).SetString(whole+frac+strings.Repeat("0", exp-len(frac)), 10)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+	if neg {
+		n.Neg(n)
+	}
+	if !n.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{Minor: n.Int64(), Currency: currency}, nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for tests and
+// constants.
+func MustParse(amount, currency string) Money {
+	m, err := Parse(amount, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) IsZero() bool     { return m.Minor == 0 }
+func (m Money) IsPositive() bool { return m.Minor > 0 }
+func (m Money) IsNegative() bool { return m.Minor < 0 }
+
+// Add returns m + o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	sum := m.Minor + o.Minor
+	if (o.Minor > 0 && sum < m.Minor) || (o.Minor < 0 && sum > m.Minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Minor: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o. Both must be in the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Minor == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return m.Add(Money{Minor: -o.Minor, Currency: o.Currency})
+}
+
+// Mul returns m multiplied by a whole quantity.
+func (m Money) Mul(n int64) (Money, error) {
+	return m.MulRate(n, 1, RoundDown)
+}
+
+// Cmp compares m and o and returns -1, 0 or +1. Both must be in the same
+// currency.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Minor < o.Minor:
+		return -1, nil
+	case m.Minor > o.Minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.Currency != o.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return nil
+}
+
+// Decimal formats the amount with the currency's number of decimal places,
+// e.g. "12.50".
+func (m Money) Decimal() string {
+	exp := Exponent(m.Currency)
+	s := new(big.Int).Abs(big.NewInt(m.Minor)).String()
+	if exp > 0 {
+		if len(s) <= exp {
+			s = strings.Repeat("0", exp-len(s)+1) + s
+		}
+		s = s[:len(s)-exp] + "." + s[len(s)-exp:]
+	}
+	if m.Minor < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// jsonMoney is the wire format of Money. Amount is a decimal string so that
+// clients never have to round-trip it through a float; plain JSON numbers are
+// accepted on input and parsed exactly.
+type jsonMoney struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Decimal(), m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var j jsonMoney
+	if err := json.Unmarshal(data, &j); err != nil {
+		return fmt.Errorf("%w: expected {\"amount\": \"12.50\", \"currency\": \"USD\"}", ErrInvalidAmount)
+	}
+	parsed, err := Parse(string(j.Amount), j.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,126 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{amount: "12.50", currency: "USD", want: New(1250, "USD")},
+		{amount: "12.5", currency: "USD", want: New(1250, "USD")},
+		{amount: "-0.07", currency: "USD", want: New(-7, "USD")},
+		{amount: "3", currency: "USD", want: New(300, "USD")},
+		{amount: "1.230", currency: "USD", want: New(123, "USD")},
+		{amount: "500", currency: "JPY", want: New(500, "JPY")},
+		{amount: "1.005", currency: "KWD", want: New(1005, "KWD")},
+		{amount: "1.005", currency: "USD", wantErr: ErrInvalidAmount},
+		{amount: "1e2", currency: "USD", wantErr: ErrInvalidAmount},
+		{amount: ".5", currency: "USD", wantErr: ErrInvalidAmount},
+		{amount: "", currency: "USD", wantErr: ErrInvalidAmount},
+		{amount: "1", currency: "usd", wantErr: ErrInvalidCurrency},
+		{amount: "99999999999999999999", currency: "USD", wantErr: ErrOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.currency, func(t *testing.T) {
+			got, err := Parse(tt.amount, tt.currency)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	assert.Equal(t, "12.50", New(1250, "USD").Decimal())
+	assert.Equal(t, "0.05", New(5, "USD").Decimal())
+	assert.Equal(t, "-0.05", New(-5, "USD").Decimal())
+	assert.Equal(t, "500", New(500, "JPY").Decimal())
+	assert.Equal(t, "0.001", New(1, "KWD").Decimal())
+	assert.Equal(t, "12.50 USD", New(1250, "USD").String())
+}
+
+func TestArithmetic(t *testing.T) {
+	sum, err := MustParse("0.10", "USD").Add(MustParse("0.20", "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, MustParse("0.30", "USD"), sum)
+
+	diff, err := sum.Sub(MustParse("0.45", "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, "-0.15", diff.Decimal())
+
+	line, err := MustParse("8.99", "USD").Mul(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "26.97", line.Decimal())
+
+	_, err = New(1, "USD").Add(New(1, "EUR"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	_, err = New(math.MaxInt64, "USD").Add(New(1, "USD"))
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	_, err = New(math.MaxInt64, "USD").Mul(2)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	cmp, err := New(1, "USD").Cmp(New(2, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, cmp)
+}
+
+func TestRounding(t *testing.T) {
+	tests := []struct {
+		name  string
+		minor int64
+		bps   int64
+		mode  RoundingMode
+		want  int64
+	}{
+		{name: "half up tie", minor: 50, bps: 500, mode: RoundHalfUp, want: 3},            // 2.5
+		{name: "half even tie down", minor: 50, bps: 500, mode: RoundHalfEven, want: 2},   // 2.5
+		{name: "half even tie up", minor: 70, bps: 500, mode: RoundHalfEven, want: 4},     // 3.5
+		{name: "half up below tie", minor: 1999, bps: 1800, mode: RoundHalfUp, want: 360}, // 359.82
+		{name: "down", minor: 1999, bps: 1800, mode: RoundDown, want: 359},
+		{name: "up", minor: 1999, bps: 1800, mode: RoundUp, want: 360},
+		{name: "negative half up", minor: -50, bps: 500, mode: RoundHalfUp, want: -3},
+		{name: "negative down", minor: -1999, bps: 1800, mode: RoundDown, want: -359},
+		{name: "exact", minor: 1000, bps: 1000, mode: RoundUp, want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.minor, "USD").Percent(tt.bps, tt.mode)
+			assert.NoError(t, err)
+			assert.Equal(t, New(tt.want, "USD"), got)
+		})
+	}
+
+	_, err := New(1, "USD").MulRate(1, 0, RoundDown)
+	assert.Error(t, err)
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(MustParse("12.50", "USD"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount":"12.50","currency":"USD"}`, string(data))
+
+	var m Money
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount":"0.10","currency":"EUR"}`), &m))
+	assert.Equal(t, New(10, "EUR"), m)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount":19.99,"currency":"USD"}`), &m))
+	assert.Equal(t, New(1999, "USD"), m)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":"1.999","currency":"USD"}`), &m))
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":"1.00"}`), &m))
+	assert.Error(t, json.Unmarshal([]byte(`12.5`), &m))
+}
@@ -0,0 +1,82 @@
+package money
+
+import (
+	"errors"
+	"math/big"
+)
+
+// RoundingMode decides what happens to a fraction of a minor unit.
+//
+// Rules used across the services:
+//   - taxes and fees are computed on the order subtotal with RoundHalfUp;
+//   - discounts are computed with RoundDown, so they never exceed the
+//     advertised rate;
+//   - quantities multiply exactly and need no rounding.
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds to the nearest minor unit, ties away from zero.
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds to the nearest minor unit, ties to the even one.
+	RoundHalfEven
+	// RoundDown truncates towards zero.
+	RoundDown
+	// RoundUp rounds away from zero.
+	RoundUp
+)
+
+// MulRate returns m * num / den rounded with mode, e.g. MulRate(7, 100, ...)
+// for 7%.
+func (m Money) MulRate(num, den int64, mode RoundingMode) (Money, error) {
+	if den == 0 {
+		return Money{}, errors.New("money: zero denominator")
+	}
+	n := new(big.Int).Mul(big.NewInt(m.Minor), big.NewInt(num))
+	d := big.NewInt(den)
+	if d.Sign() < 0 {
+		n.Neg(n)
+		d.Neg(d)
+	}
+
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() != 0 && roundAway(q, r, d, mode) {
+		if n.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if !q.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{Minor: q.Int64(), Currency: m.Currency}, nil
+}
+
+// Percent returns basisPoints/10000 of m, e.g. Percent(1850, RoundHalfUp) for
+// 18.5% tax.
+func (m Money) Percent(basisPoints int64, mode RoundingMode) (Money, error) {
+	return m.MulRate(basisPoints, 10000, mode)
+}
+
+// roundAway reports whether the truncated quotient q, with non-zero remainder
+// r over divisor d > 0, has to move one unit away from zero.
+func roundAway(q, r, d *big.Int, mode RoundingMode) bool {
+	switch mode {
+	case RoundDown:
+		return false
+	case RoundUp:
+		return true
+	}
+	twice := new(big.Int).Abs(r)
+	twice.Lsh(twice, 1)
+	switch twice.Cmp(d) {
+	case 1:
+		return true
+	case -1:
+		return false
+	}
+	if mode == RoundHalfEven {
+		return q.Bit(0) == 1
+	}
+	return true
+}
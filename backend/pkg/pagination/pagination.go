@@ -0,0 +1,59 @@
+// Package pagination holds what paginated lists have in common: the opaque
+// cursor that continues a list, and the from and to parameters that bound
+// it.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	"zamato/pkg/problem"
+)
+
+var errMalformedCursor = errors.New("malformed cursor")
+
+// EncodeCursor returns the opaque token of position, which must marshal to
+// JSON. Clients pass it back as is; DecodeCursor reads it.
+func EncodeCursor(position any) string {
+	raw, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor reads a token made by EncodeCursor into position. It only
+// checks that the token is well formed; whether position makes sense is up
+// to the caller.
+func DecodeCursor(token string, position any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(raw, position)
+	}
+	if err != nil {
+		return errMalformedCursor
+	}
+	return nil
+}
+
+// TimeParam parses the query parameter name as an RFC 3339 time or a date,
+// which stands for its midnight in UTC, or for the next one when endOfDay is
+// set so that a to date includes the whole day. It returns nil when the
+// parameter is missing.
+func TimeParam(params url.Values, name string, endOfDay bool) (*time.Time, error) {
+	v := params.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s %q: want an RFC 3339 time or a date", problem.ErrInvalidRequest, name, v)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,58 @@
+package pagination
+
+import (
+	"net/url"
+	"testing"
+	"time"
+	"zamato/pkg/problem"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type position struct {
+	CreatedAt int64  `json:"t"`
+	ID        string `json:"id"`
+}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	token := EncodeCursor(position{CreatedAt: 42, ID: "pay_1"})
+	assert.NotContains(t, token, "pay_1", "cursor should be opaque")
+
+	var got position
+	assert.NoError(t, DecodeCursor(token, &got))
+	assert.Equal(t, position{CreatedAt: 42, ID: "pay_1"}, got)
+}
+
+func TestDecodeCursor_Malformed(t *testing.T) {
+	for _, token := range []string{"not base64!", "bm90IGpzb24"} {
+		var got position
+		assert.ErrorIs(t, DecodeCursor(token, &got), errMalformedCursor, token)
+	}
+}
+
+func TestTimeParam(t *testing.T) {
+	params := url.Values{
+		"at":  {"2026-03-01T10:30:00Z"},
+		"day": {"2026-03-01"},
+		"bad": {"yesterday"},
+	}
+
+	got, err := TimeParam(params, "missing", false)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	got, err = TimeParam(params, "at", true)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC), got.UTC())
+
+	got, err = TimeParam(params, "day", false)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), *got)
+
+	got, err = TimeParam(params, "day", true)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), *got)
+
+	_, err = TimeParam(params, "bad", false)
+	assert.ErrorIs(t, err, problem.ErrInvalidRequest)
+}
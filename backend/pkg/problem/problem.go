@@ -0,0 +1,143 @@
+// Package problem is the error model of the HTTP API. Domain errors are
+// declared with New and carry a Kind and a stable, machine-readable code;
+// Write answers any error as an RFC 7807 application/problem+json document.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// ContentType is the media type of problem documents.
+const ContentType = "application/problem+json"
+
+// Kind is the class of a failure. It decides the HTTP status the failure is
+// answered with.
+type Kind int
+
+const (
+	Internal Kind = iota
+	Invalid
+	Unauthorized
+	Declined
+	Forbidden
+	NotFound
+	NotAllowed
+	Conflict
+	TooLarge
+	Unprocessable
+	Upstream
+)
+
+var statuses = map[Kind]int{
+	Internal:      http.StatusInternalServerError,
+	Invalid:       http.StatusBadRequest,
+	Unauthorized:  http.StatusUnauthorized,
+	Declined:      http.StatusPaymentRequired,
+	Forbidden:     http.StatusForbidden,
+	NotFound:      http.StatusNotFound,
+	NotAllowed:    http.StatusMethodNotAllowed,
+	Conflict:      http.StatusConflict,
+	TooLarge:      http.StatusRequestEntityTooLarge,
+	Unprocessable: http.StatusUnprocessableEntity,
+	Upstream:      http.StatusBadGateway,
+}
+
+// Status returns the HTTP status of failures of kind k.
+func (k Kind) Status() int {
+	if status, ok := statuses[k]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is a domain error. Declare errors as package-level sentinels and
+// wrap them with fmt.Errorf("%w: ...") to add detail; errors.Is still
+// matches the sentinel and Write still finds its code.
+type Error struct {
+	Kind Kind
+	// Code identifies the error to clients. Once published it must not
+	// change.
+	Code    string
+	Message string
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Errors that belong to no particular domain.
+var (
+	ErrInvalidRequest   = New(Invalid, "invalid_request", "invalid request")
+	ErrUnauthorized     = New(Unauthorized, "unauthorized", "unauthorized")
+	ErrForbidden        = New(Forbidden, "forbidden", "forbidden")
+	ErrNotFound         = New(NotFound, "not_found", "not found")
+	ErrMethodNotAllowed = New(NotAllowed, "method_not_allowed", "method not allowed")
+	ErrInternal         = New(Internal, "internal_error", "internal server error")
+)
+
+// From returns the domain error err is or wraps. A record the database did
+// not find is ErrNotFound and anything unknown is ErrInternal.
+func From(err error) *Error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	default:
+		return ErrInternal
+	}
+}
+
+// Details is a problem document. Type is always about:blank, so Title is
+// the text of Status; Code tells clients which error it is.
+type Details struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Write answers r with the problem document for err. The detail of internal
+// and upstream errors is logged with the request ID instead of being sent,
+// so that clients never see database, dependency or gateway internals.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+	status := e.Kind.Status()
+	requestID := RequestID(r.Context())
+	details := Details{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    err.Error(),
+		Instance:  r.URL.Path,
+		Code:      e.Code,
+		RequestID: requestID,
+	}
+	if e.Kind == Internal || e.Kind == Upstream {
+		log.Printf("request %s: %s %s failed: %v", requestID, r.Method, r.URL.Path, err)
+		details.Detail = e.Message
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(details)
+}
+
+// Handler answers every request with err, for use as a router's NotFound
+// or MethodNotAllowed handler.
+func Handler(err error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, err)
+	})
+}
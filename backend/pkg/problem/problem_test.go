@@ -0,0 +1,54 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var errThingMissing = New(NotFound, "thing_not_found", "thing not found")
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{name: "domain error", err: errThingMissing, wantStatus: http.StatusNotFound, wantCode: "thing_not_found", wantDetail: "thing not found"},
+		{name: "wrapped", err: fmt.Errorf("%w: 42", errThingMissing), wantStatus: http.StatusNotFound, wantCode: "thing_not_found", wantDetail: "thing not found: 42"},
+		{name: "record not found", err: gorm.ErrRecordNotFound, wantStatus: http.StatusNotFound, wantCode: "not_found", wantDetail: "record not found"},
+		{name: "unknown", err: errors.New("pq: connection refused"), wantStatus: http.StatusInternalServerError, wantCode: "internal_error", wantDetail: "internal server error"},
+		{name: "upstream", err: fmt.Errorf("%w: dial tcp 10.0.3.7:8084: connection refused", New(Upstream, "menu_lookup_failed", "menu lookup failed")), wantStatus: http.StatusBadGateway, wantCode: "menu_lookup_failed", wantDetail: "menu lookup failed"},
+		{name: "declined", err: New(Declined, "declined", "declined"), wantStatus: http.StatusPaymentRequired, wantCode: "declined", wantDetail: "declined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/things/42", nil)
+			req = req.WithContext(WithRequestID(req.Context(), "req-1"))
+			rr := httptest.NewRecorder()
+			Write(rr, req, tt.err)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, ContentType, rr.Header().Get("Content-Type"))
+			var got Details
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+			assert.Equal(t, Details{
+				Type:      "about:blank",
+				Title:     http.StatusText(tt.wantStatus),
+				Status:    tt.wantStatus,
+				Detail:    tt.wantDetail,
+				Instance:  "/things/42",
+				Code:      tt.wantCode,
+				RequestID: "req-1",
+			}, got)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package problem
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID of a request, from the client if it sent
+// one, and is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID stored by RequestIDMiddleware, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// RequestIDMiddleware gives every request an ID, stored in its context and
+// echoed in the RequestIDHeader of the response. A client-supplied ID is
+// kept if it is short and printable, so that a call can be traced across
+// services; otherwise a new one is generated.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
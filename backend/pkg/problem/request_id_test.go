@@ -0,0 +1,46 @@
+package problem
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantKept bool
+	}{
+		{name: "generated", incoming: ""},
+		{name: "kept from client", incoming: "abc-123", wantKept: true},
+		{name: "too long", incoming: strings.Repeat("a", maxRequestIDLength+1)},
+		{name: "not printable", incoming: "abc\x00def"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			assert.NotEmpty(t, seen)
+			assert.Equal(t, seen, rr.Header().Get(RequestIDHeader))
+			if tt.wantKept {
+				assert.Equal(t, tt.incoming, seen)
+			} else {
+				assert.NotEqual(t, tt.incoming, seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Package schema records which schema version a service migrated its
+// database to, and checks the database from /readyz.
+package schema
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration records that the database was migrated to Version, i.e. that a
+// build expecting that version ran its startup migrations to the end.
+type Migration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	AppliedAt time.Time
+}
+
+func (Migration) TableName() string { return "schema_migrations" }
+
+// Record marks the database as migrated to version. Call it once every
+// startup migration succeeded.
+func Record(db *gorm.DB, version int) error {
+	return db.Where(Migration{Version: version}).
+		Attrs(Migration{AppliedAt: db.NowFunc()}).
+		FirstOrCreate(&Migration{}).Error
+}
+
+// Check returns a health check that fails until the database has been
+// migrated to at least version. A newer schema passes, so that instances of
+// the previous build stay ready during a rolling deploy.
+func Check(db *gorm.DB, version int) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var current int
+		if err := db.WithContext(ctx).Model(&Migration{}).
+			Select("COALESCE(MAX(version), 0)").Scan(&current).Error; err != nil {
+			return err
+		}
+		if current < version {
+			return fmt.Errorf("schema version %d, want %d", current, version)
+		}
+		return nil
+	}
+}
+
+// Ping returns a health check that pings the database.
+func Ping(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
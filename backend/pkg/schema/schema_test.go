@@ -0,0 +1,35 @@
+package schema
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestChecks(t *testing.T) {
+	const version = 3
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&Migration{}))
+	assert.True(t, db.Migrator().HasTable("schema_migrations"))
+	ctx := context.Background()
+
+	assert.NoError(t, Ping(db)(ctx))
+	assert.ErrorContains(t, Check(db, version)(ctx), "schema version 0")
+
+	assert.NoError(t, Record(db, version))
+	assert.NoError(t, Record(db, version), "recording the same version twice")
+	assert.NoError(t, Check(db, version)(ctx))
+
+	// A newer build migrated the database; this one stays ready.
+	assert.NoError(t, Record(db, version+1))
+	assert.NoError(t, Check(db, version)(ctx))
+
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	sqlDB.Close()
+	assert.Error(t, Ping(db)(ctx))
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check reports whether a dependency works; it should give up when ctx is
+// done.
+type Check func(ctx context.Context) error
+
+// Health serves /livez and /readyz. The service is live as long as it
+// answers, and ready while Run serves and every check passes.
+type Health struct {
+	readiness *Readiness
+	timeout   time.Duration
+	names     []string
+	checks    map[string]Check
+}
+
+// NewHealth returns a Health that runs each check with timeout.
+func NewHealth(readiness *Readiness, timeout time.Duration) *Health {
+	return &Health{readiness: readiness, timeout: timeout, checks: make(map[string]Check)}
+}
+
+// Add registers check under name. Every check is critical: one failing check
+// makes the service not ready.
+func (h *Health) Add(name string, check Check) {
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// Report is the body of /livez and /readyz.
+type Report struct {
+	// Status is "ok", "unavailable" when a check failed, or "draining"
+	// during shutdown.
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of one check. Status is "ok", "timeout" or
+// "error"; why a check failed is only logged, since /readyz is public.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Live answers 200 whenever the process can serve requests at all.
+func (h *Health) Live() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Report{Status: "ok"})
+	})
+}
+
+// Ready runs every check concurrently and answers 200 if all of them pass,
+// 503 otherwise. While the server drains it answers 503 without checking.
+func (h *Health) Ready() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.readiness.Ready() {
+			writeReport(w, http.StatusServiceUnavailable, Report{Status: "draining"})
+			return
+		}
+		report := h.Check(r.Context())
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		writeReport(w, status, report)
+	})
+}
+
+// Check runs every check and reports their outcome.
+func (h *Health) Check(ctx context.Context) Report {
+	report := Report{Status: "ok", Checks: make(map[string]CheckResult, len(h.names))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range h.names {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := h.run(ctx, name, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != "ok" {
+				report.Status = "unavailable"
+			}
+		}(name, h.checks[name])
+	}
+	wg.Wait()
+	return report
+}
+
+func (h *Health) run(ctx context.Context, name string, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	// A check that ignores ctx is abandoned rather than waited for.
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := CheckResult{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		log.Printf("health check %s failed: %v", name, err)
+		result.Status = "error"
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Status = "timeout"
+		}
+	}
+	return result
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// HTTPCheck checks that GET url answers with a 2xx status.
+func HTTPCheck(client *http.Client, url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
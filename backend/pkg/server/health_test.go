@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readyReport(t *testing.T, h *Health) (int, Report) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.Ready().ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var report Report
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&report))
+	return rr.Code, report
+}
+
+func TestHealth_Ready(t *testing.T) {
+	var readiness Readiness
+	h := NewHealth(&readiness, 50*time.Millisecond)
+	failing := false
+	h.Add("database", func(ctx context.Context) error {
+		if failing {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	h.Add("payment-service", func(ctx context.Context) error { return nil })
+
+	code, report := readyReport(t, h)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "draining", report.Status)
+	assert.Empty(t, report.Checks)
+
+	readiness.set(true)
+	code, report = readyReport(t, h)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", report.Status)
+	assert.Equal(t, "ok", report.Checks["database"].Status)
+	assert.Equal(t, "ok", report.Checks["payment-service"].Status)
+
+	failing = true
+	code, report = readyReport(t, h)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", report.Status)
+	assert.Equal(t, "error", report.Checks["database"].Status)
+	assert.Equal(t, "ok", report.Checks["payment-service"].Status)
+
+	// Why a check failed is logged, not published.
+	rr := httptest.NewRecorder()
+	h.Ready().ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	assert.NotContains(t, rr.Body.String(), "connection refused")
+}
+
+func TestHealth_CheckTimeout(t *testing.T) {
+	var readiness Readiness
+	readiness.set(true)
+	h := NewHealth(&readiness, 20*time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	h.Add("stuck", func(ctx context.Context) error {
+		<-block // ignores ctx
+		return nil
+	})
+
+	start := time.Now()
+	code, report := readyReport(t, h)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "timeout", report.Checks["stuck"].Status)
+	assert.GreaterOrEqual(t, report.Checks["stuck"].LatencyMS, 20.0)
+}
+
+func TestHealth_Live(t *testing.T) {
+	h := NewHealth(&Readiness{}, time.Second)
+	h.Add("database", func(ctx context.Context) error { return errors.New("down") })
+
+	rr := httptest.NewRecorder()
+	h.Live().ServeHTTP(rr, httptest.NewRequest("GET", "/livez", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+func TestHTTPCheck(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/livez", r.URL.Path)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	check := HTTPCheck(srv.Client(), srv.URL+"/livez")
+	assert.NoError(t, check(context.Background()))
+
+	status = http.StatusInternalServerError
+	assert.ErrorContains(t, check(context.Background()), "returned 500")
+
+	srv.Close()
+	assert.Error(t, check(context.Background()))
+}
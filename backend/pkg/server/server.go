@@ -0,0 +1,120 @@
+// Package server runs a service's HTTP server and shuts it down gracefully:
+// on SIGINT or SIGTERM the service first reports itself as not ready, then
+// stops accepting connections and lets in-flight requests finish, and only
+// then stops its background workers.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds the timeouts of the HTTP server.
+type Config struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// DrainDelay is how long the server keeps serving after it started
+	// reporting not ready, so that load balancers stop sending it traffic
+	// before it stops accepting connections.
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds how long in-flight requests and then background
+	// workers get to finish, together: the workers get what the requests
+	// left of it.
+	ShutdownTimeout time.Duration
+	// CheckTimeout bounds each dependency check of /readyz.
+	CheckTimeout time.Duration
+}
+
+// New returns an HTTP server for handler listening on addr.
+func New(addr string, handler http.Handler, cfg Config) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// Readiness tells whether the service should get traffic. It is false until
+// Run starts serving and again once Run starts draining; Health reports it on
+// /readyz.
+type Readiness struct {
+	ready atomic.Bool
+}
+
+func (r *Readiness) Ready() bool { return r.ready.Load() }
+
+func (r *Readiness) set(ready bool) { r.ready.Store(ready) }
+
+// Run serves srv until ctx is done and then drains it: readiness turns false,
+// the server keeps serving for DrainDelay, and Shutdown gives in-flight
+// requests up to ShutdownTimeout before the remaining connections are
+// closed. stop, if not nil, is then called to stop the background workers
+// with whatever is left of ShutdownTimeout, so that the whole shutdown takes
+// at most DrainDelay plus ShutdownTimeout. It returns nil after a clean
+// shutdown.
+func Run(ctx context.Context, srv *http.Server, cfg Config, readiness *Readiness, stop func(context.Context)) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	return serve(ctx, srv, ln, cfg, readiness, stop)
+}
+
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, cfg Config, readiness *Readiness, stop func(context.Context)) error {
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+	readiness.set(true)
+
+	err := drain(ctx, cfg, readiness, serveErr)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err == nil {
+		err = shutdown(shutdownCtx, srv, serveErr)
+	}
+	if stop != nil {
+		stop(shutdownCtx)
+	}
+	return err
+}
+
+// drain waits for ctx to be done, then reports not ready and keeps serving
+// for DrainDelay. It returns the server's error if it stops on its own first.
+func drain(ctx context.Context, cfg Config, readiness *Readiness, serveErr <-chan error) error {
+	select {
+	case err := <-serveErr:
+		readiness.set(false)
+		return err
+	case <-ctx.Done():
+	}
+
+	readiness.set(false)
+	log.Printf("Shutting down: draining for %s", cfg.DrainDelay)
+	select {
+	case err := <-serveErr:
+		return err
+	case <-time.After(cfg.DrainDelay):
+		return nil
+	}
+}
+
+func shutdown(ctx context.Context, srv *http.Server, serveErr <-chan error) error {
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_DrainsInFlightRequests(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	url := "http://" + ln.Addr().String()
+
+	var readiness Readiness
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle("/ready", NewHealth(&readiness, time.Second).Ready())
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	cfg := Config{DrainDelay: 50 * time.Millisecond, ShutdownTimeout: 5 * time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- serve(ctx, New("", mux, cfg), ln, cfg, &readiness, nil) }()
+
+	resp, err := http.Get(url + "/ready")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-started
+
+	cancel()
+	assert.Eventually(t, func() bool { return !readiness.Ready() }, time.Second, time.Millisecond)
+
+	// While draining the server still answers, but reports not ready.
+	resp, err = http.Get(url + "/ready")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	close(release)
+	assert.Equal(t, "done", <-slow)
+	assert.NoError(t, <-runErr)
+
+	_, err = http.Get(url + "/ready")
+	assert.Error(t, err, "server should no longer accept connections")
+}
+
+func TestRun_ShutdownTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	cfg := Config{ShutdownTimeout: 20 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- serve(ctx, New("", handler, cfg), ln, cfg, &Readiness{}, nil) }()
+
+	go http.Get("http://" + ln.Addr().String())
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-runErr, context.DeadlineExceeded)
+}
+
+func TestRun_StopSharesShutdownTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	cfg := Config{ShutdownTimeout: time.Second}
+	var left time.Duration
+	stop := func(ctx context.Context) {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		left = time.Until(deadline)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- serve(ctx, New("", handler, cfg), ln, cfg, &Readiness{}, stop) }()
+
+	go http.Get("http://" + ln.Addr().String())
+	<-started
+	cancel()
+	assert.NoError(t, <-runErr)
+	// The workers only get what the in-flight request left of the timeout.
+	assert.Less(t, left, cfg.ShutdownTimeout-50*time.Millisecond)
+	assert.Greater(t, left, time.Duration(0))
+}
+
+func TestWorkers_Stop(t *testing.T) {
+	workers := NewWorkers()
+	stopped := make(chan struct{})
+	workers.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	assert.NoError(t, workers.Stop(context.Background()))
+	<-stopped
+
+	stuck := NewWorkers()
+	block := make(chan struct{})
+	defer close(block)
+	stuck.Go(func(ctx context.Context) { <-block })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, stuck.Stop(ctx), context.DeadlineExceeded)
+}
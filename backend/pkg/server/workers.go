@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// Workers runs background loops, such as the outbox relay, until Stop.
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewWorkers() *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{ctx: ctx, cancel: cancel}
+}
+
+// Go runs run in the background. Its context is cancelled by Stop, and run
+// should return soon after.
+func (w *Workers) Go(run func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		run(w.ctx)
+	}()
+}
+
+// Stop cancels the workers and waits for them to return, or for ctx to be
+// done, in which case it returns ctx's error.
+func (w *Workers) Stop(ctx context.Context) error {
+	w.cancel()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}